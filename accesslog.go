@@ -0,0 +1,39 @@
+package main
+
+import (
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/rs/zerolog"
+)
+
+// accessLogMiddleware logs each request with its route template, status,
+// latency and response size. Only one in every sample requests is logged,
+// except for server errors, which always are.
+func accessLogMiddleware(sample int) echo.MiddlewareFunc {
+	log := componentLogger("http", "")
+	sampled := log.Sample(&zerolog.BasicSampler{N: uint32(sample)})
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+			req, res := c.Request(), c.Response()
+			event := sampled.Info()
+			if res.Status >= 500 {
+				event = log.Error()
+			}
+			event.
+				Str("method", req.Method).
+				Str("route", c.Path()).
+				Str("path", req.URL.Path).
+				Int("status", res.Status).
+				Dur("latency", time.Since(start)).
+				Int64("bytes", res.Size).
+				Str("remote_ip", c.RealIP()).
+				Msg("request")
+			return nil
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLogMiddleware(t *testing.T) {
+	prev := logger
+	defer func() { logger = prev }()
+	var buf bytes.Buffer
+	logger = newLogger(&buf)
+
+	e := echo.New()
+	e.Use(accessLogMiddleware(2))
+	e.GET("/:network/:slot", func(c echo.Context) error {
+		if c.Param("slot") == "fail" {
+			return echo.NewHTTPError(http.StatusInternalServerError, "oops")
+		}
+		return c.String(http.StatusOK, "block")
+	})
+	for _, target := range []string{"/prater/1", "/prater/2", "/prater/3", "/prater/fail", "/prater/fail"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	var entries []map[string]interface{}
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	// One in two successful requests are logged, and every server error.
+	require.Len(t, entries, 4)
+	require.Equal(t, "/:network/:slot", entries[0]["route"])
+	require.Equal(t, "/prater/1", entries[0]["path"])
+	require.Equal(t, "GET", entries[0]["method"])
+	require.Equal(t, float64(200), entries[0]["status"])
+	require.Equal(t, float64(len("block")), entries[0]["bytes"])
+	require.Equal(t, "http", entries[0]["component"])
+	require.Equal(t, "/prater/3", entries[1]["path"])
+	for _, entry := range entries[2:] {
+		require.Equal(t, "error", entry["level"])
+		require.Equal(t, float64(500), entry["status"])
+	}
+}
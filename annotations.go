@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo"
+)
+
+// Annotations are key-value pairs attached to a slot, such as a label or a
+// tag like "reorg", for curating interesting slots. Each is stored under
+// keyAnnotation||slot||name. They're purged and expired along with their slot,
+// unless it's pinned, and replicated along with it.
+
+const (
+	maxAnnotationName  = 128
+	maxAnnotationValue = 1024
+
+	// maxAnnotationsBody limits the size of a PUT's body.
+	maxAnnotationsBody = 64 << 10
+)
+
+// headerAnnotations carries the annotations of a block's slot along with it,
+// form-encoded (such as label=big+block&tag=reorg).
+const headerAnnotations = "X-Annotations"
+
+func annotationKey(slot phase0.Slot, name string) []byte {
+	return append(slotKey(keyAnnotation, slot), name...)
+}
+
+// Annotate sets the given annotations of the slot, keeping its others.
+func (s *Store) Annotate(slot phase0.Slot, annotations map[string]string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		// They expire along with the slot, if it does.
+		expiresAt, err := s.expiresAt(txn, slot)
+		if err != nil {
+			return err
+		}
+		w := withExpiry(txn, expiresAt)
+		for name, value := range annotations {
+			if err := w.Set(annotationKey(slot, name), []byte(value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Annotations returns the annotations of the slot, which is empty if it has
+// none.
+func (s *Store) Annotations(slot phase0.Slot) (map[string]string, error) {
+	annotations := make(map[string]string)
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: slotKey(keyAnnotation, slot)})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			name := string(it.Item().Key()[len(keyAnnotation)+8:])
+			err := it.Item().Value(func(val []byte) error {
+				annotations[name] = string(val)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return annotations, err
+}
+
+// AnnotatedSlots returns the annotations of every annotated slot.
+func (s *Store) AnnotatedSlots() (map[phase0.Slot]map[string]string, error) {
+	slots := make(map[phase0.Slot]map[string]string)
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: keyAnnotation})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			key := it.Item().Key()[len(keyAnnotation):]
+			slot := phase0.Slot(binary.BigEndian.Uint64(key))
+			if slots[slot] == nil {
+				slots[slot] = make(map[string]string)
+			}
+			err := it.Item().Value(func(val []byte) error {
+				slots[slot][string(key[8:])] = string(val)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return slots, err
+}
+
+// DeleteAnnotations deletes the given annotations of the slot, or all of
+// them if none are given.
+func (s *Store) DeleteAnnotations(slot phase0.Slot, names ...string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		var keys [][]byte
+		for _, name := range names {
+			keys = append(keys, annotationKey(slot, name))
+		}
+		if len(names) == 0 {
+			opts := badger.DefaultIteratorOptions
+			opts.PrefetchValues = false
+			opts.Prefix = slotKey(keyAnnotation, slot)
+			it := txn.NewIterator(opts)
+			for it.Rewind(); it.Valid(); it.Next() {
+				keys = append(keys, it.Item().KeyCopy(nil))
+			}
+			it.Close()
+		}
+		for _, key := range keys {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// purgeAnnotations deletes the annotations of the unpinned slots within the
+// given range (inclusive), along with Purge.
+func purgeAnnotations(txn *badger.Txn, from, to phase0.Slot) error {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = keyAnnotation
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	for it.Seek(slotKey(keyAnnotation, from)); it.Valid(); it.Next() {
+		key := it.Item().KeyCopy(nil)
+		slot := phase0.Slot(binary.BigEndian.Uint64(key[len(keyAnnotation):]))
+		if slot > to {
+			break
+		}
+		if pinned, err := isPinned(txn, slot); err != nil {
+			return err
+		} else if pinned {
+			continue
+		}
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setAnnotationsHeader sends the slot's annotations along with its block, and
+// returns them as sent (empty if there are none) for its ETag.
+func setAnnotationsHeader(c echo.Context, store *Store, slot phase0.Slot) (string, error) {
+	annotations, err := store.Annotations(slot)
+	if err != nil || len(annotations) == 0 {
+		return "", err
+	}
+	values := make(url.Values, len(annotations))
+	for name, value := range annotations {
+		values.Set(name, value)
+	}
+	encoded := values.Encode()
+	c.Response().Header().Set(headerAnnotations, encoded)
+	return encoded, nil
+}
+
+// annotationsHandler lists the annotations of every annotated slot.
+func annotationsHandler(c echo.Context) error {
+	store, err := getStore(c.Param("network"))
+	if err != nil {
+		return err
+	}
+	slots, err := store.AnnotatedSlots()
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"slots": slots})
+}
+
+// slotAnnotationsHandler returns the slot's annotations, sets those given as
+// a JSON object for PUT requests (keeping the others), or deletes those given
+// as key params (or all of them) for DELETE requests.
+func slotAnnotationsHandler(c echo.Context) error {
+	slot, err := strconv.ParseUint(c.Param("slot"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid slot")
+	}
+	store, err := getStore(c.Param("network"))
+	if err != nil {
+		return err
+	}
+	switch c.Request().Method {
+	case http.MethodPut:
+		var annotations map[string]string
+		body := io.LimitReader(c.Request().Body, maxAnnotationsBody)
+		if err := json.NewDecoder(body).Decode(&annotations); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "annotations must be a JSON object of strings")
+		}
+		for name, value := range annotations {
+			if name == "" || len(name) > maxAnnotationName {
+				return echo.NewHTTPError(http.StatusBadRequest, "annotation names must be 1 to 128 bytes")
+			}
+			if len(value) > maxAnnotationValue {
+				return echo.NewHTTPError(http.StatusBadRequest, "annotation values must be at most 1024 bytes")
+			}
+		}
+		if err := store.Annotate(phase0.Slot(slot), annotations); err != nil {
+			return err
+		}
+	case http.MethodDelete:
+		if err := store.DeleteAnnotations(phase0.Slot(slot), c.QueryParams()["key"]...); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+	annotations, err := store.Annotations(phase0.Slot(slot))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, annotations)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotations(t *testing.T) {
+	store := newTestStore(t)
+	annotations, err := store.Annotations(1)
+	require.NoError(t, err)
+	require.Empty(t, annotations)
+
+	require.NoError(t, store.Annotate(1, map[string]string{"tag": "reorg", "note": "first"}))
+	require.NoError(t, store.Annotate(1, map[string]string{"note": "second"}))
+	require.NoError(t, store.Annotate(256, map[string]string{"tag": "big-mev"}))
+	annotations, err = store.Annotations(1)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"tag": "reorg", "note": "second"}, annotations)
+	slots, err := store.AnnotatedSlots()
+	require.NoError(t, err)
+	require.Equal(t, map[phase0.Slot]map[string]string{
+		1:   {"tag": "reorg", "note": "second"},
+		256: {"tag": "big-mev"},
+	}, slots)
+
+	require.NoError(t, store.DeleteAnnotations(1, "note"))
+	annotations, err = store.Annotations(1)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"tag": "reorg"}, annotations)
+	require.NoError(t, store.DeleteAnnotations(256))
+	annotations, err = store.Annotations(256)
+	require.NoError(t, err)
+	require.Empty(t, annotations)
+}
+
+func TestPurgeAnnotations(t *testing.T) {
+	store := newTestStore(t)
+	for slot := phase0.Slot(1); slot <= 3; slot++ {
+		require.NoError(t, store.SetBlock(slot, testBlock(slot)))
+		require.NoError(t, store.Annotate(slot, map[string]string{"tag": "curated"}))
+	}
+	require.NoError(t, store.Pin(2))
+
+	// They roll off with their slots, unless pinned.
+	_, err := store.Purge(0, 2)
+	require.NoError(t, err)
+	slots, err := store.AnnotatedSlots()
+	require.NoError(t, err)
+	require.Len(t, slots, 2)
+	require.Contains(t, slots, phase0.Slot(2))
+	require.Contains(t, slots, phase0.Slot(3))
+}
+
+func TestSlotAnnotationsHandler(t *testing.T) {
+	const network = "annotations"
+	store := newTestStore(t)
+	stores.Set(network, store)
+	t.Cleanup(func() { stores.Del(network) })
+	require.NoError(t, store.SetBlock(1, testBlock(1)))
+
+	e := echo.New()
+	serve := func(handler echo.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(method, target, strings.NewReader(body)), rec)
+		c.SetParamNames("network", "slot")
+		c.SetParamValues(network, "1")
+		if err := handler(c); err != nil {
+			e.HTTPErrorHandler(err, c)
+		}
+		return rec
+	}
+	const path = "/" + network + "/1/annotations"
+
+	rec := serve(slotAnnotationsHandler, http.MethodGet, path, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{}`, rec.Body.String())
+
+	rec = serve(slotAnnotationsHandler, http.MethodPut, path, `{"tag":"big-mev","note":"a & b"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"tag":"big-mev","note":"a & b"}`, rec.Body.String())
+	for _, body := range []string{`["tag"]`, `{"tag":1}`, `{"":"x"}`, `{"tag":"` + strings.Repeat("x", 1025) + `"}`} {
+		require.Equal(t, http.StatusBadRequest, serve(slotAnnotationsHandler, http.MethodPut, path, body).Code, body)
+	}
+
+	// They're sent along with the block.
+	rec = serve(slotHeadHandler, http.MethodHead, "/"+network+"/1", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	values, err := url.ParseQuery(rec.Header().Get(headerAnnotations))
+	require.NoError(t, err)
+	require.Equal(t, url.Values{"tag": {"big-mev"}, "note": {"a & b"}}, values)
+
+	rec = serve(annotationsHandler, http.MethodGet, "/"+network+"/annotations", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"slots":{"1":{"tag":"big-mev","note":"a & b"}}}`, rec.Body.String())
+
+	require.Equal(t, http.StatusNoContent, serve(slotAnnotationsHandler, http.MethodDelete, path+"?key=note", "").Code)
+	require.JSONEq(t, `{"tag":"big-mev"}`, serve(slotAnnotationsHandler, http.MethodGet, path, "").Body.String())
+	require.Equal(t, http.StatusNoContent, serve(slotAnnotationsHandler, http.MethodDelete, path, "").Code)
+	require.JSONEq(t, `{}`, serve(slotAnnotationsHandler, http.MethodGet, path, "").Body.String())
+	rec = serve(slotHeadHandler, http.MethodHead, "/"+network+"/1", "")
+	require.Empty(t, rec.Header().Get(headerAnnotations))
+}
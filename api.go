@@ -0,0 +1,25 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/labstack/echo"
+)
+
+// apiVersion is the version of the API's responses, sent with each as the
+// X-Blockbuster-API header so that clients can detect breaking changes. It
+// must be bumped whenever a response changes incompatibly, and whenever the
+// block envelope (see blockResponse) gains or loses a top-level field, such
+// as for pagination or truncation, even though that's additive. Version 1 is
+// the envelope of version, root, attestations (when paginated) and data.
+const apiVersion = 1
+
+const headerAPIVersion = "X-Blockbuster-API"
+
+// apiVersionMiddleware sends the API version with every response.
+func apiVersionMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set(headerAPIVersion, strconv.Itoa(apiVersion))
+		return next(c)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIVersionHeader(t *testing.T) {
+	e := echo.New()
+	e.Pre(apiVersionMiddleware)
+	e.GET("/ok", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	for path, code := range map[string]int{"/ok": http.StatusOK, "/missing": http.StatusNotFound} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, code, rec.Code)
+		require.Equal(t, "1", rec.Header().Get(headerAPIVersion), path)
+	}
+}
+
+// TestBlockEnvelope pins the block envelope's top-level fields to
+// apiVersion: changing them breaks clients, so apiVersion must be bumped
+// along with this test.
+func TestBlockEnvelope(t *testing.T) {
+	require.Equal(t, 1, apiVersion)
+	opts := blockOptions{attestationsLimit: -1, paginate: true}
+	b, err := json.Marshal(newBlockResponse(testBlock(1), opts))
+	require.NoError(t, err)
+	var envelope map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(b, &envelope))
+	fields := make([]string, 0, len(envelope))
+	for field := range envelope {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	require.Equal(t, []string{"attestations", "data", "root", "version"}, fields)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// Admin routes require -admin-token as a bearer token, and are disabled
+// without it. With -read-token, every other route requires it (or the admin
+// token) likewise, except for the probes and metrics, which are left open
+// for the infrastructure polling them.
+
+// openRoutes are the routes which -read-token leaves open.
+var openRoutes = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// hasToken returns whether the request carries one of the given (non-empty)
+// tokens as its bearer token, comparing them in constant time.
+func hasToken(c echo.Context, tokens ...string) bool {
+	auth := c.Request().Header.Get(echo.HeaderAuthorization)
+	given := strings.TrimPrefix(auth, "Bearer ")
+	if given == auth {
+		return false
+	}
+	ok := false
+	for _, token := range tokens {
+		if token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// requireAdminToken rejects requests that don't carry the given token as a
+// bearer token. Admin routes are disabled altogether if the token is empty.
+func requireAdminToken(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if token == "" {
+				return echo.NewHTTPError(http.StatusNotFound, "admin routes are disabled")
+			}
+			if !hasToken(c, token) {
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid admin token")
+			}
+			return next(c)
+		}
+	}
+}
+
+// requireReadToken rejects requests to routes other than openRoutes that
+// don't carry the read token or the admin token as a bearer token. It lets
+// every request through if the read token is empty.
+func requireReadToken(readToken, adminToken string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if readToken == "" || openRoutes[c.Path()] {
+				return next(c)
+			}
+			if !hasToken(c, readToken, adminToken) {
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid read token")
+			}
+			return next(c)
+		}
+	}
+}
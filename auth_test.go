@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuth(t *testing.T) {
+	newServer := func(readToken, adminToken string) *echo.Echo {
+		e := echo.New()
+		e.Use(requireReadToken(readToken, adminToken))
+		ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+		e.GET("/healthz", ok)
+		e.GET("/:network/:slot", ok)
+		e.POST("/:network/gc", ok, requireAdminToken(adminToken))
+		return e
+	}
+	status := func(e *echo.Echo, method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Without tokens, reads are open and admin routes are disabled.
+	e := newServer("", "")
+	require.Equal(t, http.StatusOK, status(e, http.MethodGet, "/mainnet/1", ""))
+	require.Equal(t, http.StatusNotFound, status(e, http.MethodPost, "/mainnet/gc", ""))
+
+	// Admin routes require the admin token.
+	e = newServer("", "admin")
+	require.Equal(t, http.StatusOK, status(e, http.MethodGet, "/mainnet/1", ""))
+	require.Equal(t, http.StatusUnauthorized, status(e, http.MethodPost, "/mainnet/gc", ""))
+	require.Equal(t, http.StatusUnauthorized, status(e, http.MethodPost, "/mainnet/gc", "wrong"))
+	require.Equal(t, http.StatusOK, status(e, http.MethodPost, "/mainnet/gc", "admin"))
+
+	// With a read token, reads require it or the admin token, except for the
+	// probes, and admin routes still require the admin token.
+	e = newServer("read", "admin")
+	require.Equal(t, http.StatusOK, status(e, http.MethodGet, "/healthz", ""))
+	require.Equal(t, http.StatusUnauthorized, status(e, http.MethodGet, "/mainnet/1", ""))
+	require.Equal(t, http.StatusUnauthorized, status(e, http.MethodGet, "/mainnet/1", "wrong"))
+	require.Equal(t, http.StatusOK, status(e, http.MethodGet, "/mainnet/1", "read"))
+	require.Equal(t, http.StatusOK, status(e, http.MethodGet, "/mainnet/1", "admin"))
+	require.Equal(t, http.StatusUnauthorized, status(e, http.MethodPost, "/mainnet/gc", "read"))
+	require.Equal(t, http.StatusOK, status(e, http.MethodPost, "/mainnet/gc", "admin"))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+)
+
+// How many pending writes Badger may buffer while restoring a backup.
+const restoreMaxPendingWrites = 256
+
+// Backup writes a full backup of the store, covering every key prefix.
+// It's safe to call while the store is being written to.
+func (s *Store) Backup(w io.Writer) error {
+	_, err := s.db.Backup(w, 0)
+	return err
+}
+
+// Restore loads a backup written by Backup into the store, which must be empty.
+func (s *Store) Restore(r io.Reader) error {
+	empty := true
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		it.Rewind()
+		empty = !it.Valid()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !empty {
+		return errors.New("store is not empty")
+	}
+	return s.db.Load(r, restoreMaxPendingWrites)
+}
+
+// backupHandler streams a backup of the network's store.
+func backupHandler(c echo.Context) error {
+	network := c.Param("network")
+	store, err := getStore(network)
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMEOctetStream)
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", network+".backup"))
+	c.Response().WriteHeader(http.StatusOK)
+	if err := store.Backup(c.Response().Writer); err != nil {
+		// Too late to report an error status, so just cut the response short.
+		componentLogger("api", network).Error().Err(err).Msg("backup failed")
+	}
+	return nil
+}
+
+// runRestore restores a backup file into the fresh store of a network.
+// Usage: restore <network> <backup-file>
+func runRestore(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: restore <network> <backup-file>")
+	}
+	network, path := args[0], args[1]
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to open backup file")
+	}
+	defer f.Close()
+
+	store, err := OpenStore(*dataDir, network)
+	if err != nil {
+		return errors.Wrap(err, "failed to open store")
+	}
+	defer store.Close()
+	if err := store.Restore(f); err != nil {
+		return errors.Wrap(err, "failed to restore backup")
+	}
+	componentLogger("backup", network).Info().Str("path", path).Msg("restored backup")
+	return nil
+}
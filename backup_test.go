@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupRestore(t *testing.T) {
+	store := newTestStore(t)
+
+	hash := phase0.Hash32{1}
+	require.NoError(t, store.SetBlock(1, testBlock(1)))
+	require.NoError(t, store.SetBlock(2, nil))
+	require.NoError(t, store.SetBlock(3, testBellatrixBlock(3, hash)))
+	require.NoError(t, store.SetSpec(&NetworkSpec{SecondsPerSlot: 12, SlotsPerEpoch: 32}))
+	_, err := store.Invalidate(3, 3)
+	require.NoError(t, err)
+
+	var backup bytes.Buffer
+	require.NoError(t, store.Backup(&backup))
+
+	restored := newTestStore(t)
+	require.NoError(t, restored.Restore(bytes.NewReader(backup.Bytes())))
+
+	// Restoring over existing data is refused.
+	require.Error(t, restored.Restore(bytes.NewReader(backup.Bytes())))
+
+	empty, unscraped, err := restored.MissingSlots(1, 3)
+	require.NoError(t, err)
+	require.Equal(t, []phase0.Slot{2}, empty)
+	require.Empty(t, unscraped)
+
+	block, err := restored.Block(1)
+	require.NoError(t, err)
+	require.Equal(t, phase0.Slot(1), block.Phase0.Message.Slot)
+
+	slot, _, err := restored.BlockByExecutionHash(hash[:])
+	require.NoError(t, err)
+	require.Equal(t, phase0.Slot(3), slot)
+
+	filled, err := restored.Filled(3)
+	require.NoError(t, err)
+	require.False(t, filled)
+
+	networkSpec, err := restored.Spec()
+	require.NoError(t, err)
+	require.Equal(t, uint64(12), networkSpec.SecondsPerSlot)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// The state of each slot is also kept in bitmaps of bitmapSlots slots each,
+// under keyBitmap||bucket, so that gaps can be found without reading every
+// slot's record. Bitmaps are updated along with the slots' records, and
+// rebuilt from them when absent (such as in stores written before bitmaps).
+// A bucket with no scraped slots has no bitmap.
+
+// How many slots each bitmap covers, at 2 bits per slot.
+const bitmapSlots = 32
+
+// slotState is the state of a slot in a bitmap.
+type slotState uint64
+
+const (
+	slotUnscraped slotState = iota
+	slotEmpty
+	slotBlock
+)
+
+// slotBitmap holds the states of the slots of a bucket.
+type slotBitmap uint64
+
+func (b slotBitmap) state(slot phase0.Slot) slotState {
+	return slotState(b>>(2*(slot%bitmapSlots))) & 3
+}
+
+func (b *slotBitmap) set(slot phase0.Slot, state slotState) {
+	shift := 2 * (slot % bitmapSlots)
+	*b = *b&^(3<<shift) | slotBitmap(state)<<shift
+}
+
+func bitmapKey(bucket uint64) []byte {
+	return slotKey(keyBitmap, phase0.Slot(bucket))
+}
+
+// stateOf returns the state of a slot with the given stored value.
+func stateOf(val []byte) slotState {
+	// Corrupt records (see Verify) count as blocks, being neither missing
+	// nor known to be empty.
+	if len(val) < 8 {
+		return slotBlock
+	}
+	if _, _, ok := readHeader(val); ok {
+		return slotBlock
+	}
+	return slotEmpty
+}
+
+// readBitmap reads the bitmap of the bucket, rebuilding it from the slots'
+// records if it's absent. rebuilt is set if it was absent but had slots.
+func readBitmap(txn *badger.Txn, bucket uint64) (bitmap slotBitmap, rebuilt bool, err error) {
+	item, err := txn.Get(bitmapKey(bucket))
+	if err == nil {
+		err = item.Value(func(val []byte) error {
+			bitmap = slotBitmap(binary.BigEndian.Uint64(val))
+			return nil
+		})
+		return bitmap, false, err
+	}
+	if err != badger.ErrKeyNotFound {
+		return 0, false, err
+	}
+
+	from := phase0.Slot(bucket * bitmapSlots)
+	it := txn.NewIterator(badger.IteratorOptions{Prefix: keySlot})
+	defer it.Close()
+	for it.Seek(slotKey(keySlot, from)); it.Valid(); it.Next() {
+		item := it.Item()
+		slot := phase0.Slot(binary.BigEndian.Uint64(item.Key()[len(keySlot):]))
+		if slot >= from+bitmapSlots {
+			break
+		}
+		err := item.Value(func(val []byte) error {
+			bitmap.set(slot, stateOf(val))
+			return nil
+		})
+		if err != nil {
+			return 0, false, err
+		}
+		rebuilt = true
+	}
+	return bitmap, rebuilt, nil
+}
+
+// bitmapWriter collects the changes to bitmaps within a write, and writes
+// them at the end. Writes which change slots' records must hold bitmapMu
+// from before reading the bitmaps until they're written.
+//
+// With expiry, bitmaps expire along with the first slot of their bucket, and
+// are then rebuilt from the records which remain, such as pinned ones.
+type bitmapWriter struct {
+	txn     *badger.Txn
+	expiry  *slotExpiry
+	bitmaps map[uint64]slotBitmap
+}
+
+func newBitmapWriter(txn *badger.Txn, expiry *slotExpiry) *bitmapWriter {
+	return &bitmapWriter{txn: txn, expiry: expiry, bitmaps: make(map[uint64]slotBitmap)}
+}
+
+// set sets the slot's state.
+func (w *bitmapWriter) set(slot phase0.Slot, state slotState) error {
+	bucket := uint64(slot / bitmapSlots)
+	bitmap, ok := w.bitmaps[bucket]
+	if !ok {
+		var err error
+		bitmap, _, err = readBitmap(w.txn, bucket)
+		if err != nil {
+			return err
+		}
+	}
+	bitmap.set(slot, state)
+	w.bitmaps[bucket] = bitmap
+	return nil
+}
+
+// write writes the changed bitmaps, deleting those with no scraped slots.
+func (w *bitmapWriter) write(writer entryWriter) error {
+	for bucket, bitmap := range w.bitmaps {
+		if bitmap == 0 {
+			if err := writer.Delete(bitmapKey(bucket)); err != nil {
+				return err
+			}
+			continue
+		}
+		var expiresAt uint64
+		if w.expiry != nil {
+			expiresAt = w.expiry.at(phase0.Slot(bucket * bitmapSlots))
+			if expiresAt <= uint64(time.Now().Unix()) {
+				// It'd be rebuilt anyway.
+				continue
+			}
+		}
+		var val [8]byte
+		binary.BigEndian.PutUint64(val[:], uint64(bitmap))
+		if err := withExpiry(writer, expiresAt).Set(bitmapKey(bucket), val[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SlotStates returns the states of the slots within the given range
+// (inclusive), as recorded in the bitmaps. Absent bitmaps are rebuilt and
+// stored along the way.
+func (s *Store) SlotStates(from, to phase0.Slot) ([]slotState, error) {
+	states := make([]slotState, 0, to-from+1)
+	var rebuilt []uint64
+	err := s.db.View(func(txn *badger.Txn) error {
+		for bucket := uint64(from / bitmapSlots); bucket <= uint64(to/bitmapSlots); bucket++ {
+			bitmap, wasRebuilt, err := readBitmap(txn, bucket)
+			if err != nil {
+				return err
+			}
+			if wasRebuilt {
+				rebuilt = append(rebuilt, bucket)
+			}
+			first, last := phase0.Slot(bucket*bitmapSlots), phase0.Slot(bucket*bitmapSlots+bitmapSlots-1)
+			if first < from {
+				first = from
+			}
+			if last > to {
+				last = to
+			}
+			for slot := first; slot <= last; slot++ {
+				states = append(states, bitmap.state(slot))
+			}
+		}
+		return nil
+	})
+	if err != nil || len(rebuilt) == 0 {
+		return states, err
+	}
+	return states, s.storeBitmaps(rebuilt)
+}
+
+// CountUnscraped returns how many of the slots in the range (inclusive)
+// haven't been scraped. It only reads the bitmaps, so it's cheap over long
+// ranges, but counts the slots of buckets without one (which only stores
+// written before bitmaps have, until they're read) as unscraped, and
+// invalidated slots as scraped.
+func (s *Store) CountUnscraped(from, to phase0.Slot) (int, error) {
+	if to < from {
+		return 0, nil
+	}
+	scraped := 0
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: keyBitmap})
+		defer it.Close()
+		for it.Seek(bitmapKey(uint64(from / bitmapSlots))); it.Valid(); it.Next() {
+			bucket := binary.BigEndian.Uint64(it.Item().Key()[len(keyBitmap):])
+			if bucket > uint64(to/bitmapSlots) {
+				break
+			}
+			err := it.Item().Value(func(val []byte) error {
+				bitmap := slotBitmap(binary.BigEndian.Uint64(val))
+				first, last := phase0.Slot(bucket*bitmapSlots), phase0.Slot(bucket*bitmapSlots+bitmapSlots-1)
+				if first < from {
+					first = from
+				}
+				if last > to {
+					last = to
+				}
+				for slot := first; slot <= last; slot++ {
+					if bitmap.state(slot) != slotUnscraped {
+						scraped++
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return int(to-from+1) - scraped, err
+}
+
+// storeBitmaps stores the bitmaps of the given buckets, rebuilding them
+// again in case their slots were written since they were read.
+func (s *Store) storeBitmaps(buckets []uint64) error {
+	s.bitmapMu.Lock()
+	defer s.bitmapMu.Unlock()
+	return s.db.Update(func(txn *badger.Txn) error {
+		w := newBitmapWriter(txn, s.slotExpiry())
+		for _, bucket := range buckets {
+			bitmap, rebuilt, err := readBitmap(txn, bucket)
+			if err != nil {
+				return err
+			}
+			if rebuilt {
+				w.bitmaps[bucket] = bitmap
+			}
+		}
+		return w.write(txn)
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlotBitmap(t *testing.T) {
+	var bitmap slotBitmap
+	bitmap.set(0, slotBlock)
+	bitmap.set(31, slotEmpty)
+	bitmap.set(33, slotBlock) // Bucket 1's second slot.
+	require.Equal(t, slotBlock, bitmap.state(0))
+	require.Equal(t, slotBlock, bitmap.state(1))
+	require.Equal(t, slotEmpty, bitmap.state(31))
+	require.Equal(t, slotUnscraped, bitmap.state(2))
+
+	bitmap.set(31, slotUnscraped)
+	require.Equal(t, slotUnscraped, bitmap.state(31))
+	require.Equal(t, slotBlock, bitmap.state(0))
+}
+
+func TestSlotStates(t *testing.T) {
+	store := newTestStore(t)
+
+	// Fill slots around the boundary of the first two buckets.
+	require.NoError(t, store.SetBlock(30, testBlock(30)))
+	require.NoError(t, store.SetBlock(31, nil))
+	require.NoError(t, store.SetBlocks(map[phase0.Slot]*BlockWithRoot{
+		32: nil,
+		33: testBlock(33),
+	}))
+
+	states, err := store.SlotStates(29, 34)
+	require.NoError(t, err)
+	require.Equal(t, []slotState{slotUnscraped, slotBlock, slotEmpty, slotEmpty, slotBlock, slotUnscraped}, states)
+
+	// Overwriting a slot updates its state.
+	require.NoError(t, store.SetBlock(31, testBlock(31)))
+	states, err = store.SlotStates(31, 31)
+	require.NoError(t, err)
+	require.Equal(t, []slotState{slotBlock}, states)
+
+	// Purging a bucket's slots deletes its bitmap.
+	deleted, err := store.Purge(30, 31)
+	require.NoError(t, err)
+	require.Equal(t, 2, deleted)
+	err = store.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(bitmapKey(0))
+		return err
+	})
+	require.ErrorIs(t, err, badger.ErrKeyNotFound)
+	states, err = store.SlotStates(30, 33)
+	require.NoError(t, err)
+	require.Equal(t, []slotState{slotUnscraped, slotUnscraped, slotEmpty, slotBlock}, states)
+}
+
+func TestSlotStatesRebuild(t *testing.T) {
+	store := newTestStore(t)
+	require.NoError(t, store.SetBlock(1, testBlock(1)))
+	require.NoError(t, store.SetBlock(2, nil))
+	require.NoError(t, store.SetBlock(40, nil))
+
+	// Delete the bitmaps, as in a store written before them.
+	err := store.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Delete(bitmapKey(0)); err != nil {
+			return err
+		}
+		return txn.Delete(bitmapKey(1))
+	})
+	require.NoError(t, err)
+
+	empty, unscraped, err := store.MissingSlots(0, 40)
+	require.NoError(t, err)
+	require.Equal(t, []phase0.Slot{2, 40}, empty)
+	require.Len(t, unscraped, 38)
+
+	// The rebuilt bitmaps are stored.
+	err = store.db.View(func(txn *badger.Txn) error {
+		bitmap, rebuilt, err := readBitmap(txn, 0)
+		require.False(t, rebuilt)
+		require.Equal(t, slotBlock, bitmap.state(1))
+		require.Equal(t, slotEmpty, bitmap.state(2))
+		return err
+	})
+	require.NoError(t, err)
+}
+
+func TestCountUnscraped(t *testing.T) {
+	store := newTestStore(t)
+	require.NoError(t, store.SetBlocks(map[phase0.Slot]*BlockWithRoot{
+		30: testBlock(30),
+		31: nil,
+		32: nil,
+		70: testBlock(70),
+	}))
+
+	for _, c := range []struct {
+		from, to phase0.Slot
+		want     int
+	}{
+		{0, 100, 97},
+		{30, 32, 0},
+		{31, 69, 37},
+		{33, 69, 37},
+		{70, 70, 0},
+		{71, 1000, 930},
+		{5, 4, 0},
+	} {
+		count, err := store.CountUnscraped(c.from, c.to)
+		require.NoError(t, err)
+		require.Equal(t, c.want, count, "%d-%d", c.from, c.to)
+	}
+}
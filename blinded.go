@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	apiv1bellatrix "github.com/attestantio/go-eth2-client/api/v1/bellatrix"
+	apiv1capella "github.com/attestantio/go-eth2-client/api/v1/capella"
+	apiv1deneb "github.com/attestantio/go-eth2-client/api/v1/deneb"
+	apiv1electra "github.com/attestantio/go-eth2-client/api/v1/electra"
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/bellatrix"
+	"github.com/attestantio/go-eth2-client/spec/capella"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/electra"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+)
+
+// Some nodes (such as Prysm, when the execution client pruned or missed the
+// payload) serve a block's blinded block when they can't serve its execution
+// payload. With blinded_fallback, such a block is reconstructed from its
+// blinded block, with its execution payload header's fields but without its
+// transactions (nor, from Capella, its withdrawals), and stored marked as
+// blinded in its record's header (see recordBlinded). Its root is the blinded
+// block's, which is the same as the full block's, but its SSZ doesn't hash to
+// it. Blinded blocks are served with the X-Blinded header.
+
+const headerBlinded = "X-Blinded"
+
+// setBlindedHeader sets the X-Blinded header of a blinded block's response.
+func setBlindedHeader(c echo.Context, blinded bool) {
+	if blinded {
+		c.Response().Header().Set(headerBlinded, "true")
+	}
+}
+
+// fetchBlindedBlock fetches the blinded block at the slot from the network's
+// node, retrying as fetchBlock does, and reconstructs what it can of the block.
+// Returns nil if the slot has none.
+func fetchBlindedBlock(ctx context.Context, network NetworkConfig, slot phase0.Slot) (*BlockWithRoot, error) {
+	var (
+		version spec.DataVersion
+		data    []byte
+	)
+	err := fetchWithRetries(ctx, network.Name, slot, func(ctx context.Context) (err error) {
+		version, data, err = getBlindedBlock(ctx, network.NodeURL, slot)
+		return err
+	})
+	if err != nil || data == nil {
+		return nil, err
+	}
+	block, root, err := unblindBlock(version, data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to unblind block %d", slot)
+	}
+	componentLogger("scraper", network.Name).Debug().Uint64("slot", uint64(slot)).Msg("fell back to blinded block")
+	return &BlockWithRoot{
+		BlockRoot:                  root,
+		VersionedSignedBeaconBlock: block,
+		Blinded:                    true,
+	}, nil
+}
+
+// getBlindedBlock requests the blinded block at the slot from the node, and
+// returns its fork and its JSON. Returns nil if the slot has none.
+func getBlindedBlock(ctx context.Context, nodeURL string, slot phase0.Slot) (spec.DataVersion, []byte, error) {
+	u := fmt.Sprintf("%s/eth/v1/beacon/blinded_blocks/%d", strings.TrimSuffix(nodeURL, "/"), slot)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, nil, fmt.Errorf("blinded block request failed with status %d", resp.StatusCode)
+	}
+	var body struct {
+		Version string          `json:"version"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, nil, errors.Wrap(err, "failed to decode blinded block")
+	}
+	// Nodes from before Capella may not say, when it can only be Bellatrix.
+	version := spec.DataVersionBellatrix
+	if body.Version != "" {
+		if err := version.UnmarshalJSON([]byte(strconv.Quote(body.Version))); err != nil {
+			return 0, nil, fmt.Errorf("unsupported blinded block version %q", body.Version)
+		}
+	}
+	if len(body.Data) == 0 || string(body.Data) == "null" {
+		return 0, nil, errors.New("blinded block response has no data")
+	}
+	return version, body.Data, nil
+}
+
+// errIncompleteBlinded is returned by unblindBlock for a blinded block which
+// is missing its message, body or execution payload header.
+var errIncompleteBlinded = errors.New("blinded block is incomplete")
+
+// unblindBlock decodes the JSON of a blinded block of the given fork, and
+// returns its block, with the execution payload header's fields as its
+// payload, along with its root.
+func unblindBlock(version spec.DataVersion, data []byte) (*spec.VersionedSignedBeaconBlock, phase0.Root, error) {
+	switch version {
+	case spec.DataVersionBellatrix:
+		var blinded apiv1bellatrix.SignedBlindedBeaconBlock
+		if err := json.Unmarshal(data, &blinded); err != nil {
+			return nil, phase0.Root{}, err
+		}
+		if blinded.Message == nil || blinded.Message.Body == nil || blinded.Message.Body.ExecutionPayloadHeader == nil {
+			return nil, phase0.Root{}, errIncompleteBlinded
+		}
+		root, err := blinded.Message.HashTreeRoot()
+		return unblindBellatrix(&blinded), root, err
+	case spec.DataVersionCapella:
+		var blinded apiv1capella.SignedBlindedBeaconBlock
+		if err := json.Unmarshal(data, &blinded); err != nil {
+			return nil, phase0.Root{}, err
+		}
+		if blinded.Message == nil || blinded.Message.Body == nil || blinded.Message.Body.ExecutionPayloadHeader == nil {
+			return nil, phase0.Root{}, errIncompleteBlinded
+		}
+		root, err := blinded.Message.HashTreeRoot()
+		return unblindCapella(&blinded), root, err
+	case spec.DataVersionDeneb:
+		var blinded apiv1deneb.SignedBlindedBeaconBlock
+		if err := json.Unmarshal(data, &blinded); err != nil {
+			return nil, phase0.Root{}, err
+		}
+		if blinded.Message == nil || blinded.Message.Body == nil || blinded.Message.Body.ExecutionPayloadHeader == nil {
+			return nil, phase0.Root{}, errIncompleteBlinded
+		}
+		root, err := blinded.Message.HashTreeRoot()
+		return unblindDeneb(&blinded), root, err
+	case spec.DataVersionElectra:
+		var blinded apiv1electra.SignedBlindedBeaconBlock
+		if err := json.Unmarshal(data, &blinded); err != nil {
+			return nil, phase0.Root{}, err
+		}
+		if blinded.Message == nil || blinded.Message.Body == nil || blinded.Message.Body.ExecutionPayloadHeader == nil {
+			return nil, phase0.Root{}, errIncompleteBlinded
+		}
+		root, err := blinded.Message.HashTreeRoot()
+		return unblindElectra(&blinded), root, err
+	}
+	return nil, phase0.Root{}, unsupportedForkError(version)
+}
+
+// unblindBellatrix returns the block of a Bellatrix blinded block, with no
+// transactions.
+func unblindBellatrix(blinded *apiv1bellatrix.SignedBlindedBeaconBlock) *spec.VersionedSignedBeaconBlock {
+	message, body := blinded.Message, blinded.Message.Body
+	header := body.ExecutionPayloadHeader
+	return &spec.VersionedSignedBeaconBlock{
+		Version: spec.DataVersionBellatrix,
+		Bellatrix: &bellatrix.SignedBeaconBlock{
+			Message: &bellatrix.BeaconBlock{
+				Slot:          message.Slot,
+				ProposerIndex: message.ProposerIndex,
+				ParentRoot:    message.ParentRoot,
+				StateRoot:     message.StateRoot,
+				Body: &bellatrix.BeaconBlockBody{
+					RANDAOReveal:      body.RANDAOReveal,
+					ETH1Data:          body.ETH1Data,
+					Graffiti:          body.Graffiti,
+					ProposerSlashings: body.ProposerSlashings,
+					AttesterSlashings: body.AttesterSlashings,
+					Attestations:      body.Attestations,
+					Deposits:          body.Deposits,
+					VoluntaryExits:    body.VoluntaryExits,
+					SyncAggregate:     body.SyncAggregate,
+					ExecutionPayload: &bellatrix.ExecutionPayload{
+						ParentHash:    header.ParentHash,
+						FeeRecipient:  header.FeeRecipient,
+						StateRoot:     header.StateRoot,
+						ReceiptsRoot:  header.ReceiptsRoot,
+						LogsBloom:     header.LogsBloom,
+						PrevRandao:    header.PrevRandao,
+						BlockNumber:   header.BlockNumber,
+						GasLimit:      header.GasLimit,
+						GasUsed:       header.GasUsed,
+						Timestamp:     header.Timestamp,
+						ExtraData:     header.ExtraData,
+						BaseFeePerGas: header.BaseFeePerGas,
+						BlockHash:     header.BlockHash,
+						Transactions:  []bellatrix.Transaction{},
+					},
+				},
+			},
+			Signature: blinded.Signature,
+		},
+	}
+}
+
+// unblindCapella returns the block of a Capella blinded block, with no
+// transactions nor withdrawals.
+func unblindCapella(blinded *apiv1capella.SignedBlindedBeaconBlock) *spec.VersionedSignedBeaconBlock {
+	message, body := blinded.Message, blinded.Message.Body
+	header := body.ExecutionPayloadHeader
+	return &spec.VersionedSignedBeaconBlock{
+		Version: spec.DataVersionCapella,
+		Capella: &capella.SignedBeaconBlock{
+			Message: &capella.BeaconBlock{
+				Slot:          message.Slot,
+				ProposerIndex: message.ProposerIndex,
+				ParentRoot:    message.ParentRoot,
+				StateRoot:     message.StateRoot,
+				Body: &capella.BeaconBlockBody{
+					RANDAOReveal:          body.RANDAOReveal,
+					ETH1Data:              body.ETH1Data,
+					Graffiti:              body.Graffiti,
+					ProposerSlashings:     body.ProposerSlashings,
+					AttesterSlashings:     body.AttesterSlashings,
+					Attestations:          body.Attestations,
+					Deposits:              body.Deposits,
+					VoluntaryExits:        body.VoluntaryExits,
+					SyncAggregate:         body.SyncAggregate,
+					BLSToExecutionChanges: body.BLSToExecutionChanges,
+					ExecutionPayload: &capella.ExecutionPayload{
+						ParentHash:    header.ParentHash,
+						FeeRecipient:  header.FeeRecipient,
+						StateRoot:     header.StateRoot,
+						ReceiptsRoot:  header.ReceiptsRoot,
+						LogsBloom:     header.LogsBloom,
+						PrevRandao:    header.PrevRandao,
+						BlockNumber:   header.BlockNumber,
+						GasLimit:      header.GasLimit,
+						GasUsed:       header.GasUsed,
+						Timestamp:     header.Timestamp,
+						ExtraData:     header.ExtraData,
+						BaseFeePerGas: header.BaseFeePerGas,
+						BlockHash:     header.BlockHash,
+						Transactions:  []bellatrix.Transaction{},
+						Withdrawals:   []*capella.Withdrawal{},
+					},
+				},
+			},
+			Signature: blinded.Signature,
+		},
+	}
+}
+
+// unblindDeneb returns the block of a Deneb blinded block, with no
+// transactions nor withdrawals.
+func unblindDeneb(blinded *apiv1deneb.SignedBlindedBeaconBlock) *spec.VersionedSignedBeaconBlock {
+	message, body := blinded.Message, blinded.Message.Body
+	return &spec.VersionedSignedBeaconBlock{
+		Version: spec.DataVersionDeneb,
+		Deneb: &deneb.SignedBeaconBlock{
+			Message: &deneb.BeaconBlock{
+				Slot:          message.Slot,
+				ProposerIndex: message.ProposerIndex,
+				ParentRoot:    message.ParentRoot,
+				StateRoot:     message.StateRoot,
+				Body: &deneb.BeaconBlockBody{
+					RANDAOReveal:          body.RANDAOReveal,
+					ETH1Data:              body.ETH1Data,
+					Graffiti:              body.Graffiti,
+					ProposerSlashings:     body.ProposerSlashings,
+					AttesterSlashings:     body.AttesterSlashings,
+					Attestations:          body.Attestations,
+					Deposits:              body.Deposits,
+					VoluntaryExits:        body.VoluntaryExits,
+					SyncAggregate:         body.SyncAggregate,
+					ExecutionPayload:      unblindDenebPayload(body.ExecutionPayloadHeader),
+					BLSToExecutionChanges: body.BLSToExecutionChanges,
+					BlobKZGCommitments:    body.BlobKZGCommitments,
+				},
+			},
+			Signature: blinded.Signature,
+		},
+	}
+}
+
+// unblindElectra returns the block of an Electra blinded block, with no
+// transactions nor withdrawals.
+func unblindElectra(blinded *apiv1electra.SignedBlindedBeaconBlock) *spec.VersionedSignedBeaconBlock {
+	message, body := blinded.Message, blinded.Message.Body
+	return &spec.VersionedSignedBeaconBlock{
+		Version: spec.DataVersionElectra,
+		Electra: &electra.SignedBeaconBlock{
+			Message: &electra.BeaconBlock{
+				Slot:          message.Slot,
+				ProposerIndex: message.ProposerIndex,
+				ParentRoot:    message.ParentRoot,
+				StateRoot:     message.StateRoot,
+				Body: &electra.BeaconBlockBody{
+					RANDAOReveal:          body.RANDAOReveal,
+					ETH1Data:              body.ETH1Data,
+					Graffiti:              body.Graffiti,
+					ProposerSlashings:     body.ProposerSlashings,
+					AttesterSlashings:     body.AttesterSlashings,
+					Attestations:          body.Attestations,
+					Deposits:              body.Deposits,
+					VoluntaryExits:        body.VoluntaryExits,
+					SyncAggregate:         body.SyncAggregate,
+					ExecutionPayload:      unblindDenebPayload(body.ExecutionPayloadHeader),
+					BLSToExecutionChanges: body.BLSToExecutionChanges,
+					BlobKZGCommitments:    body.BlobKZGCommitments,
+					ExecutionRequests:     body.ExecutionRequests,
+				},
+			},
+			Signature: blinded.Signature,
+		},
+	}
+}
+
+// unblindDenebPayload returns the execution payload of a Deneb execution
+// payload header, which Electra's blocks have too, with no transactions nor
+// withdrawals.
+func unblindDenebPayload(header *deneb.ExecutionPayloadHeader) *deneb.ExecutionPayload {
+	return &deneb.ExecutionPayload{
+		ParentHash:    header.ParentHash,
+		FeeRecipient:  header.FeeRecipient,
+		StateRoot:     header.StateRoot,
+		ReceiptsRoot:  header.ReceiptsRoot,
+		LogsBloom:     header.LogsBloom,
+		PrevRandao:    header.PrevRandao,
+		BlockNumber:   header.BlockNumber,
+		GasLimit:      header.GasLimit,
+		GasUsed:       header.GasUsed,
+		Timestamp:     header.Timestamp,
+		ExtraData:     header.ExtraData,
+		BaseFeePerGas: header.BaseFeePerGas,
+		BlockHash:     header.BlockHash,
+		Transactions:  []bellatrix.Transaction{},
+		Withdrawals:   []*capella.Withdrawal{},
+		BlobGasUsed:   header.BlobGasUsed,
+		ExcessBlobGas: header.ExcessBlobGas,
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/api"
+	apiv1bellatrix "github.com/attestantio/go-eth2-client/api/v1/bellatrix"
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/altair"
+	"github.com/attestantio/go-eth2-client/spec/bellatrix"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/require"
+)
+
+// payloadlessNode has blocks, but can't serve their execution payloads.
+type payloadlessNode struct{}
+
+func (n *payloadlessNode) Name() string    { return "payloadless" }
+func (n *payloadlessNode) Address() string { return "payloadless" }
+func (n *payloadlessNode) IsActive() bool  { return true }
+func (n *payloadlessNode) IsSynced() bool  { return true }
+
+func (n *payloadlessNode) SignedBeaconBlock(ctx context.Context, opts *api.SignedBeaconBlockOpts) (*api.Response[*spec.VersionedSignedBeaconBlock], error) {
+	return nil, &api.Error{
+		Method:     http.MethodGet,
+		Endpoint:   "/eth/v2/beacon/blocks/" + opts.Block,
+		StatusCode: http.StatusInternalServerError,
+		Data:       []byte(`{"message":"` + payloadUnavailableError + ` 0x00 does not match","code":500}`),
+	}
+}
+
+func testBlindedBlock(slot phase0.Slot, executionBlockHash phase0.Hash32) *apiv1bellatrix.SignedBlindedBeaconBlock {
+	return &apiv1bellatrix.SignedBlindedBeaconBlock{
+		Message: &apiv1bellatrix.BlindedBeaconBlock{
+			Slot: slot,
+			Body: &apiv1bellatrix.BlindedBeaconBlockBody{
+				ETH1Data:          &phase0.ETH1Data{BlockHash: make([]byte, 32)},
+				ProposerSlashings: []*phase0.ProposerSlashing{},
+				AttesterSlashings: []*phase0.AttesterSlashing{},
+				Attestations:      []*phase0.Attestation{},
+				Deposits:          []*phase0.Deposit{},
+				VoluntaryExits:    []*phase0.SignedVoluntaryExit{},
+				SyncAggregate: &altair.SyncAggregate{
+					SyncCommitteeBits: make([]byte, 64),
+				},
+				ExecutionPayloadHeader: &bellatrix.ExecutionPayloadHeader{
+					BlockNumber: 1234,
+					BlockHash:   executionBlockHash,
+				},
+			},
+		},
+	}
+}
+
+func TestFetchBlindedFallback(t *testing.T) {
+	blinded := testBlindedBlock(7, phase0.Hash32{7})
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/eth/v1/beacon/blinded_blocks/7" {
+			http.NotFound(w, r)
+			return
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+			"version": "bellatrix",
+			"data":    blinded,
+		}))
+	}))
+	t.Cleanup(node.Close)
+	ctx := context.Background()
+	network := NetworkConfig{Name: "blinded", NodeURL: node.URL}
+
+	// Without the fallback, the slot is taken as empty.
+	block, err := fetchBlockWithRoot(ctx, &payloadlessNode{}, network, 7)
+	require.NoError(t, err)
+	require.Nil(t, block)
+
+	network.BlindedFallback = true
+	block, err = fetchBlockWithRoot(ctx, &payloadlessNode{}, network, 7)
+	require.NoError(t, err)
+	require.True(t, block.Blinded)
+	root, err := blinded.Message.HashTreeRoot()
+	require.NoError(t, err)
+	require.Equal(t, phase0.Root(root), block.BlockRoot)
+	payload := block.Bellatrix.Message.Body.ExecutionPayload
+	require.Equal(t, uint64(1234), payload.BlockNumber)
+	require.Equal(t, phase0.Hash32{7}, payload.BlockHash)
+	require.Empty(t, payload.Transactions)
+
+	// Slots the node has no blinded block at either are empty.
+	block, err = fetchBlockWithRoot(ctx, &payloadlessNode{}, network, 8)
+	require.NoError(t, err)
+	require.Nil(t, block)
+}
+
+func TestStoreBlindedBlock(t *testing.T) {
+	store := newTestStore(t)
+	blinded := &BlockWithRoot{
+		BlockRoot:                  phase0.Root{1},
+		VersionedSignedBeaconBlock: unblindBellatrix(testBlindedBlock(7, phase0.Hash32{7})),
+		Blinded:                    true,
+	}
+	require.NoError(t, store.SetBlocks(map[phase0.Slot]*BlockWithRoot{
+		7: blinded,
+		8: testBellatrixBlock(8, phase0.Hash32{8}),
+	}))
+
+	block, err := store.Block(7)
+	require.NoError(t, err)
+	require.True(t, block.Blinded)
+	require.Equal(t, spec.DataVersionBellatrix, block.Version)
+	header, ok, err := store.BlockHeader(7)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.True(t, header.Blinded)
+	require.Equal(t, spec.DataVersionBellatrix, header.Version)
+	val, _, err := store.RawRecord(7)
+	require.NoError(t, err)
+	require.NoError(t, verifyRecord(7, val))
+	require.True(t, describeRecord(7, val, false, false).Blinded)
+
+	block, err = store.Block(8)
+	require.NoError(t, err)
+	require.False(t, block.Blinded)
+
+	// Refetching the full block clears the mark.
+	require.NoError(t, store.SetBlock(7, testBellatrixBlock(7, phase0.Hash32{7})))
+	block, err = store.Block(7)
+	require.NoError(t, err)
+	require.False(t, block.Blinded)
+}
+
+func TestUnblindBlock(t *testing.T) {
+	blinded := testBlindedBlock(7, phase0.Hash32{7})
+	data, err := json.Marshal(blinded)
+	require.NoError(t, err)
+	block, root, err := unblindBlock(spec.DataVersionBellatrix, data)
+	require.NoError(t, err)
+	want, err := blinded.Message.HashTreeRoot()
+	require.NoError(t, err)
+	require.Equal(t, phase0.Root(want), root)
+	require.Equal(t, phase0.Hash32{7}, block.Bellatrix.Message.Body.ExecutionPayload.BlockHash)
+
+	_, _, err = unblindBlock(spec.DataVersionPhase0, data)
+	require.Error(t, err)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/hex"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/labstack/echo"
+)
+
+// How many events a subscriber may fall behind before it's dropped.
+const subscriptionBuffer = 64
+
+// BlockEvent describes a slot which was just stored.
+type BlockEvent struct {
+	Slot          phase0.Slot            `json:"slot"`
+	Root          string                 `json:"root,omitempty"`
+	Version       string                 `json:"version,omitempty"`
+	ProposerIndex *phase0.ValidatorIndex `json:"proposer_index,omitempty"`
+	Empty         bool                   `json:"empty"`
+}
+
+// newBlockEvent returns the event of the given slot being stored.
+func newBlockEvent(slot phase0.Slot, block *BlockWithRoot) BlockEvent {
+	if block == nil {
+		return BlockEvent{Slot: slot, Empty: true}
+	}
+	event := BlockEvent{
+		Slot:    slot,
+		Root:    "0x" + hex.EncodeToString(block.BlockRoot[:]),
+		Version: strings.ToLower(block.Version.String()),
+	}
+	if fields, err := messageFields(block.VersionedSignedBeaconBlock); err == nil {
+		event.ProposerIndex = &fields.ProposerIndex
+	}
+	return event
+}
+
+// eventFilter selects which events a subscriber receives.
+type eventFilter struct {
+	nonEmpty bool
+
+	// Proposer index range (inclusive), if restricted.
+	proposers    bool
+	proposerFrom phase0.ValidatorIndex
+	proposerTo   phase0.ValidatorIndex
+}
+
+// parseEventFilter parses an eventFilter from the request's query params:
+// non-empty, and proposer-from and/or proposer-to (which imply non-empty).
+func parseEventFilter(c echo.Context) (filter eventFilter, err error) {
+	params := c.QueryParams()
+	filter.nonEmpty = params.Has("non-empty")
+	filter.proposerTo = math.MaxUint64
+	if params.Has("proposer-from") {
+		filter.proposers = true
+		from, err := strconv.ParseUint(params.Get("proposer-from"), 10, 64)
+		if err != nil {
+			return filter, echo.NewHTTPError(http.StatusBadRequest, "invalid proposer-from")
+		}
+		filter.proposerFrom = phase0.ValidatorIndex(from)
+	}
+	if params.Has("proposer-to") {
+		filter.proposers = true
+		to, err := strconv.ParseUint(params.Get("proposer-to"), 10, 64)
+		if err != nil {
+			return filter, echo.NewHTTPError(http.StatusBadRequest, "invalid proposer-to")
+		}
+		filter.proposerTo = phase0.ValidatorIndex(to)
+	}
+	return filter, nil
+}
+
+// matches returns whether the event passes the filter.
+func (f eventFilter) matches(event BlockEvent) bool {
+	if event.Empty {
+		return !f.nonEmpty && !f.proposers
+	}
+	if f.proposers {
+		return event.ProposerIndex != nil &&
+			*event.ProposerIndex >= f.proposerFrom && *event.ProposerIndex <= f.proposerTo
+	}
+	return true
+}
+
+// Broker fans out the events of a store to its subscribers.
+// A nil *Broker is valid and publishes nothing.
+type Broker struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscription receives events from a Broker on C. C is closed when the
+// subscriber is dropped for falling behind, or when it unsubscribes.
+type Subscription struct {
+	C <-chan BlockEvent
+	c chan BlockEvent
+}
+
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe returns a new subscription to the broker's events.
+func (b *Broker) Subscribe() *Subscription {
+	c := make(chan BlockEvent, subscriptionBuffer)
+	sub := &Subscription{C: c, c: c}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe stops the subscription, if it wasn't dropped already.
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.c)
+	}
+}
+
+// Publish sends the events in slot order to every subscriber, without
+// blocking. Subscribers whose buffer is full are dropped.
+func (b *Broker) Publish(events ...BlockEvent) {
+	if b == nil || len(events) == 0 {
+		return
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Slot < events[j].Slot
+	})
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		for _, event := range events {
+			select {
+			case sub.c <- event:
+				continue
+			default:
+			}
+			delete(b.subs, sub)
+			close(sub.c)
+			metricDroppedSubscribers.Inc()
+			break
+		}
+	}
+}
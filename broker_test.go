@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroker(t *testing.T) {
+	store := newTestStore(t)
+	store.broker = NewBroker()
+	sub := store.broker.Subscribe()
+
+	block := testBlock(1)
+	block.BlockRoot = phase0.Root{1}
+	require.NoError(t, store.SetBlock(1, block))
+	require.NoError(t, store.SetBlocks(map[phase0.Slot]*BlockWithRoot{
+		3: nil,
+		2: testBlock(2),
+	}))
+
+	proposer := block.Phase0.Message.ProposerIndex
+	require.Equal(t, BlockEvent{
+		Slot:          1,
+		Root:          "0x0100000000000000000000000000000000000000000000000000000000000000",
+		Version:       "phase0",
+		ProposerIndex: &proposer,
+	}, <-sub.C)
+	// Batches are published in slot order.
+	require.Equal(t, phase0.Slot(2), (<-sub.C).Slot)
+	require.Equal(t, BlockEvent{Slot: 3, Empty: true}, <-sub.C)
+
+	// Subscribers which fall behind are dropped.
+	slow := store.broker.Subscribe()
+	for slot := phase0.Slot(0); slot <= subscriptionBuffer; slot++ {
+		store.broker.Publish(BlockEvent{Slot: slot})
+		<-sub.C
+	}
+	for range slow.C {
+	}
+
+	store.broker.Unsubscribe(sub)
+	_, ok := <-sub.C
+	require.False(t, ok)
+
+	// Unsubscribing a dropped subscriber is harmless.
+	store.broker.Unsubscribe(slow)
+}
+
+func TestEventFilter(t *testing.T) {
+	proposer := func(index phase0.ValidatorIndex) *phase0.ValidatorIndex { return &index }
+	empty := BlockEvent{Slot: 1, Empty: true}
+	low := BlockEvent{Slot: 2, ProposerIndex: proposer(5)}
+	high := BlockEvent{Slot: 3, ProposerIndex: proposer(500)}
+
+	for _, test := range []struct {
+		query   string
+		matches []bool
+	}{
+		{"", []bool{true, true, true}},
+		{"non-empty", []bool{false, true, true}},
+		{"proposer-from=100", []bool{false, false, true}},
+		{"proposer-to=100", []bool{false, true, false}},
+		{"proposer-from=5&proposer-to=5", []bool{false, true, false}},
+	} {
+		c := echo.New().NewContext(httptest.NewRequest("GET", "/?"+test.query, nil), nil)
+		filter, err := parseEventFilter(c)
+		require.NoError(t, err, test.query)
+		for i, event := range []BlockEvent{empty, low, high} {
+			require.Equal(t, test.matches[i], filter.matches(event), "%s: slot %d", test.query, event.Slot)
+		}
+	}
+
+	c := echo.New().NewContext(httptest.NewRequest("GET", "/?proposer-from=x", nil), nil)
+	_, err := parseEventFilter(c)
+	require.Error(t, err)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+type slotCacheKey struct {
+	network string
+	slot    phase0.Slot
+}
+
+type slotCacheEntry[V any] struct {
+	key   slotCacheKey
+	value V
+}
+
+// SlotCache is an LRU cache of values by slot across networks.
+// A nil *SlotCache is valid and caches nothing.
+type SlotCache[V any] struct {
+	name    string
+	size    int
+	mu      sync.Mutex
+	entries map[slotCacheKey]*list.Element
+	order   *list.List
+}
+
+// BlockCache is a SlotCache of decoded blocks.
+type BlockCache = SlotCache[*BlockWithRoot]
+
+// NewSlotCache returns a cache holding up to size values, or nil if size is zero.
+// The name labels the cache's metrics.
+func NewSlotCache[V any](name string, size int) *SlotCache[V] {
+	if size <= 0 {
+		return nil
+	}
+	return &SlotCache[V]{
+		name:    name,
+		size:    size,
+		entries: make(map[slotCacheKey]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+// NewBlockCache returns a cache holding up to size blocks, or nil if size is zero.
+func NewBlockCache(size int) *BlockCache {
+	return NewSlotCache[*BlockWithRoot]("block", size)
+}
+
+// Get returns the cached value at the given slot, which is nil for empty slots.
+// Callers must not modify the returned value.
+func (c *SlotCache[V]) Get(network string, slot phase0.Slot) (value V, ok bool) {
+	if c == nil {
+		return value, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[slotCacheKey{network, slot}]
+	if !ok {
+		metricCacheRequests.WithLabelValues(c.name, "miss").Inc()
+		return value, false
+	}
+	metricCacheRequests.WithLabelValues(c.name, "hit").Inc()
+	c.order.MoveToFront(elem)
+	return elem.Value.(*slotCacheEntry[V]).value, true
+}
+
+// Add caches the value at the given slot, evicting the least recently used
+// value if the cache is full.
+func (c *SlotCache[V]) Add(network string, slot phase0.Slot, value V) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := slotCacheKey{network, slot}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*slotCacheEntry[V]).value = value
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&slotCacheEntry[V]{key, value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*slotCacheEntry[V]).key)
+	}
+}
+
+// Remove evicts the value at the given slot, if cached.
+func (c *SlotCache[V]) Remove(network string, slot phase0.Slot) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := slotCacheKey{network, slot}
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// RemoveNetwork evicts every value of the given network.
+func (c *SlotCache[V]) RemoveNetwork(network string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, elem := range c.entries {
+		if key.network == network {
+			c.order.Remove(elem)
+			delete(c.entries, key)
+		}
+	}
+}
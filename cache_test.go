@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockCache(t *testing.T) {
+	cache := NewBlockCache(2)
+	cache.Add("a", 1, testBlock(1))
+	cache.Add("b", 1, nil)
+
+	// Empty slots are cached as nil.
+	block, ok := cache.Get("b", 1)
+	require.True(t, ok)
+	require.Nil(t, block)
+
+	// Adding a third block evicts the least recently used one.
+	cache.Add("a", 2, testBlock(2))
+	_, ok = cache.Get("a", 1)
+	require.False(t, ok)
+	block, ok = cache.Get("a", 2)
+	require.True(t, ok)
+	require.NotNil(t, block)
+
+	cache.Remove("a", 2)
+	_, ok = cache.Get("a", 2)
+	require.False(t, ok)
+
+	// A nil cache caches nothing.
+	cache = NewBlockCache(0)
+	cache.Add("a", 1, testBlock(1))
+	_, ok = cache.Get("a", 1)
+	require.False(t, ok)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/binary"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// The scrape checkpoint, under keyCheckpoint, is the highest slot such that
+// every slot from the start of the scraped window up to it is filled. The
+// scraper advances it as gaps fill, and resumes after it when restarted.
+// Invalidating a slot at or before it lowers it to the slot before, and a
+// window which moved past it (such as after purging) starts it over.
+
+// Checkpoint returns the scrape checkpoint, or ok=false if there's none.
+func (s *Store) Checkpoint() (slot phase0.Slot, ok bool, err error) {
+	err = s.db.View(func(txn *badger.Txn) error {
+		slot, ok, err = readCheckpoint(txn)
+		return err
+	})
+	return
+}
+
+func readCheckpoint(txn *badger.Txn) (slot phase0.Slot, ok bool, err error) {
+	item, err := txn.Get(keyCheckpoint)
+	if err == badger.ErrKeyNotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	err = item.Value(func(val []byte) error {
+		slot = phase0.Slot(binary.BigEndian.Uint64(val))
+		return nil
+	})
+	return slot, err == nil, err
+}
+
+// AdvanceCheckpoint moves the checkpoint past the filled slots following it,
+// or starts it over from the given start of the window if it's before it.
+// Returns the checkpoint, or ok=false if the window's first slot isn't filled.
+func (s *Store) AdvanceCheckpoint(start phase0.Slot) (slot phase0.Slot, ok bool, err error) {
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+
+	checkpoint, ok, err := s.Checkpoint()
+	if err != nil {
+		return 0, false, err
+	}
+	from := start
+	if ok && checkpoint >= start {
+		from = checkpoint + 1
+	}
+	next, err := s.FirstUnfilledSlot(from)
+	if err != nil {
+		return 0, false, err
+	}
+	if next == from {
+		if from > start {
+			return checkpoint, true, nil
+		}
+		if ok {
+			// It's before the window, whose first slot isn't filled.
+			err = s.db.Update(func(txn *badger.Txn) error {
+				return txn.Delete(keyCheckpoint)
+			})
+		}
+		return 0, false, err
+	}
+	err = s.db.Update(func(txn *badger.Txn) error {
+		return setCheckpoint(txn, next-1)
+	})
+	return next - 1, err == nil, err
+}
+
+func setCheckpoint(txn *badger.Txn, slot phase0.Slot) error {
+	var val [8]byte
+	binary.BigEndian.PutUint64(val[:], uint64(slot))
+	return txn.Set(keyCheckpoint, val[:])
+}
+
+// lowerCheckpoint lowers the checkpoint to before the given slot, if it's at
+// or past it. The caller must hold checkpointMu.
+func lowerCheckpoint(txn *badger.Txn, slot phase0.Slot) error {
+	checkpoint, ok, err := readCheckpoint(txn)
+	if err != nil || !ok || checkpoint < slot {
+		return err
+	}
+	if slot == 0 {
+		return txn.Delete(keyCheckpoint)
+	}
+	return setCheckpoint(txn, slot-1)
+}
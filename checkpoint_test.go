@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpoint(t *testing.T) {
+	store := newTestStore(t)
+	advance := func(start phase0.Slot) (phase0.Slot, bool) {
+		slot, ok, err := store.AdvanceCheckpoint(start)
+		require.NoError(t, err)
+		checkpoint, stored, err := store.Checkpoint()
+		require.NoError(t, err)
+		require.Equal(t, ok, stored)
+		require.Equal(t, slot, checkpoint)
+		return slot, ok
+	}
+
+	// There's none until the window's first slot is filled.
+	require.NoError(t, store.SetBlocks(map[phase0.Slot]*BlockWithRoot{
+		11: nil,
+		12: testBlock(12),
+		14: nil,
+	}))
+	_, ok := advance(10)
+	require.False(t, ok)
+
+	// It stops at gaps, and moves past them as they fill.
+	require.NoError(t, store.SetBlock(10, testBlock(10)))
+	slot, ok := advance(10)
+	require.True(t, ok)
+	require.Equal(t, phase0.Slot(12), slot)
+	require.NoError(t, store.SetBlock(13, nil))
+	slot, _ = advance(10)
+	require.Equal(t, phase0.Slot(14), slot)
+
+	// Invalidating a slot at or before it lowers it, until it's set again.
+	_, err := store.Invalidate(12, 12)
+	require.NoError(t, err)
+	slot, _ = advance(10)
+	require.Equal(t, phase0.Slot(11), slot)
+	require.NoError(t, store.SetBlock(12, testBlock(12)))
+	slot, _ = advance(10)
+	require.Equal(t, phase0.Slot(14), slot)
+
+	// Invalidating slots after it leaves it alone.
+	require.NoError(t, store.SetBlock(15, nil))
+	_, err = store.Invalidate(16, 20)
+	require.NoError(t, err)
+	slot, _ = advance(10)
+	require.Equal(t, phase0.Slot(15), slot)
+
+	// A window which moved past it starts it over, or drops it if its first
+	// slot isn't filled.
+	require.NoError(t, store.SetBlocks(map[phase0.Slot]*BlockWithRoot{
+		20: nil,
+		21: nil,
+	}))
+	slot, _ = advance(20)
+	require.Equal(t, phase0.Slot(21), slot)
+	_, ok = advance(30)
+	require.False(t, ok)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec is the compression codec of a stored block. It's recorded in the top
+// byte of the record's version, so records written before codecs were
+// configurable (where that byte is always zero) read as snappy.
+type Codec byte
+
+const (
+	CodecSnappy Codec = iota
+	CodecZstd
+)
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// ParseCodec returns the codec of the given name.
+func ParseCodec(name string) (Codec, error) {
+	switch name {
+	case "snappy":
+		return CodecSnappy, nil
+	case "zstd":
+		return CodecZstd, nil
+	}
+	return 0, fmt.Errorf("unknown compression codec %q", name)
+}
+
+func (c Codec) String() string {
+	switch c {
+	case CodecSnappy:
+		return "snappy"
+	case CodecZstd:
+		return "zstd"
+	}
+	return fmt.Sprintf("Codec(%d)", byte(c))
+}
+
+// Encode compresses b.
+func (c Codec) Encode(b []byte) ([]byte, error) {
+	switch c {
+	case CodecSnappy:
+		return snappy.Encode(nil, b), nil
+	case CodecZstd:
+		return zstdEncoder.EncodeAll(b, nil), nil
+	}
+	return nil, fmt.Errorf("unknown compression codec %d", byte(c))
+}
+
+// Decode decompresses b.
+func (c Codec) Decode(b []byte) ([]byte, error) {
+	switch c {
+	case CodecSnappy:
+		return snappy.Decode(nil, b)
+	case CodecZstd:
+		return zstdDecoder.DecodeAll(b, nil)
+	}
+	return nil, fmt.Errorf("unknown compression codec %d", byte(c))
+}
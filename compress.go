@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/labstack/echo"
+)
+
+// uncompressedPaths are the routes whose responses aren't gzipped, since
+// they're streamed event by event or hijacked.
+var uncompressedPaths = map[string]bool{
+	"/:network/stream": true,
+	"/:network/ws":     true,
+}
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+// gzipMiddleware gzips responses of at least minSize bytes for clients which
+// accept it. Unlike echo's own, it leaves small responses as they are, and
+// handlers may write to the response however they like (including setting
+// headers after WriteHeader), since the headers are only sent once the size
+// is known.
+func gzipMiddleware(minSize int) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if uncompressedPaths[c.Path()] {
+				return next(c)
+			}
+			res := c.Response()
+			res.Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+			if !acceptsGzip(c.Request()) {
+				return next(c)
+			}
+			w := &gzipResponseWriter{ResponseWriter: res.Writer, minSize: minSize}
+			res.Writer = w
+			defer func() {
+				w.Close()
+				res.Writer = w.ResponseWriter
+			}()
+			return next(c)
+		}
+	}
+}
+
+// acceptsGzip returns whether the request's Accept-Encoding allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get(echo.HeaderAcceptEncoding), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		name = strings.TrimSpace(name)
+		if name != "gzip" && name != "*" {
+			continue
+		}
+		// Only an explicit q=0 refuses it.
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if q, err := strconv.ParseFloat(value, 64); key == "q" && err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter holds back the response until minSize bytes are written,
+// and then sends it gzipped. Responses which end sooner are sent as they are.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+
+	code int
+	buf  bytes.Buffer
+	gz   *gzip.Writer
+
+	// Whether the headers were sent, and so the encoding decided.
+	sent bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	if w.sent {
+		return w.ResponseWriter.Write(b)
+	}
+	w.buf.Write(b)
+	if w.buf.Len() >= w.minSize {
+		if err := w.startGzip(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// startGzip sends the headers for a gzipped response, followed by what's buffered.
+func (w *gzipResponseWriter) startGzip() error {
+	header := w.Header()
+	if header.Get(echo.HeaderContentType) == "" {
+		header.Set(echo.HeaderContentType, http.DetectContentType(w.buf.Bytes()))
+	}
+	header.Set(echo.HeaderContentEncoding, "gzip")
+	header.Del(echo.HeaderContentLength)
+	w.sendHeader()
+	w.gz = gzipWriters.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+	_, err := w.gz.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+// sendUncompressed sends the headers for an uncompressed response, followed
+// by what's buffered.
+func (w *gzipResponseWriter) sendUncompressed() error {
+	w.sendHeader()
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+func (w *gzipResponseWriter) sendHeader() {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+	w.sent = true
+}
+
+// Flush sends what's been written so far, deciding the encoding if it isn't yet.
+func (w *gzipResponseWriter) Flush() {
+	switch {
+	case w.gz != nil:
+		w.gz.Flush()
+	case !w.sent:
+		w.sendUncompressed()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close finishes the response. Nothing is sent if nothing was written, so
+// that an error handler may still respond.
+func (w *gzipResponseWriter) Close() error {
+	if w.gz != nil {
+		err := w.gz.Close()
+		gzipWriters.Put(w.gz)
+		w.gz = nil
+		return err
+	}
+	if !w.sent && (w.code != 0 || w.buf.Len() > 0) {
+		return w.sendUncompressed()
+	}
+	return nil
+}
+
+func (w *gzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGzipMiddleware(t *testing.T) {
+	large := map[string]string{"data": strings.Repeat("a", 2000)}
+	e := echo.New()
+	e.Use(gzipMiddleware(1024))
+	e.GET("/small", func(c echo.Context) error { return c.String(http.StatusOK, "small") })
+	e.GET("/large", func(c echo.Context) error { return writeJSON(c, large) })
+	e.GET("/error", func(c echo.Context) error { return echo.NewHTTPError(http.StatusNotFound, "not found") })
+
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(echo.HeaderAcceptEncoding, acceptEncoding)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/large", "br, gzip")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "gzip", rec.Header().Get(echo.HeaderContentEncoding))
+	require.Equal(t, echo.HeaderAcceptEncoding, rec.Header().Get(echo.HeaderVary))
+	require.Equal(t, echo.MIMEApplicationJSON, rec.Header().Get(echo.HeaderContentType))
+	require.Empty(t, rec.Header().Get(echo.HeaderContentLength))
+	r, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"data":"`+large["data"]+`"}`, string(body))
+
+	// Small responses, errors and clients which refuse gzip get plain responses.
+	rec = get("/small", "gzip")
+	require.Empty(t, rec.Header().Get(echo.HeaderContentEncoding))
+	require.Equal(t, "small", rec.Body.String())
+
+	rec = get("/error", "gzip")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Empty(t, rec.Header().Get(echo.HeaderContentEncoding))
+	require.Contains(t, rec.Body.String(), "not found")
+
+	for _, acceptEncoding := range []string{"", "br", "gzip;q=0", "*;q=0.0"} {
+		rec = get("/large", acceptEncoding)
+		require.Empty(t, rec.Header().Get(echo.HeaderContentEncoding), acceptEncoding)
+		require.JSONEq(t, `{"data":"`+large["data"]+`"}`, rec.Body.String())
+	}
+}
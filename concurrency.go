@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+// concurrencyLimiter limits how many expensive requests, such as those
+// decoding ranges of blocks, are served at once.
+type concurrencyLimiter struct {
+	slots chan struct{}
+}
+
+// newConcurrencyLimiter returns a limiter of up to max concurrent requests,
+// or nil (which doesn't limit) if max isn't positive.
+func newConcurrencyLimiter(max int) *concurrencyLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &concurrencyLimiter{slots: make(chan struct{}, max)}
+}
+
+// middleware responds with 503 Service Unavailable when the limit is reached,
+// rather than queueing the request.
+func (l *concurrencyLimiter) middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if l == nil {
+			return next(c)
+		}
+		select {
+		case l.slots <- struct{}{}:
+			defer func() { <-l.slots }()
+			return next(c)
+		default:
+			c.Response().Header().Set("Retry-After", "1")
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "too many concurrent expensive requests")
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	e := echo.New()
+	limiter := newConcurrencyLimiter(2)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	e.GET("/heavy", func(c echo.Context) error {
+		started <- struct{}{}
+		<-release
+		return c.NoContent(http.StatusOK)
+	}, limiter.middleware)
+
+	serve := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/heavy", nil))
+		return rec
+	}
+	done := make(chan int)
+	for i := 0; i < 2; i++ {
+		go func() { done <- serve().Code }()
+		<-started
+	}
+
+	// A third request is rejected while two are in flight.
+	rec := serve()
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	close(release)
+	require.Equal(t, http.StatusOK, <-done)
+	require.Equal(t, http.StatusOK, <-done)
+
+	// Once they're done, requests are served again.
+	go func() { <-started }()
+	require.Equal(t, http.StatusOK, serve().Code)
+
+	// A nil limiter doesn't limit.
+	var unlimited *concurrencyLimiter
+	handler := unlimited.middleware(func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	rec = httptest.NewRecorder()
+	require.NoError(t, handler(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)))
+	require.Equal(t, http.StatusOK, rec.Code)
+}
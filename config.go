@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/goccy/go-yaml"
+	"github.com/pkg/errors"
+)
+
+// Config describes the networks to scrape and serve.
+type Config struct {
+	Networks []NetworkConfig `json:"networks" yaml:"networks"`
+
+	// NotFoundErrors are substrings of node errors which mean that a slot has
+	// no block, in addition to the built-in ones.
+	NotFoundErrors []string `json:"not_found_errors,omitempty" yaml:"not_found_errors,omitempty"`
+}
+
+// NetworkConfig describes a single network and the node to scrape it from.
+type NetworkConfig struct {
+	Name    string `json:"name" yaml:"name"`
+	NodeURL string `json:"node_url" yaml:"node_url"`
+
+	// SecondsPerSlot overrides the node's SECONDS_PER_SLOT, if set.
+	SecondsPerSlot uint64 `json:"seconds_per_slot,omitempty" yaml:"seconds_per_slot,omitempty"`
+
+	// ScrapeSlots is how many slots behind head to start scraping from,
+	// and defaults to -retention or -scrape-slots, see defaultScrapeSlotsOf.
+	// It can be changed without deleting the database: see purgeOutdated.
+	ScrapeSlots uint64 `json:"scrape_slots,omitempty" yaml:"scrape_slots,omitempty"`
+
+	// ScrapeConcurrency is how many slots to fetch at once, and defaults
+	// to defaultScrapeConcurrency.
+	ScrapeConcurrency int `json:"scrape_concurrency,omitempty" yaml:"scrape_concurrency,omitempty"`
+
+	// RetentionSlots is how many slots behind head to keep before purging,
+	// and defaults to ScrapeSlots.
+	RetentionSlots uint64 `json:"retention_slots,omitempty" yaml:"retention_slots,omitempty"`
+
+	// ConfirmationDepth is how many slots behind head a slot must be before
+	// it's fetched, and defaults to defaultConfirmationDepth. Deeper is safer
+	// from reorgs, shallower is fresher.
+	ConfirmationDepth uint64 `json:"confirmation_depth,omitempty" yaml:"confirmation_depth,omitempty"`
+
+	// HeadEvents drives scraping of the chain tip from the node's head
+	// event stream, rather than from the slot clock and polling the node,
+	// still waiting for slots to fall ConfirmationDepth slots behind.
+	HeadEvents bool `json:"head_events,omitempty" yaml:"head_events,omitempty"`
+
+	// VerifyRoots cross-checks each block's computed root against the root
+	// reported by the node, at the cost of an extra request per block.
+	VerifyRoots bool `json:"verify_roots,omitempty" yaml:"verify_roots,omitempty"`
+
+	// BlindedFallback fetches a block's blinded block when the node can't
+	// serve its execution payload, rather than storing the slot as empty.
+	// See blinded.go.
+	BlindedFallback bool `json:"blinded_fallback,omitempty" yaml:"blinded_fallback,omitempty"`
+
+	// KeepOrphans keeps the blocks replaced at their slot (such as after a
+	// reorg), for forensics.
+	KeepOrphans bool `json:"keep_orphans,omitempty" yaml:"keep_orphans,omitempty"`
+
+	// RecordSizes records the SSZ and compressed sizes of the blocks written,
+	// for GET /:network/sizes. See sizes.go.
+	RecordSizes bool `json:"record_sizes,omitempty" yaml:"record_sizes,omitempty"`
+
+	// PruneEmpty stores no records for empty slots, which are then only
+	// recorded as empty in the slot bitmaps. See prune.go.
+	PruneEmpty bool `json:"prune_empty,omitempty" yaml:"prune_empty,omitempty"`
+
+	// ExpireByTTL writes slots with a TTL which expires them as they fall out
+	// of the retention window, instead of purging them hourly. See expiry.go.
+	ExpireByTTL bool `json:"expire_by_ttl,omitempty" yaml:"expire_by_ttl,omitempty"`
+
+	// Host is a hostname whose requests are routed to the network without
+	// the /:network prefix, as well as with it. See vhost.go.
+	Host string `json:"host,omitempty" yaml:"host,omitempty"`
+}
+
+// SlotDuration returns the network's slot duration, preferring SecondsPerSlot
+// over the node's spec.
+func (n NetworkConfig) SlotDuration(networkSpec *NetworkSpec) time.Duration {
+	if n.SecondsPerSlot != 0 {
+		return time.Duration(n.SecondsPerSlot) * time.Second
+	}
+	return networkSpec.SlotDuration()
+}
+
+// deprecatedNetworks are networks which are still accepted, but have been
+// shut down or are about to be, with the reason to warn about.
+var deprecatedNetworks = map[string]string{
+	"prater": "prater (goerli) is deprecated, use holesky or sepolia instead",
+}
+
+// defaultConfig returns a Config built from the default targets.
+func defaultConfig() *Config {
+	var config Config
+	for network, nodeURL := range targets {
+		config.Networks = append(config.Networks, NetworkConfig{
+			Name:    network,
+			NodeURL: nodeURL,
+		})
+	}
+	sort.Slice(config.Networks, func(i, j int) bool {
+		return config.Networks[i].Name < config.Networks[j].Name
+	})
+	return &config
+}
+
+// LoadConfig reads a JSON or YAML config file (decided by its extension),
+// or returns the default config if path is empty, with the networks set by
+// the environment applied over it (see env.go).
+func LoadConfig(path string) (*Config, error) {
+	config := defaultConfig()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read config file")
+		}
+		config = &Config{}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json":
+			err = json.Unmarshal(data, config)
+		case ".yaml", ".yml":
+			err = yaml.Unmarshal(data, config)
+		default:
+			return nil, fmt.Errorf("unsupported config file extension %q", filepath.Ext(path))
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse config file")
+		}
+	}
+	if err := applyEnvNetworks(config); err != nil {
+		return nil, errors.Wrap(err, "invalid environment")
+	}
+
+	for i := range config.Networks {
+		network := &config.Networks[i]
+		if network.ScrapeSlots == 0 {
+			network.ScrapeSlots = defaultScrapeSlotsOf(*network)
+		}
+		if network.ScrapeConcurrency == 0 {
+			network.ScrapeConcurrency = defaultScrapeConcurrency
+		}
+		if network.RetentionSlots == 0 {
+			network.RetentionSlots = network.ScrapeSlots
+		}
+		if network.ConfirmationDepth == 0 {
+			network.ConfirmationDepth = defaultConfirmationDepth
+		}
+		if reason, ok := deprecatedNetworks[network.Name]; ok {
+			componentLogger("config", network.Name).Warn().Msg(reason)
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+	return config, nil
+}
+
+// defaultScrapeSlotsOf returns the scrape slots of a network which doesn't
+// configure them: -retention in the network's slots, if it's given, or else
+// -scrape-slots. The network's spec isn't known yet, so its slots are of its
+// seconds_per_slot, or else defaultSecondsPerSlot.
+func defaultScrapeSlotsOf(network NetworkConfig) uint64 {
+	if *retention <= 0 {
+		return *scrapeSlots
+	}
+	slotDuration := time.Duration(defaultSecondsPerSlot) * time.Second
+	if network.SecondsPerSlot != 0 {
+		slotDuration = time.Duration(network.SecondsPerSlot) * time.Second
+	}
+	return uint64((*retention + slotDuration - 1) / slotDuration)
+}
+
+// Validate checks that networks are uniquely named, have parseable node URLs,
+// and retain at least the slots they scrape.
+func (c *Config) Validate() error {
+	if len(c.Networks) == 0 {
+		return errors.New("no networks configured")
+	}
+	seen := make(map[string]bool, len(c.Networks))
+	hosts := make(map[string]string, len(c.Networks))
+	for _, network := range c.Networks {
+		if network.Name == "" {
+			return errors.New("network name is empty")
+		}
+		if seen[network.Name] {
+			return fmt.Errorf("network %q is configured more than once", network.Name)
+		}
+		seen[network.Name] = true
+
+		// Without scraping, the node URL is never used, so it may be left out.
+		if network.NodeURL != "" || !*noScrape {
+			u, err := url.Parse(network.NodeURL)
+			if err != nil {
+				return errors.Wrapf(err, "network %q has an invalid node URL", network.Name)
+			}
+			if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("network %q node URL must be an absolute http(s) URL", network.Name)
+			}
+		}
+		if network.RetentionSlots < network.ScrapeSlots {
+			return fmt.Errorf("network %q retains fewer slots than it scrapes", network.Name)
+		}
+		if network.ScrapeConcurrency < 1 {
+			return fmt.Errorf("network %q scrape concurrency must be positive", network.Name)
+		}
+		// Pruned empty slots are only kept in the bitmaps, which don't expire
+		// slot by slot and aren't replicated, see prune.go.
+		if network.PruneEmpty && network.ExpireByTTL {
+			return fmt.Errorf("network %q can't set both prune_empty and expire_by_ttl", network.Name)
+		}
+		if network.PruneEmpty && *replicateFrom != "" {
+			return fmt.Errorf("network %q can't set prune_empty on a replica", network.Name)
+		}
+		if network.Host != "" {
+			host := strings.ToLower(network.Host)
+			if other, ok := hosts[host]; ok {
+				return fmt.Errorf("networks %q and %q have the same host", other, network.Name)
+			}
+			hosts[host] = network.Name
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultConfig(t *testing.T) {
+	t.Setenv("BLOCKBUSTER_MAINNET_URL", "http://mainnet-node:5052")
+
+	config, err := LoadConfig("")
+	require.NoError(t, err)
+	var names []string
+	for _, network := range config.Networks {
+		names = append(names, network.Name)
+		switch network.Name {
+		case "mainnet":
+			require.Equal(t, "http://mainnet-node:5052", network.NodeURL)
+		case "holesky":
+			require.Equal(t, targets["holesky"], network.NodeURL)
+		}
+		require.Equal(t, uint64(defaultScrapeSlots), network.ScrapeSlots)
+		require.Equal(t, uint64(defaultConfirmationDepth), network.ConfirmationDepth)
+	}
+	require.Equal(t, []string{"holesky", "mainnet", "sepolia"}, names)
+}
+
+func TestLoadConfigDeprecatedNetwork(t *testing.T) {
+	// Deprecated networks still load.
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte("networks:\n  - name: prater\n    node_url: http://localhost:5052\n"), 0o644)
+	require.NoError(t, err)
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	require.Len(t, config.Networks, 1)
+	require.Equal(t, "prater", config.Networks[0].Name)
+}
+
+func TestValidateDuplicateHosts(t *testing.T) {
+	config := &Config{Networks: []NetworkConfig{
+		{Name: "a", NodeURL: "http://localhost:5052", ScrapeConcurrency: 1, Host: "a.example.com"},
+		{Name: "b", NodeURL: "http://localhost:5053", ScrapeConcurrency: 1, Host: "b.example.com"},
+	}}
+	require.NoError(t, config.Validate())
+	config.Networks[1].Host = "A.example.com"
+	require.EqualError(t, config.Validate(), `networks "a" and "b" have the same host`)
+}
+
+func TestValidatePruneEmpty(t *testing.T) {
+	config := &Config{Networks: []NetworkConfig{
+		{Name: "a", NodeURL: "http://localhost:5052", ScrapeConcurrency: 1, PruneEmpty: true},
+	}}
+	require.NoError(t, config.Validate())
+
+	config.Networks[0].ExpireByTTL = true
+	require.EqualError(t, config.Validate(), `network "a" can't set both prune_empty and expire_by_ttl`)
+	config.Networks[0].ExpireByTTL = false
+
+	prevReplicateFrom := *replicateFrom
+	t.Cleanup(func() { *replicateFrom = prevReplicateFrom })
+	*replicateFrom = "http://primary:8080"
+	require.EqualError(t, config.Validate(), `network "a" can't set prune_empty on a replica`)
+}
+
+func TestLoadConfigScrapeSlots(t *testing.T) {
+	prevScrapeSlots, prevRetention := *scrapeSlots, *retention
+	t.Cleanup(func() { *scrapeSlots, *retention = prevScrapeSlots, prevRetention })
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`networks:
+  - name: mainnet
+    node_url: http://localhost:5052
+  - name: gnosis
+    node_url: http://localhost:5053
+    seconds_per_slot: 5
+  - name: configured
+    node_url: http://localhost:5054
+    scrape_slots: 100
+`), 0o644)
+	require.NoError(t, err)
+	scrapeSlotsOf := func() map[string]uint64 {
+		config, err := LoadConfig(path)
+		require.NoError(t, err)
+		slots := make(map[string]uint64)
+		for _, network := range config.Networks {
+			slots[network.Name] = network.ScrapeSlots
+			require.Equal(t, network.ScrapeSlots, network.RetentionSlots)
+		}
+		return slots
+	}
+
+	*scrapeSlots = 1000
+	require.Equal(t, map[string]uint64{"mainnet": 1000, "gnosis": 1000, "configured": 100}, scrapeSlotsOf())
+
+	// -retention takes precedence, in slots of each network's duration.
+	*retention = 48 * time.Hour
+	require.Equal(t, map[string]uint64{"mainnet": 14400, "gnosis": 34560, "configured": 100}, scrapeSlotsOf())
+}
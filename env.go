@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pkg/errors"
+)
+
+// Environment variables configure the server as flags and the config file
+// do, so that a container can be configured without mounting files:
+//
+//   - BLOCKBUSTER_<FLAG> sets a flag which isn't given on the command line,
+//     such as BLOCKBUSTER_ADMIN_TOKEN for -admin-token.
+//   - BLOCKBUSTER_NETWORKS is a comma-separated list of the networks to run,
+//     taken from the config file (or the built-in ones) where they're in it.
+//   - BLOCKBUSTER_<NETWORK>_<FIELD> overrides a field of a network's config,
+//     such as BLOCKBUSTER_MAINNET_RETENTION_SLOTS, and BLOCKBUSTER_<NETWORK>_URL
+//     its node_url.
+//
+// Names are upper-cased, with dashes replaced by underscores.
+const envPrefix = "BLOCKBUSTER_"
+
+// envName returns the name of the environment variable of the given parts.
+func envName(parts ...string) string {
+	name := envPrefix + strings.Join(parts, "_")
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnvFlags sets the flags which weren't given on the command line from
+// their environment variables, and returns the names of those it set.
+func applyEnvFlags(flags *flag.FlagSet) (set []string, err error) {
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	flags.VisitAll(func(f *flag.Flag) {
+		if err != nil || given[f.Name] {
+			return
+		}
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		if err = flags.Set(f.Name, value); err != nil {
+			err = errors.Wrapf(err, "invalid %s", envName(f.Name))
+			return
+		}
+		set = append(set, f.Name)
+	})
+	return set, err
+}
+
+// applyEnvNetworks applies BLOCKBUSTER_NETWORKS and the networks' fields from
+// the environment over the config.
+func applyEnvNetworks(config *Config) error {
+	if list, ok := os.LookupEnv(envName("networks")); ok {
+		configured := make(map[string]NetworkConfig, len(config.Networks))
+		for _, network := range config.Networks {
+			configured[network.Name] = network
+		}
+		config.Networks = nil
+		for _, name := range strings.Split(list, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			network, ok := configured[name]
+			if !ok {
+				network = NetworkConfig{Name: name}
+				if nodeURL, ok := targets[name]; ok {
+					network.NodeURL = nodeURL
+				}
+			}
+			config.Networks = append(config.Networks, network)
+		}
+	}
+	for i := range config.Networks {
+		if err := applyEnvNetwork(&config.Networks[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyEnvNetwork sets the fields of the network's config which are set by
+// BLOCKBUSTER_<NETWORK>_<FIELD>, where FIELD is the field's JSON name.
+func applyEnvNetwork(network *NetworkConfig) error {
+	v := reflect.ValueOf(network).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		if field == "" || field == "name" {
+			continue
+		}
+		names := []string{envName(network.Name, field)}
+		if field == "node_url" {
+			names = append([]string{envName(network.Name, "url")}, names...)
+		}
+		for _, name := range names {
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				continue
+			}
+			if v.Field(i).Kind() == reflect.String {
+				v.Field(i).SetString(value)
+			} else {
+				ptr := reflect.New(v.Field(i).Type())
+				if err := yaml.Unmarshal([]byte(value), ptr.Interface()); err != nil {
+					return errors.Wrapf(err, "invalid %s", name)
+				}
+				v.Field(i).Set(ptr.Elem())
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// logConfig logs the effective config of each network, with its node URL
+// redacted.
+func logConfig(config *Config) {
+	for _, network := range config.Networks {
+		network.NodeURL = redactURL(network.NodeURL)
+		componentLogger("config", network.Name).Info().Interface("config", network).Msg("network configured")
+	}
+}
+
+// redactURL returns the URL without the password and query, which may hold
+// credentials.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = "redacted"
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/binary"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// Maximum number of epochs served by the epochs endpoint.
+const maxRangeEpochs = 256
+
+// epochCounts counts the slots of an epoch by what was scraped at them.
+type epochCounts struct {
+	Epoch     phase0.Epoch `json:"epoch"`
+	Blocks    int          `json:"blocks"`
+	Missed    int          `json:"missed"`
+	Unscraped int          `json:"unscraped"`
+
+	// Totals over the epoch's blocks, if requested.
+	Attestations *int `json:"attestations,omitempty"`
+	Transactions *int `json:"transactions,omitempty"`
+}
+
+// EpochCounts counts the slots of each epoch within the given range
+// (inclusive) in a single pass. Only if totals is set are the blocks decoded,
+// to total their attestations and transactions.
+func (s *Store) EpochCounts(from, to phase0.Epoch, slotsPerEpoch phase0.Slot, totals bool) ([]*epochCounts, error) {
+	counts := make([]*epochCounts, 0, to-from+1)
+	for epoch := from; epoch <= to; epoch++ {
+		c := &epochCounts{Epoch: epoch, Unscraped: int(slotsPerEpoch)}
+		if totals {
+			c.Attestations, c.Transactions = new(int), new(int)
+		}
+		counts = append(counts, c)
+	}
+	fromSlot := phase0.Slot(from) * slotsPerEpoch
+	toSlot := phase0.Slot(to+1)*slotsPerEpoch - 1
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = totals
+		opts.Prefix = keySlot
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(slotKey(keySlot, fromSlot)); it.Valid(); it.Next() {
+			item := it.Item()
+			slot := phase0.Slot(binary.BigEndian.Uint64(item.Key()[len(keySlot):]))
+			if slot > toSlot {
+				break
+			}
+			c := counts[slot/slotsPerEpoch-fromSlot/slotsPerEpoch]
+			c.Unscraped--
+			err := item.Value(func(val []byte) error {
+				if err := checkRecord(val); err != nil {
+					return err
+				}
+				if _, _, ok := readHeader(val); !ok {
+					c.Missed++
+					return nil
+				}
+				c.Blocks++
+				if !totals {
+					return nil
+				}
+				block, err := decodeBlock(val)
+				if err != nil {
+					return err
+				}
+				fields, err := messageFields(block.VersionedSignedBeaconBlock)
+				if err != nil {
+					return err
+				}
+				*c.Attestations += len(fields.Attestations)
+				if fields.ExecutionPayload != nil {
+					*c.Transactions += len(fields.ExecutionPayload.Transactions)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return counts, err
+}
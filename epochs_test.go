@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/bellatrix"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEpochCounts(t *testing.T) {
+	store := newTestStore(t)
+
+	// Epoch 1 (slots 4-7 at 4 slots per epoch) has two blocks, a missed
+	// slot and an unscraped slot. Epoch 2 has a single block.
+	block := testBlock(4)
+	block.Phase0.Message.Body.Attestations = testForkBlocks()[0].Phase0.Message.Body.Attestations[:2]
+	require.NoError(t, store.SetBlock(4, block))
+	require.NoError(t, store.SetBlock(5, nil))
+	execution := testBellatrixBlock(7, phase0.Hash32{1})
+	execution.Bellatrix.Message.Body.ExecutionPayload.Transactions = []bellatrix.Transaction{{1}, {2}, {3}}
+	require.NoError(t, store.SetBlock(7, execution))
+	require.NoError(t, store.SetBlock(8, testBlock(8)))
+
+	counts, err := store.EpochCounts(1, 3, 4, false)
+	require.NoError(t, err)
+	require.Equal(t, []*epochCounts{
+		{Epoch: 1, Blocks: 2, Missed: 1, Unscraped: 1},
+		{Epoch: 2, Blocks: 1, Unscraped: 3},
+		{Epoch: 3, Unscraped: 4},
+	}, counts)
+
+	counts, err = store.EpochCounts(1, 2, 4, true)
+	require.NoError(t, err)
+	require.Equal(t, 2, *counts[0].Attestations)
+	require.Equal(t, 3, *counts[0].Transactions)
+	require.Equal(t, 0, *counts[1].Attestations)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// With expire_by_ttl, the records of each slot are written with a Badger TTL
+// which expires them as the slot falls out of the retention window, rather
+// than being deleted by the hourly purge.
+//
+// Compared with Purge, expiry costs nothing up front: expired records are
+// simply skipped by reads, and their space is reclaimed by compactions and
+// value log GC, rather than by writing a tombstone for every key. But nothing
+// happens when records expire, so the caches keep serving expired slots until
+// they're evicted, and a changed retention window only applies to slots
+// written afterwards (the purge on startup still trims the rest). Pinned
+// slots are written without a TTL, and pinning a stored slot rewrites its
+// records without one. Unpinning doesn't restore it, so an unpinned slot is
+// only purged on the next startup.
+
+// slotExpiry computes when slots fall out of a network's retention window.
+type slotExpiry struct {
+	genesisTime    time.Time
+	slotDuration   time.Duration
+	retentionSlots phase0.Slot
+}
+
+// at returns when the slot falls out of the retention window, in Unix seconds
+// as Badger expects, which is once it's before retentionStart.
+func (e *slotExpiry) at(slot phase0.Slot) uint64 {
+	return uint64(e.genesisTime.Add(time.Duration(slot+e.retentionSlots+1) * e.slotDuration).Unix())
+}
+
+// SetExpiry makes the slots written from now on expire when they fall out
+// of the retention window, or not at all if expiry is nil.
+func (s *Store) SetExpiry(expiry *slotExpiry) {
+	s.expiry.Store(expiry)
+}
+
+func (s *Store) slotExpiry() *slotExpiry {
+	expiry, _ := s.expiry.Load().(*slotExpiry)
+	return expiry
+}
+
+// expiresAt returns when the records of the slot should expire, or 0 if
+// they shouldn't, such as when it's pinned.
+func (s *Store) expiresAt(txn *badger.Txn, slot phase0.Slot) (uint64, error) {
+	expiry := s.slotExpiry()
+	if expiry == nil {
+		return 0, nil
+	}
+	pinned, err := isPinned(txn, slot)
+	if err != nil || pinned {
+		return 0, err
+	}
+	return expiry.at(slot), nil
+}
+
+// entryWriter is implemented by both badger.Txn and badger.WriteBatch.
+type entryWriter interface {
+	writer
+	SetEntry(e *badger.Entry) error
+}
+
+// expiringWriter sets entries which expire at expiresAt.
+type expiringWriter struct {
+	entryWriter
+	expiresAt uint64
+}
+
+func (w expiringWriter) Set(key, value []byte) error {
+	entry := badger.NewEntry(key, value)
+	entry.ExpiresAt = w.expiresAt
+	return w.SetEntry(entry)
+}
+
+// withExpiry returns a writer which sets entries that expire at expiresAt,
+// or w itself if expiresAt is 0.
+func withExpiry(w entryWriter, expiresAt uint64) writer {
+	if expiresAt == 0 {
+		return w
+	}
+	return expiringWriter{w, expiresAt}
+}
+
+// persist rewrites the records of the slot without a TTL.
+func persist(txn *badger.Txn, slot phase0.Slot) error {
+	keys, err := indexedKeys(txn, slot)
+	if err != nil {
+		return err
+	}
+	keys = append(keys, slotKey(keySlot, slot), slotKey(keyIndexes, slot))
+	for _, prefix := range [][]byte{keyOrphaned, keyAnnotation} {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: slotKey(prefix, slot)})
+		for it.Rewind(); it.Valid(); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		it.Close()
+	}
+
+	for _, key := range keys {
+		item, err := txn.Get(key)
+		if err == badger.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if item.ExpiresAt() == 0 {
+			continue
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if err := txn.Set(key, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
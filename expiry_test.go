@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpiry(t *testing.T) {
+	store := newTestStore(t)
+
+	// The current slot is 100, so slots before 90 are out of the window.
+	store.SetExpiry(&slotExpiry{
+		genesisTime:    time.Now().Add(-100*12*time.Second - 6*time.Second),
+		slotDuration:   12 * time.Second,
+		retentionSlots: 10,
+	})
+	block := func(slot phase0.Slot) *BlockWithRoot {
+		block := testBlock(slot)
+		block.BlockRoot = phase0.Root{byte(slot)}
+		return block
+	}
+	require.NoError(t, store.Pin(88))
+	require.NoError(t, store.SetBlock(88, block(88)))
+	require.NoError(t, store.SetBlock(89, block(89)))
+	require.NoError(t, store.SetBlocks(map[phase0.Slot]*BlockWithRoot{
+		87: block(87),
+		90: block(90),
+		91: nil,
+	}))
+
+	// Slots out of the window expire along with their indexes, unless pinned.
+	for slot, expected := range map[phase0.Slot]bool{87: false, 88: true, 89: false, 90: true, 91: true} {
+		filled, err := store.Filled(slot)
+		require.NoError(t, err)
+		require.Equal(t, expected, filled, "slot %d", slot)
+	}
+	_, _, err := store.BlockByRoot(phase0.Root{89})
+	require.ErrorIs(t, err, badger.ErrKeyNotFound)
+	_, _, err = store.BlockByRoot(phase0.Root{88})
+	require.NoError(t, err)
+	empty, unscraped, err := store.MissingSlots(86, 91)
+	require.NoError(t, err)
+	require.Equal(t, []phase0.Slot{91}, empty)
+	require.Equal(t, []phase0.Slot{86, 87, 89}, unscraped)
+
+	expiresAt := func(key []byte) uint64 {
+		var expiresAt uint64
+		err := store.db.View(func(txn *badger.Txn) error {
+			item, err := txn.Get(key)
+			if err != nil {
+				return err
+			}
+			expiresAt = item.ExpiresAt()
+			return nil
+		})
+		require.NoError(t, err)
+		return expiresAt
+	}
+	rootKey := append(append([]byte{}, keyBlockRoot...), block(90).BlockRoot[:]...)
+	require.Equal(t, store.slotExpiry().at(90), expiresAt(slotKey(keySlot, 90)))
+	require.Equal(t, store.slotExpiry().at(90), expiresAt(rootKey))
+
+	// Pinning a stored slot keeps it from expiring.
+	require.NoError(t, store.Pin(90))
+	require.Zero(t, expiresAt(slotKey(keySlot, 90)))
+	require.Zero(t, expiresAt(slotKey(keyIndexes, 90)))
+	require.Zero(t, expiresAt(rootKey))
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	client "github.com/attestantio/go-eth2-client"
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// How many times to retry fetching a block before giving up.
+	fetchRetries = 5
+
+	// Bounds of the exponential backoff between fetch retries.
+	fetchBackoffMin = 500 * time.Millisecond
+	fetchBackoffMax = 16 * time.Second
+)
+
+// defaultNotFoundErrors are substrings of errors which mean that the node has
+// no block at the slot. The client returns a 404 as an *api.Error, which
+// isBlockNotFound recognizes, so these only cover nodes which respond otherwise.
+var defaultNotFoundErrors = []string{
+	// Prysm.
+	"Could not get block from block ID: rpc error: code = NotFound",
+	"rpc error: code = NotFound desc = Could not find requested block: signed beacon block can't be nil", // v2.1.0
+	payloadUnavailableError,
+}
+
+// payloadUnavailableError is the error of nodes which have the block at the
+// slot, but not its full execution payload, such as Prysm when the execution
+// client pruned it or missed it. Unless the network has blinded_fallback set,
+// the slot is stored as empty, as a not-found error. See blinded.go.
+const payloadUnavailableError = "Could not reconstruct full execution payload to create signed beacon block: block hash field in execution header"
+
+// errPayloadUnavailable is returned by fetchBlock for payloadUnavailableError.
+var errPayloadUnavailable = errors.New("node can't reconstruct the block's execution payload")
+
+// extraNotFoundErrors holds the []string of not-found errors from the config.
+var extraNotFoundErrors atomic.Value
+
+// setNotFoundErrors sets the not-found errors to recognize besides the defaults.
+func setNotFoundErrors(substrings []string) {
+	extraNotFoundErrors.Store(substrings)
+}
+
+// isBlockNotFound returns whether the error means the node has no block at the slot.
+func isBlockNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr *api.Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return true
+	}
+	errString := err.Error()
+	extra, _ := extraNotFoundErrors.Load().([]string)
+	for _, substrings := range [][]string{defaultNotFoundErrors, extra} {
+		for _, s := range substrings {
+			if strings.Contains(errString, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nodeContext returns a context for a single request to a node, which times
+// out after -node-timeout so that a hung node can't block its caller.
+func nodeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, *nodeTimeout)
+}
+
+// fetchHeadSlot fetches the node's head slot.
+func fetchHeadSlot(ctx context.Context, svc client.Service) (phase0.Slot, error) {
+	ctx, cancel := nodeContext(ctx)
+	defer cancel()
+	syncState, err := svc.(client.NodeSyncingProvider).NodeSyncing(ctx, &api.NodeSyncingOpts{})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get sync state")
+	}
+	return syncState.Data.HeadSlot, nil
+}
+
+// fetchBlock fetches the block at the given slot, retrying with exponential
+// backoff on errors (including timeouts). Returns a nil block if the slot has
+// none, or errPayloadUnavailable if the node can't serve its execution payload.
+func fetchBlock(ctx context.Context, svc client.Service, network string, slot phase0.Slot) (block *spec.VersionedSignedBeaconBlock, err error) {
+	unavailable := false
+	err = fetchWithRetries(ctx, network, slot, func(ctx context.Context) error {
+		var err error
+		block, err = getBlock(ctx, svc, slot)
+		if err != nil && strings.Contains(err.Error(), payloadUnavailableError) {
+			unavailable = true
+			return nil
+		}
+		if isBlockNotFound(err) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if unavailable {
+		return nil, errPayloadUnavailable
+	}
+	return block, nil
+}
+
+// getBlock requests the block at the given slot from the node, once.
+func getBlock(ctx context.Context, svc client.Service, slot phase0.Slot) (*spec.VersionedSignedBeaconBlock, error) {
+	resp, err := svc.(client.SignedBeaconBlockProvider).SignedBeaconBlock(ctx, &api.SignedBeaconBlockOpts{Block: fmt.Sprint(slot)})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// fetchWithRetries calls fetch with a context for a single request until it
+// succeeds, retrying with exponential backoff on errors (including timeouts).
+func fetchWithRetries(ctx context.Context, network string, slot phase0.Slot, fetch func(ctx context.Context) error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		requestCtx, cancel := nodeContext(ctx)
+		err = fetch(requestCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		metricNodeErrors.WithLabelValues(network).Inc()
+		scrapeStatusOf(network).errors.Incr(1)
+		if errors.Is(err, context.DeadlineExceeded) {
+			metricNodeTimeouts.WithLabelValues(network).Inc()
+		}
+
+		if attempt == fetchRetries {
+			break
+		}
+		delay := fetchBackoff(attempt)
+		// With -quiet, they're counted in the progress summaries instead.
+		level := zerolog.WarnLevel
+		if *quiet {
+			level = zerolog.DebugLevel
+		}
+		componentLogger("scraper", network).WithLevel(level).Err(err).Uint64("slot", uint64(slot)).Dur("retry_in", delay).Msg("failed to get block, retrying")
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return fmt.Errorf("failed to get block %d after %d retries: %w", slot, fetchRetries, err)
+}
+
+// fetchBlockWithRoot fetches the block at the given slot as fetchBlock does,
+// and computes its root, verifying it against the node's if the network has
+// verify_roots set. If the node can't serve the block's execution payload,
+// its blinded block is fetched instead if the network has blinded_fallback
+// set, or else the slot is taken as empty. Returns nil if the slot has none.
+func fetchBlockWithRoot(ctx context.Context, svc client.Service, network NetworkConfig, slot phase0.Slot) (*BlockWithRoot, error) {
+	versioned, err := fetchBlock(ctx, svc, network.Name, slot)
+	var block *BlockWithRoot
+	switch {
+	case errors.Is(err, errPayloadUnavailable):
+		if !network.BlindedFallback {
+			return nil, nil
+		}
+		if block, err = fetchBlindedBlock(ctx, network, slot); err != nil {
+			return nil, err
+		}
+		if block == nil {
+			return nil, nil
+		}
+	case err != nil:
+		return nil, err
+	case versioned == nil:
+		return nil, nil
+	default:
+		if err := checkFork(versioned.Version); err != nil {
+			return nil, errors.Wrapf(err, "can't store block at slot %d", slot)
+		}
+		block = &BlockWithRoot{VersionedSignedBeaconBlock: versioned}
+		block.BlockRoot, err = versioned.Root()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get block root hash")
+		}
+	}
+	if network.VerifyRoots {
+		if err := verifyRoot(ctx, svc, slot, block.BlockRoot); err != nil {
+			return nil, err
+		}
+	}
+	return block, nil
+}
+
+// fetchBackoff returns the delay before the given retry attempt (from 0),
+// doubling from fetchBackoffMin up to fetchBackoffMax, less up to half of it
+// at random so that workers don't retry in lockstep.
+func fetchBackoff(attempt int) time.Duration {
+	backoff := fetchBackoffMax
+	if attempt < 16 && fetchBackoffMin<<attempt < fetchBackoffMax {
+		backoff = fetchBackoffMin << attempt
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
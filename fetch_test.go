@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchBackoff(t *testing.T) {
+	for attempt := 0; attempt < 100; attempt++ {
+		want := fetchBackoffMin << attempt
+		if attempt >= 16 || want > fetchBackoffMax {
+			want = fetchBackoffMax
+		}
+		for i := 0; i < 10; i++ {
+			backoff := fetchBackoff(attempt)
+			require.GreaterOrEqual(t, backoff, want/2)
+			require.LessOrEqual(t, backoff, want)
+		}
+	}
+}
+
+func TestIsBlockNotFound(t *testing.T) {
+	// Errors as wrapped by the client on non-2xx responses.
+	wrap := func(status int, body string) error {
+		return fmt.Errorf("failed to request signed beacon block: GET failed with status %d: %s", status, body)
+	}
+	notFound := []error{
+		// Prysm.
+		wrap(500, `{"message":"Could not get block from block ID: rpc error: code = NotFound desc = Could not find requested block","code":500}`),
+		wrap(500, `{"message":"rpc error: code = NotFound desc = Could not find requested block: signed beacon block can't be nil","code":500}`),
+		wrap(500, `{"message":"Could not reconstruct full execution payload to create signed beacon block: block hash field in execution header 0x00 does not match","code":500}`),
+	}
+	for _, err := range notFound {
+		require.True(t, isBlockNotFound(err), err.Error())
+	}
+
+	found := []error{
+		nil,
+		wrap(500, `{"code":500,"message":"Internal server error"}`),
+		wrap(503, `{"code":503,"message":"Beacon node is currently syncing"}`),
+		errors.New("failed to call GET endpoint: context deadline exceeded"),
+	}
+	for _, err := range found {
+		require.False(t, isBlockNotFound(err), fmt.Sprint(err))
+	}
+
+	// Not-found errors can be extended by the config.
+	err := wrap(500, `{"message":"UNKNOWN_BLOCK"}`)
+	require.False(t, isBlockNotFound(err))
+	setNotFoundErrors([]string{"UNKNOWN_BLOCK"})
+	t.Cleanup(func() { setNotFoundErrors(nil) })
+	require.True(t, isBlockNotFound(err))
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/goccy/go-json"
+)
+
+// fieldSelection is a tree of the JSON fields selected by the fields param,
+// keyed by field name. An empty selection selects the whole value.
+type fieldSelection map[string]fieldSelection
+
+// parseFields parses a comma-separated list of dot-separated JSON paths, such
+// as "root,data.message.slot". Paths through arrays apply to every element.
+func parseFields(param string) (fieldSelection, error) {
+	selection := fieldSelection{}
+	for _, path := range strings.Split(param, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			return nil, fmt.Errorf("empty field")
+		}
+		node := selection
+		names := strings.Split(path, ".")
+		for i, name := range names {
+			if name == "" {
+				return nil, fmt.Errorf("invalid field %q", path)
+			}
+			child, ok := node[name]
+			if ok && len(child) == 0 {
+				// An enclosing field is already selected whole.
+				break
+			}
+			if i == len(names)-1 {
+				node[name] = fieldSelection{}
+				break
+			}
+			if !ok {
+				child = fieldSelection{}
+				node[name] = child
+			}
+			node = child
+		}
+	}
+	return selection, nil
+}
+
+// selectFields returns the JSON representation of v with only the selected
+// fields. If strict is set, it fails on fields which v doesn't have;
+// otherwise they're left out.
+func selectFields(v interface{}, selection fieldSelection, strict bool) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return selection.apply(value, "", strict)
+}
+
+func (s fieldSelection) apply(value interface{}, path string, strict bool) (interface{}, error) {
+	if len(s) == 0 {
+		return value, nil
+	}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		selected := make(map[string]interface{}, len(s))
+		for name, child := range s {
+			fieldPath := strings.TrimPrefix(path+"."+name, ".")
+			fieldValue, ok := value[name]
+			if !ok {
+				if strict {
+					return nil, fmt.Errorf("unknown field %q", fieldPath)
+				}
+				continue
+			}
+			fieldValue, err := child.apply(fieldValue, fieldPath, strict)
+			if err != nil {
+				return nil, err
+			}
+			if fieldValue == nil && len(child) > 0 {
+				// It has none of the selected fields.
+				continue
+			}
+			selected[name] = fieldValue
+		}
+		if len(selected) == 0 {
+			return nil, nil
+		}
+		return selected, nil
+	case []interface{}:
+		selected := make([]interface{}, len(value))
+		for i, element := range value {
+			var err error
+			selected[i], err = s.apply(element, path, strict)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return selected, nil
+	}
+	if strict {
+		return nil, fmt.Errorf("field %q has no fields", path)
+	}
+	return nil, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFields(t *testing.T) {
+	selection, err := parseFields("root, data.message.slot,data.message.proposer_index,data.signature")
+	require.NoError(t, err)
+	require.Equal(t, fieldSelection{
+		"root": {},
+		"data": {
+			"message":   {"slot": {}, "proposer_index": {}},
+			"signature": {},
+		},
+	}, selection)
+
+	// An enclosing field selects everything within it, whichever comes first.
+	selection, err = parseFields("data.message.slot,data,root.x,root")
+	require.NoError(t, err)
+	require.Equal(t, fieldSelection{"data": {}, "root": {}}, selection)
+
+	for _, param := range []string{"", "root,", "data..slot", ".root"} {
+		_, err := parseFields(param)
+		require.Error(t, err, param)
+	}
+}
+
+func TestSelectFields(t *testing.T) {
+	resp := newBlockResponse(&BlockWithRoot{VersionedSignedBeaconBlock: testForkBlocks()[0]}, blockOptions{attestationsLimit: -1})
+	selection, err := parseFields("version,data.message.slot,data.message.body.attestations.data.slot")
+	require.NoError(t, err)
+	selected, err := selectFields(resp, selection, true)
+	require.NoError(t, err)
+	data, err := json.Marshal(selected)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"version": "phase0",
+		"data": {"message": {
+			"slot": "1",
+			"body": {"attestations": [
+				{"data": {"slot": "0"}},
+				{"data": {"slot": "1"}},
+				{"data": {"slot": "2"}}
+			]}
+		}}
+	}`, string(data))
+
+	// Unknown fields are rejected only if strict.
+	selection, err = parseFields("version,data.message.body.execution_payload.block_hash,root.x")
+	require.NoError(t, err)
+	_, err = selectFields(resp, selection, true)
+	require.Error(t, err)
+	selected, err = selectFields(resp, selection, false)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"version": "phase0"}, selected)
+}
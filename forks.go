@@ -0,0 +1,366 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/altair"
+	"github.com/attestantio/go-eth2-client/spec/bellatrix"
+	"github.com/attestantio/go-eth2-client/spec/capella"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/electra"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/prysmaticlabs/go-bitfield"
+)
+
+// The helpers in this file, along with sizeSSZ and unblindBlock, are the only
+// places that switch on the fork of a block, so supporting a new fork means
+// adding a case to each of them.
+
+// checkFork returns an error unless blocks of the given fork can be stored.
+func checkFork(version spec.DataVersion) error {
+	switch version {
+	case spec.DataVersionPhase0, spec.DataVersionAltair, spec.DataVersionBellatrix,
+		spec.DataVersionCapella, spec.DataVersionDeneb, spec.DataVersionElectra:
+		return nil
+	}
+	return unsupportedForkError(version)
+}
+
+// forkNumber returns the number that blocks of the fork are recorded with:
+// 0 for Phase0, 1 for Altair, and so on. It's counted from Phase0's
+// DataVersion rather than being the DataVersion itself, which the client
+// numbers from an unknown version, so that records keep their meaning.
+func forkNumber(version spec.DataVersion) uint64 {
+	return uint64(version - spec.DataVersionPhase0)
+}
+
+// forkOfNumber returns the fork that blocks recorded with the number are of.
+func forkOfNumber(number uint64) spec.DataVersion {
+	return spec.DataVersion(number) + spec.DataVersionPhase0
+}
+
+func unsupportedForkError(version spec.DataVersion) error {
+	return fmt.Errorf("unsupported fork version %d", version)
+}
+
+// marshalBlock returns the SSZ encoding of the signed block.
+func marshalBlock(block *spec.VersionedSignedBeaconBlock) ([]byte, error) {
+	switch block.Version {
+	case spec.DataVersionPhase0:
+		return block.Phase0.MarshalSSZ()
+	case spec.DataVersionAltair:
+		return block.Altair.MarshalSSZ()
+	case spec.DataVersionBellatrix:
+		return block.Bellatrix.MarshalSSZ()
+	case spec.DataVersionCapella:
+		return block.Capella.MarshalSSZ()
+	case spec.DataVersionDeneb:
+		return block.Deneb.MarshalSSZ()
+	case spec.DataVersionElectra:
+		return block.Electra.MarshalSSZ()
+	}
+	return nil, unsupportedForkError(block.Version)
+}
+
+// unmarshalBlock decodes an SSZ-encoded signed block of the given version.
+func unmarshalBlock(version spec.DataVersion, data []byte) (*spec.VersionedSignedBeaconBlock, error) {
+	block := &spec.VersionedSignedBeaconBlock{Version: version}
+	var err error
+	switch version {
+	case spec.DataVersionPhase0:
+		block.Phase0 = &phase0.SignedBeaconBlock{}
+		err = block.Phase0.UnmarshalSSZ(data)
+	case spec.DataVersionAltair:
+		block.Altair = &altair.SignedBeaconBlock{}
+		err = block.Altair.UnmarshalSSZ(data)
+	case spec.DataVersionBellatrix:
+		block.Bellatrix = &bellatrix.SignedBeaconBlock{}
+		err = block.Bellatrix.UnmarshalSSZ(data)
+	case spec.DataVersionCapella:
+		block.Capella = &capella.SignedBeaconBlock{}
+		err = block.Capella.UnmarshalSSZ(data)
+	case spec.DataVersionDeneb:
+		block.Deneb = &deneb.SignedBeaconBlock{}
+		err = block.Deneb.UnmarshalSSZ(data)
+	case spec.DataVersionElectra:
+		block.Electra = &electra.SignedBeaconBlock{}
+		err = block.Electra.UnmarshalSSZ(data)
+	default:
+		return nil, unsupportedForkError(version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// blockFields holds the fields of a block's message that are common across forks.
+type blockFields struct {
+	Slot          phase0.Slot
+	ProposerIndex phase0.ValidatorIndex
+	ParentRoot    phase0.Root
+	Graffiti      [32]byte
+	Deposits      []*phase0.Deposit
+
+	// Attestations and AttesterSlashings are of the fork's types, which are
+	// *phase0.Attestation and *phase0.AttesterSlashing before Electra, and
+	// *electra.Attestation and *electra.AttesterSlashing from it.
+	Attestations      []interface{}
+	AttesterSlashings []interface{}
+
+	ProposerSlashings []*phase0.ProposerSlashing
+	VoluntaryExits    []*phase0.SignedVoluntaryExit
+
+	// ExecutionPayload is nil before Bellatrix.
+	ExecutionPayload *executionPayload
+
+	// ExecutionRequests is nil before Electra.
+	ExecutionRequests *electra.ExecutionRequests
+}
+
+// executionPayload holds the fields of an execution payload that are common
+// across forks, along with the fork's payload itself.
+type executionPayload struct {
+	BlockHash    phase0.Hash32
+	Transactions []bellatrix.Transaction
+
+	// Data is the fork's payload, such as a *capella.ExecutionPayload.
+	Data interface{}
+}
+
+// messageFields returns the fork-independent fields of the block's message.
+func messageFields(block *spec.VersionedSignedBeaconBlock) (*blockFields, error) {
+	switch block.Version {
+	case spec.DataVersionPhase0:
+		message := block.Phase0.Message
+		return &blockFields{
+			Slot:          message.Slot,
+			ProposerIndex: message.ProposerIndex,
+			ParentRoot:    message.ParentRoot,
+			Graffiti:      message.Body.Graffiti,
+			Deposits:      message.Body.Deposits,
+
+			Attestations:      anySlice(message.Body.Attestations),
+			AttesterSlashings: anySlice(message.Body.AttesterSlashings),
+			ProposerSlashings: message.Body.ProposerSlashings,
+			VoluntaryExits:    message.Body.VoluntaryExits,
+		}, nil
+	case spec.DataVersionAltair:
+		message := block.Altair.Message
+		return &blockFields{
+			Slot:          message.Slot,
+			ProposerIndex: message.ProposerIndex,
+			ParentRoot:    message.ParentRoot,
+			Graffiti:      message.Body.Graffiti,
+			Deposits:      message.Body.Deposits,
+
+			Attestations:      anySlice(message.Body.Attestations),
+			AttesterSlashings: anySlice(message.Body.AttesterSlashings),
+			ProposerSlashings: message.Body.ProposerSlashings,
+			VoluntaryExits:    message.Body.VoluntaryExits,
+		}, nil
+	case spec.DataVersionBellatrix:
+		message := block.Bellatrix.Message
+		fields := &blockFields{
+			Slot:          message.Slot,
+			ProposerIndex: message.ProposerIndex,
+			ParentRoot:    message.ParentRoot,
+			Graffiti:      message.Body.Graffiti,
+			Deposits:      message.Body.Deposits,
+
+			Attestations:      anySlice(message.Body.Attestations),
+			AttesterSlashings: anySlice(message.Body.AttesterSlashings),
+			ProposerSlashings: message.Body.ProposerSlashings,
+			VoluntaryExits:    message.Body.VoluntaryExits,
+		}
+		if payload := message.Body.ExecutionPayload; payload != nil {
+			fields.ExecutionPayload = &executionPayload{BlockHash: payload.BlockHash, Transactions: payload.Transactions, Data: payload}
+		}
+		return fields, nil
+	case spec.DataVersionCapella:
+		message := block.Capella.Message
+		fields := &blockFields{
+			Slot:          message.Slot,
+			ProposerIndex: message.ProposerIndex,
+			ParentRoot:    message.ParentRoot,
+			Graffiti:      message.Body.Graffiti,
+			Deposits:      message.Body.Deposits,
+
+			Attestations:      anySlice(message.Body.Attestations),
+			AttesterSlashings: anySlice(message.Body.AttesterSlashings),
+			ProposerSlashings: message.Body.ProposerSlashings,
+			VoluntaryExits:    message.Body.VoluntaryExits,
+		}
+		if payload := message.Body.ExecutionPayload; payload != nil {
+			fields.ExecutionPayload = &executionPayload{BlockHash: payload.BlockHash, Transactions: payload.Transactions, Data: payload}
+		}
+		return fields, nil
+	case spec.DataVersionDeneb:
+		message := block.Deneb.Message
+		fields := &blockFields{
+			Slot:          message.Slot,
+			ProposerIndex: message.ProposerIndex,
+			ParentRoot:    message.ParentRoot,
+			Graffiti:      message.Body.Graffiti,
+			Deposits:      message.Body.Deposits,
+
+			Attestations:      anySlice(message.Body.Attestations),
+			AttesterSlashings: anySlice(message.Body.AttesterSlashings),
+			ProposerSlashings: message.Body.ProposerSlashings,
+			VoluntaryExits:    message.Body.VoluntaryExits,
+		}
+		if payload := message.Body.ExecutionPayload; payload != nil {
+			fields.ExecutionPayload = &executionPayload{BlockHash: payload.BlockHash, Transactions: payload.Transactions, Data: payload}
+		}
+		return fields, nil
+	case spec.DataVersionElectra:
+		message := block.Electra.Message
+		fields := &blockFields{
+			Slot:          message.Slot,
+			ProposerIndex: message.ProposerIndex,
+			ParentRoot:    message.ParentRoot,
+			Graffiti:      message.Body.Graffiti,
+			Deposits:      message.Body.Deposits,
+
+			Attestations:      anySlice(message.Body.Attestations),
+			AttesterSlashings: anySlice(message.Body.AttesterSlashings),
+			ProposerSlashings: message.Body.ProposerSlashings,
+			VoluntaryExits:    message.Body.VoluntaryExits,
+
+			ExecutionRequests: message.Body.ExecutionRequests,
+		}
+		if payload := message.Body.ExecutionPayload; payload != nil {
+			fields.ExecutionPayload = &executionPayload{BlockHash: payload.BlockHash, Transactions: payload.Transactions, Data: payload}
+		}
+		return fields, nil
+	}
+	return nil, unsupportedForkError(block.Version)
+}
+
+// anySlice returns the elements of a fork's list as interface{} values.
+func anySlice[T any](list []T) []interface{} {
+	values := make([]interface{}, len(list))
+	for i, value := range list {
+		values[i] = value
+	}
+	return values
+}
+
+// attestationBits returns the data and aggregation bits of an attestation of
+// any fork, and the committees which an Electra attestation aggregates across
+// (those set in its committee bits, whose members its aggregation bits cover
+// in order). Before Electra, an attestation is of its data's committee, and
+// committees is nil.
+func attestationBits(attestation interface{}) (data *phase0.AttestationData, bits bitfield.Bitlist, committees []phase0.CommitteeIndex, err error) {
+	switch attestation := attestation.(type) {
+	case *phase0.Attestation:
+		return attestation.Data, attestation.AggregationBits, nil, nil
+	case *electra.Attestation:
+		for _, index := range attestation.CommitteeBits.BitIndices() {
+			committees = append(committees, phase0.CommitteeIndex(index))
+		}
+		return attestation.Data, attestation.AggregationBits, committees, nil
+	}
+	return nil, nil, nil, fmt.Errorf("unsupported attestation type %T", attestation)
+}
+
+// withoutTransactions returns a copy of the fork's execution payload without
+// its transactions, rather than modifying it, since the block may be shared
+// via the cache.
+func withoutTransactions(payload interface{}) interface{} {
+	switch payload := payload.(type) {
+	case *bellatrix.ExecutionPayload:
+		if payload != nil {
+			trimmed := *payload
+			trimmed.Transactions = nil
+			return &trimmed
+		}
+	case *capella.ExecutionPayload:
+		if payload != nil {
+			trimmed := *payload
+			trimmed.Transactions = nil
+			return &trimmed
+		}
+	case *deneb.ExecutionPayload:
+		if payload != nil {
+			trimmed := *payload
+			trimmed.Transactions = nil
+			return &trimmed
+		}
+	}
+	return payload
+}
+
+// blockData returns the signed block of the block's fork for serving, with its
+// attestations paged and its transactions hidden according to opts. What's
+// trimmed is shallow-copied, since the block may be shared via the cache.
+func blockData(block *spec.VersionedSignedBeaconBlock, opts blockOptions) interface{} {
+	switch block.Version {
+	case spec.DataVersionPhase0:
+		data := *block.Phase0
+		if opts.trimsAttestations() {
+			message := *data.Message
+			body := *message.Body
+			body.Attestations = pageAttestations(opts, body.Attestations)
+			message.Body = &body
+			data.Message = &message
+		}
+		return &data
+	case spec.DataVersionAltair:
+		data := *block.Altair
+		if opts.trimsAttestations() {
+			message := *data.Message
+			body := *message.Body
+			body.Attestations = pageAttestations(opts, body.Attestations)
+			message.Body = &body
+			data.Message = &message
+		}
+		return &data
+	case spec.DataVersionBellatrix:
+		data := *block.Bellatrix
+		if opts.trimsAttestations() || opts.hideTransactions {
+			message := *data.Message
+			body := *message.Body
+			body.Attestations = pageAttestations(opts, body.Attestations)
+			body.ExecutionPayload = opts.trimPayload(body.ExecutionPayload).(*bellatrix.ExecutionPayload)
+			message.Body = &body
+			data.Message = &message
+		}
+		return &data
+	case spec.DataVersionCapella:
+		data := *block.Capella
+		if opts.trimsAttestations() || opts.hideTransactions {
+			message := *data.Message
+			body := *message.Body
+			body.Attestations = pageAttestations(opts, body.Attestations)
+			body.ExecutionPayload = opts.trimPayload(body.ExecutionPayload).(*capella.ExecutionPayload)
+			message.Body = &body
+			data.Message = &message
+		}
+		return &data
+	case spec.DataVersionDeneb:
+		data := *block.Deneb
+		if opts.trimsAttestations() || opts.hideTransactions {
+			message := *data.Message
+			body := *message.Body
+			body.Attestations = pageAttestations(opts, body.Attestations)
+			body.ExecutionPayload = opts.trimPayload(body.ExecutionPayload).(*deneb.ExecutionPayload)
+			message.Body = &body
+			data.Message = &message
+		}
+		return &data
+	case spec.DataVersionElectra:
+		data := *block.Electra
+		if opts.trimsAttestations() || opts.hideTransactions {
+			message := *data.Message
+			body := *message.Body
+			body.Attestations = pageAttestations(opts, body.Attestations)
+			body.ExecutionPayload = opts.trimPayload(body.ExecutionPayload).(*deneb.ExecutionPayload)
+			message.Body = &body
+			data.Message = &message
+		}
+		return &data
+	}
+	return nil
+}
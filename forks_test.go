@@ -0,0 +1,228 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/altair"
+	"github.com/attestantio/go-eth2-client/spec/bellatrix"
+	"github.com/attestantio/go-eth2-client/spec/capella"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/electra"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+// testForkBlocks returns a block with attestations of every supported fork.
+func testForkBlocks() []*spec.VersionedSignedBeaconBlock {
+	attestations := func() []*phase0.Attestation {
+		var attestations []*phase0.Attestation
+		for i := 0; i < 3; i++ {
+			attestations = append(attestations, &phase0.Attestation{
+				AggregationBits: []byte{0x01},
+				Data: &phase0.AttestationData{
+					Slot:   phase0.Slot(i),
+					Source: &phase0.Checkpoint{},
+					Target: &phase0.Checkpoint{},
+				},
+			})
+		}
+		return attestations
+	}
+
+	phase0Block := testBlock(1).VersionedSignedBeaconBlock
+	phase0Block.Phase0.Message.Body.Attestations = attestations()
+
+	altairBlock := &spec.VersionedSignedBeaconBlock{
+		Version: spec.DataVersionAltair,
+		Altair: &altair.SignedBeaconBlock{
+			Message: &altair.BeaconBlock{
+				Slot: 2,
+				Body: &altair.BeaconBlockBody{
+					ETH1Data:      &phase0.ETH1Data{BlockHash: make([]byte, 32)},
+					Attestations:  attestations(),
+					SyncAggregate: &altair.SyncAggregate{SyncCommitteeBits: make([]byte, 64)},
+				},
+			},
+		},
+	}
+
+	bellatrixBlock := testBellatrixBlock(3, phase0.Hash32{1}).VersionedSignedBeaconBlock
+	bellatrixBlock.Bellatrix.Message.Body.Attestations = attestations()
+	bellatrixBlock.Bellatrix.Message.Body.ExecutionPayload.Transactions = []bellatrix.Transaction{{0x02}}
+
+	capellaBlock := &spec.VersionedSignedBeaconBlock{
+		Version: spec.DataVersionCapella,
+		Capella: &capella.SignedBeaconBlock{
+			Message: &capella.BeaconBlock{
+				Slot: 4,
+				Body: &capella.BeaconBlockBody{
+					ETH1Data:      &phase0.ETH1Data{BlockHash: make([]byte, 32)},
+					Attestations:  attestations(),
+					SyncAggregate: &altair.SyncAggregate{SyncCommitteeBits: make([]byte, 64)},
+					ExecutionPayload: &capella.ExecutionPayload{
+						BlockHash:    phase0.Hash32{1},
+						Transactions: []bellatrix.Transaction{{0x02}},
+					},
+				},
+			},
+		},
+	}
+
+	denebBlock := &spec.VersionedSignedBeaconBlock{
+		Version: spec.DataVersionDeneb,
+		Deneb: &deneb.SignedBeaconBlock{
+			Message: &deneb.BeaconBlock{
+				Slot: 5,
+				Body: &deneb.BeaconBlockBody{
+					ETH1Data:      &phase0.ETH1Data{BlockHash: make([]byte, 32)},
+					Attestations:  attestations(),
+					SyncAggregate: &altair.SyncAggregate{SyncCommitteeBits: make([]byte, 64)},
+					ExecutionPayload: &deneb.ExecutionPayload{
+						BaseFeePerGas: uint256.NewInt(0),
+						BlockHash:     phase0.Hash32{1},
+						Transactions:  []bellatrix.Transaction{{0x02}},
+					},
+				},
+			},
+		},
+	}
+
+	var electraAttestations []*electra.Attestation
+	for i := 0; i < 3; i++ {
+		electraAttestations = append(electraAttestations, &electra.Attestation{
+			AggregationBits: []byte{0x01},
+			Data: &phase0.AttestationData{
+				Slot:   phase0.Slot(i),
+				Source: &phase0.Checkpoint{},
+				Target: &phase0.Checkpoint{},
+			},
+			CommitteeBits: []byte{0x05, 0, 0, 0, 0, 0, 0, 0},
+		})
+	}
+	electraBlock := &spec.VersionedSignedBeaconBlock{
+		Version: spec.DataVersionElectra,
+		Electra: &electra.SignedBeaconBlock{
+			Message: &electra.BeaconBlock{
+				Slot: 6,
+				Body: &electra.BeaconBlockBody{
+					ETH1Data:      &phase0.ETH1Data{BlockHash: make([]byte, 32)},
+					Attestations:  electraAttestations,
+					SyncAggregate: &altair.SyncAggregate{SyncCommitteeBits: make([]byte, 64)},
+					ExecutionPayload: &deneb.ExecutionPayload{
+						BaseFeePerGas: uint256.NewInt(0),
+						BlockHash:     phase0.Hash32{1},
+						Transactions:  []bellatrix.Transaction{{0x02}},
+					},
+					ExecutionRequests: &electra.ExecutionRequests{
+						Deposits: []*electra.DepositRequest{{WithdrawalCredentials: make([]byte, 32), Amount: 32000000000}},
+					},
+				},
+			},
+		},
+	}
+
+	return []*spec.VersionedSignedBeaconBlock{phase0Block, altairBlock, bellatrixBlock, capellaBlock, denebBlock, electraBlock}
+}
+
+func TestForkNumber(t *testing.T) {
+	require.Equal(t, uint64(0), forkNumber(spec.DataVersionPhase0))
+	require.Equal(t, uint64(2), forkNumber(spec.DataVersionBellatrix))
+	require.Equal(t, uint64(5), forkNumber(spec.DataVersionElectra))
+	for _, block := range testForkBlocks() {
+		require.Equal(t, block.Version, forkOfNumber(forkNumber(block.Version)))
+	}
+}
+
+func TestMarshalBlock(t *testing.T) {
+	for _, block := range testForkBlocks() {
+		t.Run(block.Version.String(), func(t *testing.T) {
+			data, err := marshalBlock(block)
+			require.NoError(t, err)
+			decoded, err := unmarshalBlock(block.Version, data)
+			require.NoError(t, err)
+			require.Equal(t, block.Version, decoded.Version)
+
+			// Compare roots, since decoding turns nil lists into empty ones.
+			root, err := block.Root()
+			require.NoError(t, err)
+			decodedRoot, err := decoded.Root()
+			require.NoError(t, err)
+			require.Equal(t, root, decodedRoot)
+		})
+	}
+
+	_, err := marshalBlock(&spec.VersionedSignedBeaconBlock{Version: spec.DataVersion(99)})
+	require.Error(t, err)
+	_, err = unmarshalBlock(spec.DataVersion(99), nil)
+	require.Error(t, err)
+}
+
+func TestMessageFields(t *testing.T) {
+	for _, block := range testForkBlocks() {
+		t.Run(block.Version.String(), func(t *testing.T) {
+			fields, err := messageFields(block)
+			require.NoError(t, err)
+			slot, err := block.Slot()
+			require.NoError(t, err)
+			require.Equal(t, slot, fields.Slot)
+			require.Len(t, fields.Attestations, 3)
+			if block.Version >= spec.DataVersionBellatrix {
+				require.Equal(t, phase0.Hash32{1}, fields.ExecutionPayload.BlockHash)
+			} else {
+				require.Nil(t, fields.ExecutionPayload)
+			}
+			if block.Version == spec.DataVersionElectra {
+				require.Len(t, fields.ExecutionRequests.Deposits, 1)
+				_, _, committees, err := attestationBits(fields.Attestations[0])
+				require.NoError(t, err)
+				require.Equal(t, []phase0.CommitteeIndex{0, 2}, committees)
+			} else {
+				require.Nil(t, fields.ExecutionRequests)
+			}
+		})
+	}
+}
+
+func TestBlockData(t *testing.T) {
+	for _, block := range testForkBlocks() {
+		t.Run(block.Version.String(), func(t *testing.T) {
+			opts := blockOptions{hideTransactions: true, attestationsOffset: 1, attestationsLimit: 1}
+			data := blockData(block, opts)
+			trimmed := &spec.VersionedSignedBeaconBlock{Version: block.Version}
+			switch block.Version {
+			case spec.DataVersionPhase0:
+				trimmed.Phase0 = data.(*phase0.SignedBeaconBlock)
+			case spec.DataVersionAltair:
+				trimmed.Altair = data.(*altair.SignedBeaconBlock)
+			case spec.DataVersionBellatrix:
+				trimmed.Bellatrix = data.(*bellatrix.SignedBeaconBlock)
+			case spec.DataVersionCapella:
+				trimmed.Capella = data.(*capella.SignedBeaconBlock)
+			case spec.DataVersionDeneb:
+				trimmed.Deneb = data.(*deneb.SignedBeaconBlock)
+			case spec.DataVersionElectra:
+				trimmed.Electra = data.(*electra.SignedBeaconBlock)
+			}
+
+			fields, err := messageFields(trimmed)
+			require.NoError(t, err)
+			require.Len(t, fields.Attestations, 1)
+			attestationData, _, _, err := attestationBits(fields.Attestations[0])
+			require.NoError(t, err)
+			require.Equal(t, phase0.Slot(1), attestationData.Slot)
+			if fields.ExecutionPayload != nil {
+				require.Empty(t, fields.ExecutionPayload.Transactions)
+			}
+
+			// The original block is left intact.
+			fields, err = messageFields(block)
+			require.NoError(t, err)
+			require.Len(t, fields.Attestations, 3)
+			if fields.ExecutionPayload != nil {
+				require.Len(t, fields.ExecutionPayload.Transactions, 1)
+			}
+		})
+	}
+}
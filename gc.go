@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/labstack/echo"
+)
+
+// GCResult describes a value log GC run.
+type GCResult struct {
+	Rewrites  int
+	Reclaimed int64
+	Duration  time.Duration
+	Finished  time.Time
+}
+
+// RunGC rewrites value log files of which at least discardRatio is garbage,
+// until there are none left, and returns how much space it reclaimed. Runs
+// are serialized, so an on-demand run waits for a scheduled one to finish.
+func (s *Store) RunGC(discardRatio float64) (result GCResult, err error) {
+	s.gcMu.Lock()
+	defer s.gcMu.Unlock()
+
+	start := time.Now()
+	sizeBefore := s.vlogSize()
+	for {
+		err = s.db.RunValueLogGC(discardRatio)
+		if err != nil {
+			break
+		}
+		result.Rewrites++
+	}
+	if err == badger.ErrNoRewrite || err == badger.ErrGCInMemoryMode {
+		err = nil
+	} else {
+		componentLogger("store", s.network).Error().Err(err).Msg("failed to run value log GC")
+	}
+	result.Duration = time.Since(start)
+	result.Reclaimed = sizeBefore - s.vlogSize()
+	result.Finished = time.Now()
+	s.lastGC.Store(result)
+	componentLogger("store", s.network).Info().Int("rewrites", result.Rewrites).Int64("reclaimed_bytes", result.Reclaimed).Dur("duration", result.Duration).Msg("ran value log GC")
+	metricGCDuration.WithLabelValues(s.network).Observe(result.Duration.Seconds())
+	return result, err
+}
+
+// DBReport describes the space used by a store.
+type DBReport struct {
+	LSMBytes  int64
+	VlogBytes int64
+	Levels    []badger.LevelInfo
+
+	// LastGC is the last value log GC run since the store was opened, if any.
+	LastGC *GCResult
+}
+
+// Report returns the store's space usage, by the LSM tree (which is up to a
+// minute out of date) and the value log, along with the LSM tree's levels.
+func (s *Store) Report() DBReport {
+	report := DBReport{
+		VlogBytes: s.vlogSize(),
+		Levels:    s.db.Levels(),
+	}
+	report.LSMBytes, _ = s.db.Size()
+	if result, ok := s.lastGC.Load().(GCResult); ok {
+		report.LastGC = &result
+	}
+	return report
+}
+
+// vlogSize returns the size of the value log files on disk. Unlike
+// badger's DB.Size, it isn't up to a minute out of date.
+func (s *Store) vlogSize() (size int64) {
+	opts := s.db.Opts()
+	if opts.InMemory {
+		return 0
+	}
+	files, _ := filepath.Glob(filepath.Join(opts.ValueDir, "*.vlog"))
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// dbHandler reports the space used by the network's store.
+func dbHandler(c echo.Context) error {
+	store, err := getStore(c.Param("network"))
+	if err != nil {
+		return err
+	}
+	report := store.Report()
+	levels := make([]map[string]interface{}, len(report.Levels))
+	for i, level := range report.Levels {
+		levels[i] = map[string]interface{}{
+			"level":       level.Level,
+			"tables":      level.NumTables,
+			"bytes":       level.Size,
+			"target_size": level.TargetSize,
+			"score":       level.Score,
+			"stale_bytes": level.StaleDatSize,
+		}
+	}
+	var lastGC map[string]interface{}
+	if report.LastGC != nil {
+		lastGC = map[string]interface{}{
+			"finished":         report.LastGC.Finished,
+			"rewrites":         report.LastGC.Rewrites,
+			"reclaimed_bytes":  report.LastGC.Reclaimed,
+			"duration_seconds": report.LastGC.Duration.Seconds(),
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"lsm_bytes":  report.LSMBytes,
+		"vlog_bytes": report.VlogBytes,
+		"levels":     levels,
+		"last_gc":    lastGC,
+	})
+}
+
+// gcHandler runs value log GC on the network's store, with the discard
+// ratio given by the ratio param.
+func gcHandler(c echo.Context) error {
+	ratio := gcDiscardRatio
+	if param := c.QueryParam("ratio"); param != "" {
+		var err error
+		ratio, err = strconv.ParseFloat(param, 64)
+		if err != nil || ratio <= 0 || ratio >= 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid ratio")
+		}
+	}
+	store, err := getStore(c.Param("network"))
+	if err != nil {
+		return err
+	}
+	result, err := store.RunGC(ratio)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"rewrites":         result.Rewrites,
+		"reclaimed_bytes":  result.Reclaimed,
+		"duration_seconds": result.Duration.Seconds(),
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunGC(t *testing.T) {
+	store, err := OpenStore(t.TempDir(), "gc")
+	require.NoError(t, err)
+	defer store.Close()
+
+	for slot := phase0.Slot(0); slot < 100; slot++ {
+		require.NoError(t, store.SetBlock(slot, testBlock(slot)))
+	}
+	_, err = store.Purge(0, 100)
+	require.NoError(t, err)
+
+	// Runs don't overlap, and find nothing to rewrite in a fresh value log.
+	results := make(chan GCResult, 2)
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			result, err := store.RunGC(gcDiscardRatio)
+			results <- result
+			errs <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		result := <-results
+		require.NoError(t, <-errs)
+		require.Zero(t, result.Rewrites)
+		require.Positive(t, result.Duration)
+	}
+}
+
+func TestGCHandlerRatio(t *testing.T) {
+	for _, ratio := range []string{"0", "1", "x", "-0.5"} {
+		req := httptest.NewRequest(http.MethodPost, "/?ratio="+ratio, nil)
+		err := gcHandler(echo.New().NewContext(req, httptest.NewRecorder()))
+		require.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code, ratio)
+	}
+}
+
+func TestDBHandler(t *testing.T) {
+	const network = "db"
+	store, err := OpenStore(t.TempDir(), network)
+	require.NoError(t, err)
+	defer store.Close()
+	stores.Set(network, store)
+	t.Cleanup(func() { stores.Del(network) })
+	for slot := phase0.Slot(0); slot < 10; slot++ {
+		require.NoError(t, store.SetBlock(slot, testBlock(slot)))
+	}
+
+	get := func() map[string]interface{} {
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+		c.SetParamNames("network")
+		c.SetParamValues(network)
+		require.NoError(t, dbHandler(c))
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp
+	}
+	resp := get()
+	require.NotEmpty(t, resp["levels"])
+	require.Positive(t, resp["vlog_bytes"])
+
+	_, err = store.RunGC(gcDiscardRatio)
+	require.NoError(t, err)
+	lastGC := get()["last_gc"].(map[string]interface{})
+	require.Contains(t, lastGC, "finished")
+	require.Equal(t, float64(0), lastGC["rewrites"])
+}
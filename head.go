@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/labstack/echo"
+)
+
+const (
+	headerBlockRoot = "X-Block-Root"
+	headerEmpty     = "X-Empty"
+)
+
+// slotHeadHandler answers HEAD /:network/:slot from the slot's record header,
+// without reading its block: 200 if the slot is scraped (even if it was
+// invalidated since, as GET serves it until it's refetched), with whether it's
+// empty and, if it isn't, its block's version, root and whether it's blinded,
+// or 404 if it isn't scraped. Its ETag is that of the representation GET
+// would serve for the request.
+func slotHeadHandler(c echo.Context) error {
+	slot, err := strconv.ParseUint(c.Param("slot"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid slot")
+	}
+	store, err := getStore(c.Param("network"))
+	if err != nil {
+		return err
+	}
+	header, ok, err := store.BlockHeader(phase0.Slot(slot))
+	if err == badger.ErrKeyNotFound {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	h := c.Response().Header()
+	h.Set(headerEmpty, strconv.FormatBool(!ok))
+	if !ok {
+		return c.NoContent(http.StatusOK)
+	}
+	root := fmt.Sprintf("%#x", header.Root)
+	h.Set("Eth-Consensus-Version", strings.ToLower(header.Version.String()))
+	h.Set(headerBlockRoot, root)
+	setBlindedHeader(c, header.Blinded)
+	annotations, err := setAnnotationsHeader(c, store, phase0.Slot(slot))
+	if err != nil {
+		return err
+	}
+	notModified, err := checkNotModified(c, store, phase0.Slot(slot), blockETag(root, blockRepresentation(c.Request()), annotations), annotations != "")
+	if err != nil {
+		return err
+	}
+	if notModified {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.NoContent(http.StatusOK)
+}
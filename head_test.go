@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlotHeadHandler(t *testing.T) {
+	const network = "head"
+	store := newTestStore(t)
+	stores.Set(network, store)
+	t.Cleanup(func() { stores.Del(network) })
+
+	block := testBellatrixBlock(1, phase0.Hash32{1})
+	block.BlockRoot = phase0.Root{1, 2, 3}
+	require.NoError(t, store.SetBlocks(map[phase0.Slot]*BlockWithRoot{
+		1: block,
+		2: nil,
+		3: testBlock(3),
+	}))
+	_, err := store.Invalidate(3, 3)
+	require.NoError(t, err)
+
+	e := echo.New()
+	head := func(slot, ifNoneMatch string, accept ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodHead, "/"+network+"/"+slot, nil)
+		for _, accept := range accept {
+			req.Header.Set(echo.HeaderAccept, accept)
+		}
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("network", "slot")
+		c.SetParamValues(network, slot)
+		if err := slotHeadHandler(c); err != nil {
+			e.HTTPErrorHandler(err, c)
+		}
+		return rec
+	}
+
+	rec := head("1", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Body.Bytes())
+	require.Equal(t, "false", rec.Header().Get(headerEmpty))
+	require.Equal(t, "bellatrix", rec.Header().Get("Eth-Consensus-Version"))
+	require.Equal(t, "0x0102030000000000000000000000000000000000000000000000000000000000", rec.Header().Get(headerBlockRoot))
+	require.Empty(t, rec.Header().Get(headerBlinded))
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	require.Equal(t, http.StatusNotModified, head("1", etag).Code)
+
+	// The ETag is that of the representation GET would serve.
+	require.Equal(t, blockETag("0x0102030000000000000000000000000000000000000000000000000000000000", "json", ""), etag)
+	rec = head("1", "", echo.MIMEOctetStream)
+	require.Equal(t, blockETag("0x0102030000000000000000000000000000000000000000000000000000000000", "ssz", ""), rec.Header().Get("ETag"))
+	rec = head("1", "", mimeYAML)
+	require.Equal(t, blockETag("0x0102030000000000000000000000000000000000000000000000000000000000", "yaml", ""), rec.Header().Get("ETag"))
+	require.Equal(t, http.StatusOK, head("1", etag, mimeYAML).Code)
+
+	rec = head("2", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "true", rec.Header().Get(headerEmpty))
+	require.Empty(t, rec.Header().Get(headerBlockRoot))
+
+	// Invalidated slots are served until they're refetched, as by GET, while
+	// unscraped slots aren't there.
+	rec = head("3", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "phase0", rec.Header().Get("Eth-Consensus-Version"))
+	require.Equal(t, http.StatusNotFound, head("4", "").Code)
+	require.Equal(t, http.StatusBadRequest, head("x", "").Code)
+}
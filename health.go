@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+// networkReadiness is the readiness of a network to serve its blocks.
+type networkReadiness struct {
+	Ready     bool    `json:"ready"`
+	StoreOpen bool    `json:"store_open"`
+	LagSlots  *uint64 `json:"lag_slots"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// readiness returns whether the network's store is open and scraped to
+// within maxLag slots of head.
+func readiness(network NetworkConfig, maxLag uint64) networkReadiness {
+	store, ok := stores.Get(network.Name)
+	if !ok {
+		return networkReadiness{}
+	}
+	r := networkReadiness{StoreOpen: true}
+	lag, ok, err := lagSlots(store, network)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	if ok {
+		r.LagSlots = &lag
+		r.Ready = lag <= maxLag
+	}
+	return r
+}
+
+// healthzHandler reports that the server is alive.
+func healthzHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyzHandler reports whether every configured network is ready, with
+// 503 Service Unavailable if any isn't.
+func readyzHandler(c echo.Context) error {
+	ready := true
+	details := make(map[string]networkReadiness)
+	networks.Range(func(name string, network NetworkConfig) bool {
+		details[name] = readiness(network, *readyLagSlots)
+		ready = ready && details[name].Ready
+		return true
+	})
+	code := http.StatusOK
+	if !ready {
+		code = http.StatusServiceUnavailable
+	}
+	return c.JSON(code, map[string]interface{}{
+		"ready":    ready,
+		"networks": details,
+	})
+}
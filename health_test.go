@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadiness(t *testing.T) {
+	network := NetworkConfig{Name: "readiness"}
+	require.Equal(t, networkReadiness{}, readiness(network, 16))
+
+	store := newTestStore(t)
+	stores.Set(network.Name, store)
+	t.Cleanup(func() { stores.Del(network.Name) })
+
+	// Not ready until the spec and the first slot are stored.
+	require.Equal(t, networkReadiness{StoreOpen: true}, readiness(network, 16))
+
+	require.NoError(t, store.SetSpec(&NetworkSpec{
+		GenesisTime:    time.Now().Add(-100 * 12 * time.Second),
+		SecondsPerSlot: 12,
+		SlotsPerEpoch:  32,
+	}))
+	require.NoError(t, store.SetBlock(50, testBlock(50)))
+	r := readiness(network, 16)
+	require.False(t, r.Ready)
+	require.Equal(t, uint64(50), *r.LagSlots)
+
+	require.NoError(t, store.SetBlock(90, testBlock(90)))
+	r = readiness(network, 16)
+	require.True(t, r.Ready)
+	require.Equal(t, uint64(10), *r.LagSlots)
+	// The node's head slot takes precedence over the clock.
+	require.NoError(t, store.SetHeadSlot(120))
+	r = readiness(network, 16)
+	require.False(t, r.Ready)
+	require.Equal(t, uint64(30), *r.LagSlots)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/labstack/echo"
+)
+
+const (
+	// How long clients may cache finalized slots, which never change.
+	finalizedMaxAge = 365 * 24 * time.Hour
+
+	// How long clients may cache other slots, which may still be reorged.
+	unfinalizedMaxAge = 12 * time.Second
+)
+
+// blockETag returns the ETag of a representation of the block with the given
+// (hex) root, and of the slot's (form-encoded) annotations if it's sent with
+// them, since they may change while the block doesn't. It's weak, since the
+// response may be gzipped or not.
+func blockETag(root, representation, annotations string) string {
+	if annotations == "" {
+		return fmt.Sprintf(`W/"%s-%s"`, root, representation)
+	}
+	h := fnv.New64a()
+	h.Write([]byte(annotations))
+	return fmt.Sprintf(`W/"%s-%s-%x"`, root, representation, h.Sum64())
+}
+
+// blockRepresentation returns the representation of the block which GET
+// /:network/:slot serves for the request, as named in its ETag.
+func blockRepresentation(r *http.Request) string {
+	switch {
+	case acceptsSSZ(r):
+		return "ssz"
+	case acceptsYAML(r):
+		return "yaml"
+	}
+	return "json"
+}
+
+// checkNotModified sets the caching headers of a response for the given slot,
+// which is immutable once finalized unless it's annotated, and returns whether
+// the client's copy matches the ETag, in which case the caller should respond
+// with 304. Annotated slots are revalidated on every use instead, since their
+// annotations may change at any time.
+func checkNotModified(c echo.Context, store *Store, slot phase0.Slot, etag string, annotated bool) (bool, error) {
+	finalizedSlot, ok, err := store.FinalizedSlot()
+	if err != nil {
+		return false, err
+	}
+	header := c.Response().Header()
+	header.Add(echo.HeaderVary, echo.HeaderAccept)
+	header.Set("ETag", etag)
+	switch {
+	case annotated:
+		header.Set("Cache-Control", "public, no-cache")
+	case ok && slot <= finalizedSlot:
+		header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int(finalizedMaxAge.Seconds())))
+	default:
+		header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(unfinalizedMaxAge.Seconds())))
+	}
+	return etagMatches(c.Request().Header.Get("If-None-Match"), etag), nil
+}
+
+// etagMatches returns whether the If-None-Match header matches the ETag,
+// comparing weakly as RFC 7232 prescribes for it.
+func etagMatches(ifNoneMatch, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckNotModified(t *testing.T) {
+	store := newTestStore(t)
+	require.NoError(t, store.SetFinalized(&phase0.Checkpoint{Epoch: 1}))
+	etag := blockETag(fmt.Sprintf("%#x", phase0.Root{1}), "json", "")
+	require.Equal(t, `W/"0x0100000000000000000000000000000000000000000000000000000000000000-json"`, etag)
+
+	check := func(slot phase0.Slot, ifNoneMatch string, annotated bool) (bool, http.Header) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		notModified, err := checkNotModified(echo.New().NewContext(req, rec), store, slot, etag, annotated)
+		require.NoError(t, err)
+		return notModified, rec.Header()
+	}
+
+	// Slots up to the start of the finalized epoch are immutable.
+	notModified, header := check(defaultSlotsPerEpoch, "", false)
+	require.False(t, notModified)
+	require.Equal(t, etag, header.Get("ETag"))
+	require.Equal(t, "public, max-age=31536000, immutable", header.Get("Cache-Control"))
+	_, header = check(defaultSlotsPerEpoch+1, "", false)
+	require.Equal(t, "public, max-age=12", header.Get("Cache-Control"))
+
+	// Annotated slots are revalidated, since their annotations may change.
+	_, header = check(defaultSlotsPerEpoch, "", true)
+	require.Equal(t, "public, no-cache", header.Get("Cache-Control"))
+
+	for ifNoneMatch, want := range map[string]bool{
+		etag:               true,
+		etag[2:]:           true,
+		`"other", ` + etag: true,
+		"*":                true,
+		`W/"0x01-ssz"`:     false,
+		`"other"`:          false,
+	} {
+		notModified, _ := check(1, ifNoneMatch, false)
+		require.Equal(t, want, notModified, ifNoneMatch)
+	}
+
+	// The ETag of annotated blocks changes along with their annotations.
+	annotated := blockETag(fmt.Sprintf("%#x", phase0.Root{1}), "json", "tag=reorg")
+	require.NotEqual(t, etag, annotated)
+	require.NotEqual(t, annotated, blockETag(fmt.Sprintf("%#x", phase0.Root{1}), "json", "tag=big-mev"))
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/binary"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// Secondary indexes map a key derived from a block to its slot. The keys
+// indexed for each slot are recorded under keyIndexes, so that they can be
+// removed when the slot is overwritten or purged. Keys which aren't unique
+// to a block, such as its proposer index, end with the slot to make them so.
+
+// writer is implemented by both badger.Txn and badger.WriteBatch.
+type writer interface {
+	Set(key, value []byte) error
+	Delete(key []byte) error
+}
+
+// indexKeys returns the secondary index keys of the block at the given slot.
+func indexKeys(slot phase0.Slot, block *BlockWithRoot) [][]byte {
+	if block == nil {
+		return nil
+	}
+	var keys [][]byte
+	if block.BlockRoot != (phase0.Root{}) {
+		keys = append(keys, append(append([]byte{}, keyBlockRoot...), block.BlockRoot[:]...))
+	}
+	fields, err := messageFields(block.VersionedSignedBeaconBlock)
+	if err != nil {
+		return keys
+	}
+	if fields.ExecutionPayload != nil {
+		hash := fields.ExecutionPayload.BlockHash
+		if hash != (phase0.Hash32{}) {
+			keys = append(keys, append(append([]byte{}, keyExecutionHash...), hash[:]...))
+		}
+	}
+	keys = append(keys, proposerKey(fields.ProposerIndex, slot))
+	return keys
+}
+
+// proposerKey returns the proposer index key of the block at the given slot.
+func proposerKey(index phase0.ValidatorIndex, slot phase0.Slot) []byte {
+	key := make([]byte, len(keyProposer)+16)
+	copy(key, keyProposer)
+	binary.BigEndian.PutUint64(key[len(keyProposer):], uint64(index))
+	binary.BigEndian.PutUint64(key[len(keyProposer)+8:], uint64(slot))
+	return key
+}
+
+// indexedKeys returns the secondary index keys currently recorded for the slot.
+func indexedKeys(txn *badger.Txn, slot phase0.Slot) ([][]byte, error) {
+	item, err := txn.Get(slotKey(keyIndexes, slot))
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	val, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+	var keys [][]byte
+	for len(val) > 0 {
+		n := int(val[0])
+		if len(val) < 1+n {
+			return nil, errors.New("corrupt index record")
+		}
+		keys = append(keys, val[1:1+n])
+		val = val[1+n:]
+	}
+	return keys, nil
+}
+
+// writeIndexes replaces the slot's previously indexed keys with the given keys.
+func writeIndexes(w writer, slot phase0.Slot, prevKeys, keys [][]byte) error {
+	for _, key := range prevKeys {
+		if err := w.Delete(key); err != nil {
+			return err
+		}
+	}
+	if len(keys) == 0 {
+		return w.Delete(slotKey(keyIndexes, slot))
+	}
+
+	var slotBytes [8]byte
+	binary.BigEndian.PutUint64(slotBytes[:], uint64(slot))
+	var record []byte
+	for _, key := range keys {
+		if err := w.Set(key, slotBytes[:]); err != nil {
+			return err
+		}
+		record = append(record, byte(len(key)))
+		record = append(record, key...)
+	}
+	return w.Set(slotKey(keyIndexes, slot), record)
+}
+
+// lookupIndex returns the slot indexed under the given key.
+func (s *Store) lookupIndex(key []byte) (slot phase0.Slot, err error) {
+	err = s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			slot = phase0.Slot(binary.BigEndian.Uint64(val))
+			return nil
+		})
+	})
+	return
+}
+
+// BlockByRoot returns the block with the given block root, along with its slot.
+func (s *Store) BlockByRoot(root phase0.Root) (phase0.Slot, *BlockWithRoot, error) {
+	slot, err := s.lookupIndex(append(append([]byte{}, keyBlockRoot...), root[:]...))
+	if err != nil {
+		return 0, nil, err
+	}
+	block, err := s.Block(slot)
+	return slot, block, err
+}
+
+// BlockByExecutionHash returns the block whose execution payload has the given
+// block hash, along with its slot.
+func (s *Store) BlockByExecutionHash(hash []byte) (phase0.Slot, *BlockWithRoot, error) {
+	slot, err := s.lookupIndex(append(append([]byte{}, keyExecutionHash...), hash...))
+	if err != nil {
+		return 0, nil, err
+	}
+	block, err := s.Block(slot)
+	return slot, block, err
+}
+
+// ProposerSlots returns the slots within the given range (inclusive) of the
+// blocks proposed by the given validator.
+func (s *Store) ProposerSlots(index phase0.ValidatorIndex, from, to phase0.Slot) ([]phase0.Slot, error) {
+	slots := []phase0.Slot{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = proposerKey(index, 0)[:len(keyProposer)+8]
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(proposerKey(index, from)); it.Valid(); it.Next() {
+			key := it.Item().Key()
+			slot := phase0.Slot(binary.BigEndian.Uint64(key[len(opts.Prefix):]))
+			if slot > to {
+				break
+			}
+			slots = append(slots, slot)
+		}
+		return nil
+	})
+	return slots, err
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+)
+
+// The scrape lease names the instance scraping a store. It's kept outside the
+// store, in <data-dir>/<network>.lease, since Badger is single-process: a
+// second process can't open the store to find a lease in it, or on network
+// mounts where Badger's directory lock doesn't hold, it could open the store
+// but not tell whether another process writes it. Its holder keeps the file
+// locked with flock, which keeps out other processes on the same host, and
+// writes the lease to it every leaseRenewInterval, which keeps out those on
+// other hosts where the lock doesn't hold. An instance which finds it held by
+// another serves the store read-only until it expires, leaseTTL after its
+// last renewal (such as after its holder was killed).
+
+const (
+	leaseTTL           = 30 * time.Second
+	leaseRenewInterval = leaseTTL / 3
+)
+
+// instanceID identifies this process as a holder of scrape leases.
+var instanceID = newInstanceID()
+
+func newInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	var nonce [4]byte
+	_, _ = rand.Read(nonce[:])
+	return fmt.Sprintf("%s/%d/%x", host, os.Getpid(), nonce)
+}
+
+// Lease is a store's scrape lease.
+type Lease struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+// leaseFile is a store's scrape lease file.
+type leaseFile struct {
+	path string
+
+	mu sync.Mutex
+	// file is open and locked while held by holder in this process.
+	file   *os.File
+	holder string
+}
+
+func newLeaseFile(path string) *leaseFile {
+	return &leaseFile{path: path}
+}
+
+// read returns the lease written to the file, or nil if there's none, even
+// if it expired.
+func (l *leaseFile) read() (*Lease, error) {
+	data, err := os.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var lease Lease
+	if err := json.Unmarshal(data, &lease); err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+// unlock closes the file, which releases its lock. l.mu must be held.
+func (l *leaseFile) unlock() error {
+	err := l.file.Close()
+	l.file, l.holder = nil, ""
+	return err
+}
+
+// Lease returns the store's scrape lease, or nil if it has none or it expired.
+// In-memory stores can't be shared, so they have none.
+func (s *Store) Lease() (*Lease, error) {
+	if s.lease == nil {
+		return nil, nil
+	}
+	lease, err := s.lease.read()
+	if err != nil || lease == nil || !time.Now().Before(lease.Expires) {
+		return nil, err
+	}
+	return lease, nil
+}
+
+// AcquireLease takes or renews the scrape lease for the holder, for the given
+// TTL. If another holder's lease hasn't expired, or another process on this
+// host holds the lease file, it's returned with ok=false.
+func (s *Store) AcquireLease(holder string, ttl time.Duration) (lease *Lease, ok bool, err error) {
+	if s.lease == nil {
+		return &Lease{Holder: holder, Expires: time.Now().Add(ttl)}, true, nil
+	}
+	l := s.lease
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil && l.holder != holder {
+		// Another holder in this process, which it's taken from once expired.
+		lease, err := l.read()
+		if err != nil || (lease != nil && time.Now().Before(lease.Expires)) {
+			return lease, false, err
+		}
+		l.holder = holder
+	}
+	if l.file == nil {
+		file, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, false, err
+		}
+		if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			file.Close()
+			if err != syscall.EWOULDBLOCK {
+				return nil, false, errors.Wrap(err, "failed to lock lease file")
+			}
+			// Whatever the file says, its lock holds.
+			lease, err := l.read()
+			if err != nil || lease == nil {
+				lease = &Lease{Holder: "another process"}
+			}
+			return lease, false, nil
+		}
+		l.file, l.holder = file, holder
+	}
+
+	// The lock doesn't hold across hosts on some mounts, so check that no
+	// other holder took over, such as after this one failed to renew.
+	lease, err = l.read()
+	if err != nil {
+		return nil, false, err
+	}
+	if lease != nil && lease.Holder != holder && time.Now().Before(lease.Expires) {
+		return lease, false, l.unlock()
+	}
+	lease = &Lease{Holder: holder, Expires: time.Now().Add(ttl)}
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := l.file.Truncate(0); err != nil {
+		return nil, false, err
+	}
+	if _, err := l.file.WriteAt(data, 0); err != nil {
+		return nil, false, err
+	}
+	if err := l.file.Sync(); err != nil {
+		return nil, false, err
+	}
+	return lease, true, nil
+}
+
+// ReleaseLease gives up the holder's scrape lease, so that another instance
+// can take it without waiting for it to expire. Another holder's lease is
+// left alone.
+func (s *Store) ReleaseLease(holder string) error {
+	if s.lease == nil {
+		return nil
+	}
+	l := s.lease
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil || l.holder != holder {
+		return nil
+	}
+	if err := l.file.Truncate(0); err != nil {
+		l.unlock()
+		return err
+	}
+	return l.unlock()
+}
+
+// scrapeWithLease runs the network's scraping tasks while this instance
+// holds the store's scrape lease, renewing it meanwhile, and releases it once
+// the context is done. Until it holds the lease, the store is only served.
+func scrapeWithLease(ctx context.Context, store *Store, network NetworkConfig) {
+	log := componentLogger("lease", network.Name)
+	ticker := time.NewTicker(leaseRenewInterval)
+	defer ticker.Stop()
+
+	var (
+		stop    func()
+		renewed time.Time
+		holder  string
+	)
+	defer func() {
+		if stop != nil {
+			stop()
+		}
+		if err := store.ReleaseLease(instanceID); err != nil {
+			log.Error().Err(err).Msg("failed to release scrape lease")
+		}
+	}()
+	for {
+		lease, ok, err := store.AcquireLease(instanceID, leaseTTL)
+		switch {
+		case err != nil:
+			log.Error().Err(err).Msg("failed to renew scrape lease")
+			// Once the lease may have expired, another instance may take it.
+			if stop != nil && time.Since(renewed) >= leaseTTL {
+				log.Warn().Msg("scrape lease expired, serving read-only")
+				stop()
+				stop = nil
+			}
+		case ok:
+			renewed = time.Now()
+			holder = ""
+			if stop == nil {
+				log.Info().Msg("acquired scrape lease")
+				stop = runScrapeTasks(ctx, store, network)
+			}
+		case stop != nil:
+			log.Warn().Str("holder", lease.Holder).Msg("lost scrape lease, serving read-only")
+			stop()
+			stop = nil
+			holder = lease.Holder
+		case lease.Holder != holder:
+			log.Warn().Str("holder", lease.Holder).Time("expires", lease.Expires).
+				Msg("scrape lease is held by another instance, serving read-only")
+			holder = lease.Holder
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runScrapeTasks starts scraping the network, along with the tasks which go
+// with it, and returns a function which stops them and waits for them.
+func runScrapeTasks(ctx context.Context, store *Store, network NetworkConfig) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	var tasks sync.WaitGroup
+	run := func(fn func(ctx context.Context, store *Store, network NetworkConfig)) {
+		tasks.Add(1)
+		go func() {
+			defer tasks.Done()
+			fn(ctx, store, network)
+		}()
+	}
+	run(trackLag)
+	if !network.ExpireByTTL {
+		run(purgePeriodically)
+	}
+	run(scrapeContinuously)
+	return func() {
+		cancel()
+		tasks.Wait()
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newLeasedTestStore returns a test store with a scrape lease file, which
+// in-memory stores lack.
+func newLeasedTestStore(t *testing.T) *Store {
+	store := newTestStore(t)
+	store.lease = newLeaseFile(filepath.Join(t.TempDir(), "test.lease"))
+	return store
+}
+
+func TestLease(t *testing.T) {
+	store := newLeasedTestStore(t)
+	lease, err := store.Lease()
+	require.NoError(t, err)
+	require.Nil(t, lease)
+
+	lease, ok, err := store.AcquireLease("a", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "a", lease.Holder)
+
+	// Another holder can't take it, or release it, until it's released.
+	lease, ok, err = store.AcquireLease("b", time.Minute)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, "a", lease.Holder)
+	require.NoError(t, store.ReleaseLease("b"))
+	renewed, ok, err := store.AcquireLease("a", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.False(t, renewed.Expires.Before(lease.Expires))
+
+	require.NoError(t, store.ReleaseLease("a"))
+	lease, err = store.Lease()
+	require.NoError(t, err)
+	require.Nil(t, lease)
+	_, ok, err = store.AcquireLease("b", time.Second)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// Or until it expires.
+	require.Eventually(t, func() bool {
+		_, ok, err := store.AcquireLease("a", time.Minute)
+		require.NoError(t, err)
+		return ok
+	}, 3*time.Second, 50*time.Millisecond)
+
+	// Another process can't take it while its holder keeps the file locked.
+	other := &Store{lease: newLeaseFile(store.lease.path)}
+	lease, ok, err = other.AcquireLease("c", time.Minute)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, "a", lease.Holder)
+	require.NoError(t, store.ReleaseLease("a"))
+	lease, ok, err = other.AcquireLease("c", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "c", lease.Holder)
+	lease, err = store.Lease()
+	require.NoError(t, err)
+	require.Equal(t, "c", lease.Holder)
+	require.NoError(t, other.ReleaseLease("c"))
+}
+
+func TestScrapeWithLease(t *testing.T) {
+	store := newLeasedTestStore(t)
+	_, ok, err := store.AcquireLease("other", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// While another instance holds the lease, it's left to it.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scrapeWithLease(ctx, store, NetworkConfig{Name: "lease", NodeURL: "http://127.0.0.1:1"})
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+	lease, err := store.Lease()
+	require.NoError(t, err)
+	require.Equal(t, "other", lease.Holder)
+
+	// Otherwise it's taken, and released when done.
+	require.NoError(t, store.ReleaseLease("other"))
+	ctx, cancel = context.WithCancel(context.Background())
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		scrapeWithLease(ctx, store, NetworkConfig{Name: "lease", NodeURL: "http://127.0.0.1:1"})
+	}()
+	require.Eventually(t, func() bool {
+		lease, err := store.Lease()
+		require.NoError(t, err)
+		return lease != nil && lease.Holder == instanceID
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+	lease, err = store.Lease()
+	require.NoError(t, err)
+	require.Nil(t, lease)
+}
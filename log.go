@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+	zerologlog "github.com/rs/zerolog/log"
+)
+
+// logger is the shared logger, set up by setupLogger from -log-format.
+var logger = newLogger(consoleWriter())
+
+func newLogger(w io.Writer) zerolog.Logger {
+	return zerolog.New(w).With().Timestamp().Logger()
+}
+
+func consoleWriter() io.Writer {
+	return zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}
+}
+
+// setupLogger sets the shared logger to write in the given format (console
+// or json). The node client logs through it too.
+func setupLogger(format string) error {
+	switch format {
+	case "console":
+		logger = newLogger(consoleWriter())
+	case "json":
+		logger = newLogger(os.Stderr)
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	zerologlog.Logger = logger
+	return nil
+}
+
+// componentLogger returns the logger of a component, such as "scraper",
+// optionally for a network.
+func componentLogger(component, network string) *zerolog.Logger {
+	ctx := logger.With().Str("component", component)
+	if network != "" {
+		ctx = ctx.Str("network", network)
+	}
+	l := ctx.Logger()
+	return &l
+}
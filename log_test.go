@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/goccy/go-json"
+	zerologlog "github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponentLogger(t *testing.T) {
+	prev := logger
+	defer func() { logger = prev }()
+	var buf bytes.Buffer
+	logger = newLogger(&buf)
+
+	componentLogger("scraper", "prater").Info().Uint64("slot", 5).Msg("scraping")
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.Equal(t, "scraper", entry["component"])
+	require.Equal(t, "prater", entry["network"])
+	require.Equal(t, float64(5), entry["slot"])
+	require.Equal(t, "scraping", entry["message"])
+
+	buf.Reset()
+	componentLogger("config", "").Info().Msg("reloading config")
+	entry = nil
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.NotContains(t, entry, "network")
+}
+
+func TestSetupLogger(t *testing.T) {
+	prev, prevGlobal := logger, zerologlog.Logger
+	defer func() { logger, zerologlog.Logger = prev, prevGlobal }()
+	require.NoError(t, setupLogger("json"))
+	require.NoError(t, setupLogger("console"))
+	require.Error(t, setupLogger("xml"))
+}
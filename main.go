@@ -5,307 +5,1563 @@ import (
 	"encoding/hex"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"math"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	client "github.com/attestantio/go-eth2-client"
+	"github.com/attestantio/go-eth2-client/api"
+	apiv1 "github.com/attestantio/go-eth2-client/api/v1"
 	"github.com/attestantio/go-eth2-client/auto"
-	"github.com/attestantio/go-eth2-client/spec"
 	"github.com/attestantio/go-eth2-client/spec/phase0"
 	"github.com/cornelk/hashmap"
 	"github.com/dgraph-io/badger/v3"
 	"github.com/goccy/go-json"
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
-	"github.com/paulbellamy/ratecounter"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 )
 
 const (
-	secondsPerSlot = 12
+	// Slots per epoch of networks whose spec hasn't been fetched yet.
+	defaultSlotsPerEpoch = 32
 
-	// How many slots behind head to start scraping from.
-	// NOTE: Delete database after changing this.
-	scrapeSlots = 450 * 32 // 450 epochs (2 days)
+	// How many slots behind head to start scraping from, unless configured
+	// or given by -scrape-slots or -retention.
+	defaultScrapeSlots = 450 * 32 // 450 epochs (2 days)
 
-	// How many slots to fetch at once.
-	scrapeConcurrency = 16
+	// Seconds per slot to convert -retention to slots by, for networks which
+	// don't configure seconds_per_slot.
+	defaultSecondsPerSlot = 12
+
+	// How many slots to fetch at once, unless configured.
+	defaultScrapeConcurrency = 16
+
+	// How many slots behind head to wait for before fetching a slot, unless
+	// configured. Scraping always waited for 12 slots before it was
+	// configurable, so it stays the default.
+	defaultConfirmationDepth = 12
+
+	// Most slots that a single /gaps request may span. Gaps are read from the
+	// slot bitmaps rather than the blocks, so this is wider than -max-scan-slots.
+	maxGapRange = 450 * 32
+
+	// How many scraped slots to write at once.
+	scrapeBatchSize = 64
+
+	// How long to wait on shutdown for in-flight requests to be served
+	// and for the networks' in-flight writes to complete.
+	shutdownTimeout = 10 * time.Second
+
+	// Maximum number of slots served by the range endpoint.
+	maxRangeSlots = 128
+
+	// How often to purge slots which fell out of the retention window.
+	purgeInterval = time.Hour
+
+	// How long to wait before retrying to open a store that failed to open.
+	openStoreRetryInterval = time.Minute
+
+	// How often to update the scrape lag, and above how many slots to warn about it.
+	lagInterval     = 12 * time.Second
+	lagWarningSlots = 16
 )
 
-var targets = map[string]string{
-	// "prater": "http://prater-standalone.stage.bloxinfra.com:3500",
-	// "prater":  "http://localhost:3500",
-	"prater":  "http://eth2-lh-prater-5052.stage.bloxinfra.com",
-	"sepolia": "http://195.201.57.53:5052",
-	"mainnet": "http://mainnet-standalone.stage.bloxinfra.com:3500",
+// targets are the networks scraped when no config file is given. Their node
+// URLs can be overridden by BLOCKBUSTER_<NETWORK>_URL (see env.go), which
+// holesky's placeholder needs.
+var targets = map[string]string{
+	"holesky": "http://localhost:5052",
+	"mainnet": "http://mainnet-standalone.stage.bloxinfra.com:3500",
+	"sepolia": "http://195.201.57.53:5052",
+}
+
+var (
+	listenAddr       = flag.String("listen", ":8080", "address to serve HTTP on")
+	dataDir          = flag.String("data-dir", "./data", "directory to store the networks' databases in")
+	logLevel         = flag.String("log-level", "error", "log level of the beacon node client (trace, debug, info, warn or error)")
+	logFormat        = flag.String("log-format", "console", "format of the logs (console or json)")
+	configPath       = flag.String("config", "", "path to a JSON or YAML config file (defaults to built-in targets)")
+	cacheSize        = flag.Int("cache-size", 0, "how many decoded blocks to cache in memory (0 disables caching)")
+	summaryCacheSize = flag.Int("summary-cache-size", 10000, "how many block summaries (and participations) to cache in memory (0 disables caching)")
+	scrapeSlots      = flag.Uint64("scrape-slots", defaultScrapeSlots, "how many slots behind head to scrape from and keep, for networks which don't configure scrape_slots")
+	retention        = flag.Duration("retention", 0, "how far behind head to scrape from and keep, such as 48h, instead of -scrape-slots (converted to slots of each network's seconds_per_slot, or 12s)")
+	compression      = flag.String("compression", "snappy", "codec to compress new blocks with (snappy or zstd)")
+	adminToken       = flag.String("admin-token", "", "bearer token required by admin routes (empty disables them)")
+	readToken        = flag.String("read-token", "", "bearer token (or else -admin-token) required by every route but /healthz, /readyz and /metrics (empty leaves them open)")
+	rateLimit        = flag.Float64("rate-limit", 20, "requests per second allowed per client IP (0 disables rate limiting)")
+	rateBurst        = flag.Int("rate-burst", 100, "how many requests a client IP may make at once before being rate limited")
+	trustProxy       = flag.Bool("trust-proxy", false, "identify clients by the X-Forwarded-For header, when behind a reverse proxy")
+	readyLagSlots    = flag.Uint64("ready-lag-slots", lagWarningSlots, "how many slots behind head a network may be while /readyz reports it ready")
+	gzipMinSize      = flag.Int("gzip-min-size", 1024, "smallest response in bytes to gzip for clients which accept it (negative disables gzip)")
+	nodeTimeout      = flag.Duration("node-timeout", 10*time.Second, "how long to wait for each request to a beacon node")
+	validate         = flag.Bool("validate", false, "check that each network's node serves blocks which can be stored, then exit without writing anything")
+	maxScanSlots     = flag.Int("max-scan-slots", 8192, "most slots that a single request may scan for operations")
+	maxHeavy         = flag.Int("max-heavy-requests", 8, "how many range, epoch and scan requests may be served at once (0 disables the limit)")
+	maxResponseBytes = flag.Int("max-response-bytes", 0, "largest JSON block response before attestations are dropped from it, unless full=true (0 disables the cap)")
+	accessLog        = flag.Bool("access-log", false, "log HTTP requests")
+	accessLogSample  = flag.Int("access-log-sample", 1, "log only one in every this many HTTP requests, except for server errors")
+	noScrape         = flag.Bool("no-scrape", false, "serve the stored networks without connecting to their nodes, scraping or purging")
+	replicateFrom    = flag.String("replicate-from", "", "URL of a primary server to pull the networks' slots from, implying -no-scrape (authenticates with -admin-token)")
+	progressInterval = flag.Duration("progress-interval", time.Second, "how often to log each network's scraping progress (0 disables it)")
+	quiet            = flag.Bool("quiet", false, "log scraping progress only as per-minute summaries, counting failed block requests rather than logging each")
+	debug            = flag.Bool("debug", false, "serve routes for debugging storage, such as GET /:network/:slot/raw")
+)
+
+func init() {
+	flag.StringVar(dataDir, "datadir", *dataDir, "deprecated alias of -data-dir")
+}
+
+var (
+	networks           = hashmap.New[string, NetworkConfig]()
+	stores             = hashmap.New[string, *Store]()
+	nodes              = hashmap.New[string, client.Service]() // The connected node of each network being scraped.
+	blockCache         *BlockCache
+	summaryCache       *SummaryCache
+	participationCache *ParticipationCache
+	codec              Codec
+	clientLevel        zerolog.Level
+)
+
+func main() {
+	flag.Parse()
+	envFlags, err := applyEnvFlags(flag.CommandLine)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid flag in environment")
+	}
+	if *replicateFrom != "" {
+		*noScrape = true
+	}
+	if err := setupLogger(*logFormat); err != nil {
+		logger.Fatal().Err(err).Msg("invalid -log-format")
+	}
+	for _, name := range envFlags {
+		logger.Info().Str("flag", name).Msg("flag set from environment")
+	}
+	clientLevel, err = zerolog.ParseLevel(*logLevel)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid -log-level")
+	}
+	if flag.Arg(0) == "restore" {
+		if err := runRestore(flag.Args()[1:]); err != nil {
+			logger.Fatal().Err(err).Msg("failed to restore")
+		}
+		return
+	}
+
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to load config")
+	}
+	logConfig(config)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	registerMetrics(registry)
+
+	blockCache = NewBlockCache(*cacheSize)
+	summaryCache = NewSummaryCache(*summaryCacheSize)
+	participationCache = NewParticipationCache(*summaryCacheSize)
+	codec, err = ParseCodec(*compression)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid -compression")
+	}
+
+	setNotFoundErrors(config.NotFoundErrors)
+	if *validate {
+		if err := runValidate(ctx, config); err != nil {
+			logger.Fatal().Err(err).Msg("validation failed")
+		}
+		return
+	}
+	runners := networkRunners{}
+	runners.apply(ctx, config)
+
+	e := echo.New()
+	e.Pre(hostMiddleware)
+	e.Pre(middleware.RemoveTrailingSlash())
+	e.Pre(apiVersionMiddleware)
+	e.Use(metricsMiddleware)
+	if *accessLog {
+		if *accessLogSample < 1 {
+			logger.Fatal().Msg("-access-log-sample must be positive")
+		}
+		e.Use(accessLogMiddleware(*accessLogSample))
+	}
+	if *rateLimit > 0 {
+		e.Use(newRateLimiter(*rateLimit, *rateBurst, *trustProxy).middleware)
+	}
+	e.Use(requireReadToken(*readToken, *adminToken))
+	if *gzipMinSize >= 0 {
+		e.Use(gzipMiddleware(*gzipMinSize))
+	}
+	// Requests which decode or scan many blocks.
+	heavy := newConcurrencyLimiter(*maxHeavy).middleware
+
+	e.GET("/metrics", echo.WrapHandler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
+	e.GET("/healthz", healthzHandler)
+	e.GET("/readyz", readyzHandler)
+	e.GET("/networks", networksHandler, heavy)
+	e.GET("/status", statusHandler)
+	e.GET("/:network/:slot", func(c echo.Context) error {
+		network := c.Param("network")
+		slot, err := strconv.Atoi(c.Param("slot"))
+		if err != nil {
+			return err
+		}
+		opts, err := parseBlockOptions(c)
+		if err != nil {
+			return err
+		}
+		store, err := getStore(network)
+		if err != nil {
+			return err
+		}
+		representation := blockRepresentation(c.Request())
+		if representation == "ssz" {
+			// Serve the stored SSZ bytes as-is, checking the root first
+			// so that current copies needn't be decompressed.
+			header, ok, err := store.BlockHeader(phase0.Slot(slot))
+			if err == badger.ErrKeyNotFound {
+				return echo.NewHTTPError(http.StatusNotFound, "block not scraped")
+			}
+			if err != nil {
+				componentLogger("api", network).Error().Err(err).Msg("failed to get block")
+				return err
+			}
+			if !ok {
+				return echo.NewHTTPError(http.StatusNotFound, "block not found")
+			}
+			annotations, err := setAnnotationsHeader(c, store, phase0.Slot(slot))
+			if err != nil {
+				return err
+			}
+			notModified, err := checkNotModified(c, store, phase0.Slot(slot), blockETag(fmt.Sprintf("%#x", header.Root), representation, annotations), annotations != "")
+			if err != nil {
+				return err
+			}
+			if notModified {
+				return c.NoContent(http.StatusNotModified)
+			}
+			blockBytes, version, err := store.BlockSSZ(phase0.Slot(slot))
+			if err != nil {
+				componentLogger("api", network).Error().Err(err).Msg("failed to get block")
+				return err
+			}
+			if blockBytes == nil {
+				return echo.NewHTTPError(http.StatusNotFound, "block not found")
+			}
+			c.Response().Header().Set("Eth-Consensus-Version", strings.ToLower(version.String()))
+			setBlindedHeader(c, header.Blinded)
+			return c.Blob(http.StatusOK, echo.MIMEOctetStream, blockBytes)
+		}
+		block, err := loadBlock(store, phase0.Slot(slot))
+		if err != nil {
+			return err
+		}
+		if block == nil {
+			return c.JSON(http.StatusNotFound, map[string]interface{}{
+				"code":    404,
+				"message": "block not found",
+			})
+		}
+		annotations, err := setAnnotationsHeader(c, store, phase0.Slot(slot))
+		if err != nil {
+			return err
+		}
+		notModified, err := checkNotModified(c, store, phase0.Slot(slot), blockETag(fmt.Sprintf("%#x", block.BlockRoot), representation, annotations), annotations != "")
+		if err != nil {
+			return err
+		}
+		if notModified {
+			return c.NoContent(http.StatusNotModified)
+		}
+		setBlindedHeader(c, block.Blinded)
+		if representation == "yaml" {
+			return writeBlockYAML(c, block, opts)
+		}
+		return writeBlock(c, block, opts)
+	})
+	e.HEAD("/:network/:slot", slotHeadHandler)
+	e.GET("/:network/:slot/summary", func(c echo.Context) error {
+		network := c.Param("network")
+		slot, err := strconv.Atoi(c.Param("slot"))
+		if err != nil {
+			return err
+		}
+		store, err := getStore(network)
+		if err != nil {
+			return err
+		}
+		summary, err := loadSummary(store, phase0.Slot(slot))
+		if err != nil {
+			return err
+		}
+		if summary == nil {
+			return echo.NewHTTPError(http.StatusNotFound, "block not found")
+		}
+		notModified, err := checkNotModified(c, store, phase0.Slot(slot), blockETag(summary.Root, "summary", ""), false)
+		if err != nil {
+			return err
+		}
+		if notModified {
+			return c.NoContent(http.StatusNotModified)
+		}
+		return c.JSON(http.StatusOK, summary)
+	})
+	e.GET("/:network/:slot/root", func(c echo.Context) error {
+		slot, err := strconv.Atoi(c.Param("slot"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid slot")
+		}
+		store, err := getStore(c.Param("network"))
+		if err != nil {
+			return err
+		}
+		header, ok, err := store.BlockHeader(phase0.Slot(slot))
+		if err == badger.ErrKeyNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "block not scraped")
+		}
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// The slot is empty, so there's no root.
+			return c.JSON(http.StatusOK, map[string]interface{}{"root": nil, "version": nil})
+		}
+		notModified, err := checkNotModified(c, store, phase0.Slot(slot), blockETag(fmt.Sprintf("%#x", header.Root), "root", ""), false)
+		if err != nil {
+			return err
+		}
+		if notModified {
+			return c.NoContent(http.StatusNotModified)
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"root":    fmt.Sprintf("%#x", header.Root),
+			"version": strings.ToLower(header.Version.String()),
+		})
+	})
+	e.GET("/:network/:slot/orphaned", func(c echo.Context) error {
+		network := c.Param("network")
+		slot, err := strconv.Atoi(c.Param("slot"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid slot")
+		}
+		opts, err := parseBlockOptions(c)
+		if err != nil {
+			return err
+		}
+		store, err := getStore(network)
+		if err != nil {
+			return err
+		}
+		blocks, err := store.OrphanedBlocks(phase0.Slot(slot))
+		if err != nil {
+			return err
+		}
+		resp := make([]interface{}, len(blocks))
+		for i, block := range blocks {
+			resp[i], err = blockResponseFields(newBlockResponse(block, opts), opts)
+			if err != nil {
+				return err
+			}
+		}
+		return writeJSON(c, resp)
+	})
+	e.GET("/:network/:slot/participation", participationHandler)
+	e.GET("/:network/:slot/attestations", func(c echo.Context) error {
+		network := c.Param("network")
+		slot, err := strconv.Atoi(c.Param("slot"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid slot")
+		}
+		opts := blockOptions{attestationsLimit: -1}
+		params := c.QueryParams()
+		if params.Has("offset") {
+			opts.attestationsOffset, err = strconv.Atoi(params.Get("offset"))
+			if err != nil || opts.attestationsOffset < 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid offset")
+			}
+		}
+		if params.Has("limit") {
+			opts.attestationsLimit, err = strconv.Atoi(params.Get("limit"))
+			if err != nil || opts.attestationsLimit < 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+			}
+		}
+		store, err := getStore(network)
+		if err != nil {
+			return err
+		}
+		block, err := loadBlock(store, phase0.Slot(slot))
+		if err != nil {
+			return err
+		}
+		// Empty slots have no attestations, rather than not being found.
+		attestations := []interface{}{}
+		if block != nil {
+			fields, err := messageFields(block.VersionedSignedBeaconBlock)
+			if err != nil {
+				return err
+			}
+			attestations = append(attestations, pageAttestations(opts, fields.Attestations)...)
+		}
+		return writeJSON(c, attestations)
+	})
+	e.GET("/:network/:slot/execution", func(c echo.Context) error {
+		network := c.Param("network")
+		opts := blockOptions{hideTransactions: c.QueryParams().Has("hide-transactions")}
+		slot, err := strconv.Atoi(c.Param("slot"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid slot")
+		}
+		store, err := getStore(network)
+		if err != nil {
+			return err
+		}
+		block, err := loadBlock(store, phase0.Slot(slot))
+		if err != nil {
+			return err
+		}
+		if block == nil {
+			return echo.NewHTTPError(http.StatusNotFound, "block not found")
+		}
+		fields, err := messageFields(block.VersionedSignedBeaconBlock)
+		if err != nil {
+			return err
+		}
+		// Blocks before the merge have no (or an empty) execution payload.
+		payload := fields.ExecutionPayload
+		if payload == nil || payload.BlockHash == (phase0.Hash32{}) {
+			return echo.NewHTTPError(http.StatusNotFound, "block has no execution payload")
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"version":            strings.ToLower(block.Version.String()),
+			"transactions_count": len(payload.Transactions),
+			"data":               opts.trimPayload(payload.Data),
+		})
+	})
+	e.GET("/:network/execution/:hash", func(c echo.Context) error {
+		network := c.Param("network")
+		hash, err := hex.DecodeString(strings.TrimPrefix(c.Param("hash"), "0x"))
+		if err != nil || len(hash) != len(phase0.Hash32{}) {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid execution block hash")
+		}
+		opts, err := parseBlockOptions(c)
+		if err != nil {
+			return err
+		}
+		store, err := getStore(network)
+		if err != nil {
+			return err
+		}
+		_, block, err := store.BlockByExecutionHash(hash)
+		if err == badger.ErrKeyNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "block not found")
+		}
+		if err != nil {
+			componentLogger("api", network).Error().Err(err).Msg("failed to get block")
+			return err
+		}
+		return writeBlock(c, block, opts)
+	})
+	e.GET("/:network/root/:root", func(c echo.Context) error {
+		network := c.Param("network")
+		rootBytes, err := hex.DecodeString(strings.TrimPrefix(c.Param("root"), "0x"))
+		if err != nil || len(rootBytes) != len(phase0.Root{}) {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid block root")
+		}
+		opts, err := parseBlockOptions(c)
+		if err != nil {
+			return err
+		}
+		store, err := getStore(network)
+		if err != nil {
+			return err
+		}
+		var root phase0.Root
+		copy(root[:], rootBytes)
+		_, block, err := store.BlockByRoot(root)
+		if err == badger.ErrKeyNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "block not found")
+		}
+		if err != nil {
+			componentLogger("api", network).Error().Err(err).Msg("failed to get block")
+			return err
+		}
+		return writeBlock(c, block, opts)
+	})
+	e.GET("/:network/proposer/:index", func(c echo.Context) error {
+		network := c.Param("network")
+		index, err := strconv.ParseUint(c.Param("index"), 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid proposer index")
+		}
+		from, to := uint64(0), uint64(math.MaxUint64)
+		if param := c.QueryParam("from"); param != "" {
+			from, err = strconv.ParseUint(param, 10, 64)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid from slot")
+			}
+		}
+		if param := c.QueryParam("to"); param != "" {
+			to, err = strconv.ParseUint(param, 10, 64)
+			if err != nil || to < from {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid to slot")
+			}
+		}
+		store, err := getStore(network)
+		if err != nil {
+			return err
+		}
+		slots, err := store.ProposerSlots(phase0.ValidatorIndex(index), phase0.Slot(from), phase0.Slot(to))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"slots": slots,
+		})
+	})
+	e.GET("/:network/head", func(c echo.Context) error {
+		opts, err := parseBlockOptions(c)
+		if err != nil {
+			return err
+		}
+		store, err := getStore(c.Param("network"))
+		if err != nil {
+			return err
+		}
+		_, block, err := store.LatestBlock()
+		if err == badger.ErrKeyNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "no blocks scraped yet")
+		}
+		if err != nil {
+			componentLogger("api", store.network).Error().Err(err).Msg("failed to get block")
+			return err
+		}
+		return writeBlock(c, block, opts)
+	})
+	e.GET("/:network/finalized", func(c echo.Context) error {
+		opts, err := parseBlockOptions(c)
+		if err != nil {
+			return err
+		}
+		store, err := getStore(c.Param("network"))
+		if err != nil {
+			return err
+		}
+		checkpoint, err := store.Finalized()
+		if err != nil {
+			return err
+		}
+		if checkpoint == nil {
+			return echo.NewHTTPError(http.StatusNotFound, "finalized checkpoint not known yet")
+		}
+		_, block, err := store.BlockByRoot(checkpoint.Root)
+		if err == badger.ErrKeyNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "finalized block not scraped")
+		}
+		if err != nil {
+			componentLogger("api", store.network).Error().Err(err).Msg("failed to get block")
+			return err
+		}
+		return writeBlock(c, block, opts)
+	})
+	e.GET("/:network/epoch/:epoch", func(c echo.Context) error {
+		network := c.Param("network")
+		epoch, err := strconv.Atoi(c.Param("epoch"))
+		if err != nil || epoch < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid epoch")
+		}
+		opts, err := parseBlockOptions(c)
+		if err != nil {
+			return err
+		}
+		store, err := getStore(network)
+		if err != nil {
+			return err
+		}
+		networkSpec, err := store.Spec()
+		if err != nil {
+			return err
+		}
+		slotsPerEpoch := phase0.Slot(defaultSlotsPerEpoch)
+		if networkSpec != nil {
+			slotsPerEpoch = phase0.Slot(networkSpec.SlotsPerEpoch)
+		}
+		from := phase0.Slot(epoch) * slotsPerEpoch
+		return writeSlotRange(c, store, from, from+slotsPerEpoch-1, opts)
+	}, heavy)
+	e.GET("/:network/epochs", func(c echo.Context) error {
+		network := c.Param("network")
+		from, err := strconv.Atoi(c.QueryParam("from"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid from epoch")
+		}
+		to, err := strconv.Atoi(c.QueryParam("to"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid to epoch")
+		}
+		if from < 0 || to < from {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid epoch range")
+		}
+		if to-from >= maxRangeEpochs {
+			return echo.NewHTTPError(http.StatusBadRequest, "epoch range too large")
+		}
+		store, err := getStore(network)
+		if err != nil {
+			return err
+		}
+		networkSpec, err := store.Spec()
+		if err != nil {
+			return err
+		}
+		slotsPerEpoch := phase0.Slot(defaultSlotsPerEpoch)
+		if networkSpec != nil {
+			slotsPerEpoch = phase0.Slot(networkSpec.SlotsPerEpoch)
+		}
+		counts, err := store.EpochCounts(phase0.Epoch(from), phase0.Epoch(to), slotsPerEpoch, c.QueryParams().Has("totals"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, counts)
+	}, heavy)
+	e.GET("/:network/range", func(c echo.Context) error {
+		network := c.Param("network")
+		from, to, err := parseSlotRange(c, maxRangeSlots)
+		if err != nil {
+			return err
+		}
+		opts, err := parseBlockOptions(c)
+		if err != nil {
+			return err
+		}
+		store, err := getStore(network)
+		if err != nil {
+			return err
+		}
+		return writeSlotRange(c, store, from, to, opts)
+	}, heavy)
+	for _, op := range operations {
+		e.GET("/:network/:slot/"+op.name, operationHandler(op))
+		e.GET("/:network/"+op.name, operationRangeHandler(op), heavy)
+	}
+	e.GET("/:network/events", eventsHandler, heavy)
+	e.POST("/:network/fetch/:slot", fetchSlotHandler, requireAdminToken(*adminToken), heavy)
+	if *debug {
+		e.GET("/:network/:slot/raw", rawHandler)
+	}
+	e.GET("/:network/backup", backupHandler, requireAdminToken(*adminToken))
+	// Replicas ask for raw records rather than JSON, see replica.go.
+	export := requireAdminToken(*adminToken)(heavy(exportHandler))
+	e.GET("/:network/since/:slot", func(c echo.Context) error {
+		if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMEOctetStream) {
+			return export(c)
+		}
+		return sinceHandler(c)
+	})
+	e.GET("/:network/db", dbHandler, requireAdminToken(*adminToken))
+	e.POST("/:network/gc", gcHandler, requireAdminToken(*adminToken))
+	e.POST("/:network/reindex", reindexHandler, requireAdminToken(*adminToken))
+	e.POST("/:network/verify", verifyHandler, requireAdminToken(*adminToken), heavy)
+	e.POST("/:network/repair", repairHandler, requireAdminToken(*adminToken), heavy)
+	e.GET("/:network/annotations", annotationsHandler)
+	e.GET("/:network/:slot/annotations", slotAnnotationsHandler)
+	e.PUT("/:network/:slot/annotations", slotAnnotationsHandler, requireAdminToken(*adminToken))
+	e.DELETE("/:network/:slot/annotations", slotAnnotationsHandler, requireAdminToken(*adminToken))
+	e.GET("/:network/pins", pinsHandler, requireAdminToken(*adminToken))
+	e.PUT("/:network/pins/:slot", pinHandler, requireAdminToken(*adminToken))
+	e.DELETE("/:network/pins/:slot", pinHandler, requireAdminToken(*adminToken))
+	e.DELETE("/:network/data", wipeHandler, requireAdminToken(*adminToken))
+	e.GET("/:network/stream", streamHandler)
+	e.GET("/:network/ws", wsHandler)
+	e.GET("/:network/stats", func(c echo.Context) error {
+		store, err := getStore(c.Param("network"))
+		if err != nil {
+			return err
+		}
+		stats, err := store.Stats()
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, stats)
+	})
+	e.GET("/:network/spec", func(c echo.Context) error {
+		store, err := getStore(c.Param("network"))
+		if err != nil {
+			return err
+		}
+		networkSpec, err := store.Spec()
+		if err != nil {
+			return err
+		}
+		if networkSpec == nil {
+			return echo.NewHTTPError(http.StatusNotFound, "spec not fetched yet")
+		}
+		return c.JSON(http.StatusOK, networkSpec)
+	})
+	e.GET("/:network/slot-at", slotAtHandler)
+	e.GET("/:network/time-at", timeAtHandler)
+	e.GET("/:network/sizes", sizesHandler)
+	e.GET("/:network/gaps", func(c echo.Context) error {
+		network := c.Param("network")
+		from, to, err := parseSlotRange(c, maxGapRange)
+		if err != nil {
+			return err
+		}
+		store, err := getStore(network)
+		if err != nil {
+			return err
+		}
+		empty, unscraped, err := store.MissingSlots(from, to)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"empty":     empty,
+			"unscraped": unscraped,
+		})
+	}, heavy)
+	e.GET("/:network", func(ctx echo.Context) error {
+		network := ctx.Param("network")
+		store, err := getStore(network)
+		if err != nil {
+			return err
+		}
+		net, _ := networks.Get(network)
+		net.Name = network
+		summary, err := summarizeNetwork(store, net)
+		if err != nil {
+			return err
+		}
+		return ctx.JSON(http.StatusOK, summary)
+	})
+	go func() {
+		if err := e.Start(*listenAddr); err != nil && err != http.ErrServerClosed {
+			e.Logger.Fatal("shutting down the server")
+		}
+	}()
+
+	// Wait for interrupt signal to gracefully shutdown the server with a timeout of shutdownTimeout.
+	// Use a buffered channel to avoid missing signals as recommended for signal.Notify
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt)
+
+	// Reload the config file on SIGHUP.
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	for running := true; running; {
+		select {
+		case <-quit:
+			running = false
+		case <-reload:
+			if *configPath == "" {
+				componentLogger("config", "").Warn().Msg("ignoring SIGHUP, since no config file was given")
+				continue
+			}
+			config, err := LoadConfig(*configPath)
+			if err != nil {
+				componentLogger("config", "").Error().Err(err).Msg("failed to reload config")
+				continue
+			}
+			componentLogger("config", "").Info().Str("path", *configPath).Msg("reloading config")
+			setNotFoundErrors(config.NotFoundErrors)
+			runners.apply(ctx, config)
+		}
+	}
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		e.Logger.Fatal(err)
+	}
+
+	// Stop the networks, waiting for the blocks they already fetched to be
+	// written and their stores to close.
+	cancel()
+	drained := make(chan struct{})
+	count := len(runners)
+	go func() {
+		runners.stopAll()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		logger.Info().Int("networks", count).Msgf("drained %d networks", count)
+	case <-shutdownCtx.Done():
+		logger.Warn().Msg("timed out draining networks, exiting anyway")
+	}
 }
 
-var (
-	dataDir = flag.String("datadir", "./data", "")
-)
+// runNetwork opens the network's store, retrying periodically until it succeeds
+// (so that one broken store doesn't take down the others), and then scrapes it
+// until ctx is done or the store is closed.
+func runNetwork(ctx context.Context, network NetworkConfig) {
+	var networkStore *Store
+	for {
+		var err error
+		networkStore, err = OpenStore(*dataDir, network.Name)
+		if err == nil {
+			break
+		}
+		componentLogger("store", network.Name).Error().Err(err).Dur("retry_in", openStoreRetryInterval).Msg("failed to open store, retrying")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(openStoreRetryInterval):
+		}
+	}
+	networkStore.cache = blockCache
+	networkStore.summaryCache = summaryCache
+	networkStore.participationCache = participationCache
+	networkStore.codec = codec
+	networkStore.keepOrphans = network.KeepOrphans
+	networkStore.recordSizes = network.RecordSizes
+	networkStore.pruneEmpty = network.PruneEmpty
+	stores.Set(network.Name, networkStore)
+	defer func() {
+		stores.Del(network.Name)
+		networkStore.Close()
+	}()
 
-var stores = hashmap.New[string, *Store]()
+	// The network's goroutines are tasks of its store, so that closing the
+	// store stops them, and waits for their writes to complete. They can
+	// also be stopped on their own, such as to wipe the store.
+	startTasks := func() (stop func()) {
+		ctx, cancel := context.WithCancel(networkStore.ctx)
+		var tasks sync.WaitGroup
+		run := func(fn func(ctx context.Context, store *Store, network NetworkConfig)) {
+			tasks.Add(1)
+			networkStore.goTask(func(context.Context) {
+				defer tasks.Done()
+				fn(ctx, networkStore, network)
+			})
+		}
+		switch {
+		case !*noScrape:
+			run(scrapeWithLease)
+		case *replicateFrom != "":
+			if !network.ExpireByTTL {
+				run(purgePeriodically)
+			}
+			run(replicate)
+		default:
+			// Serve the store as it is.
+		}
+		return func() {
+			cancel()
+			tasks.Wait()
+		}
+	}
+	stopTasks := startTasks()
+	wipe := make(chan chan error)
+	wipeRequests.Set(network.Name, wipe)
+	defer wipeRequests.Del(network.Name)
 
-func main() {
-	flag.Parse()
-	ctx, cancel := context.WithCancel(context.Background())
+	// Run until stopped, or until the store is closed.
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-networkStore.Done():
+			return
+		case done := <-wipe:
+			stopTasks()
+			done <- networkStore.Wipe()
+			stopTasks = startTasks()
+		}
+	}
+}
+
+// scrapeContinuously scrapes the network until the context is done,
+// reconnecting to its node after failures.
+func scrapeContinuously(ctx context.Context, store *Store, network NetworkConfig) {
+	for {
+		if err := scrape(ctx, store, network); err != nil {
+			componentLogger("scraper", network.Name).Error().Err(err).Msg("scraping failed")
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second * 16):
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+	}
+}
 
-	for network, nodeURL := range targets {
-		networkStore, err := OpenStore(*dataDir, network)
+// purgePeriodically purges slots as they fall out of the network's retention
+// window, since scrape only purges when it (re)connects.
+func purgePeriodically(ctx context.Context, store *Store, network NetworkConfig) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		log := componentLogger("purger", network.Name)
+		networkSpec, err := store.Spec()
+		if err != nil {
+			log.Error().Err(err).Msg("failed to read spec")
+			continue
+		}
+		if networkSpec == nil {
+			continue
+		}
+		deleted, err := purgeOutdated(store, network, networkSpec)
 		if err != nil {
-			log.Fatal(err)
+			log.Error().Err(err).Msg("failed to purge outdated slots")
+			continue
+		}
+		if deleted > 0 {
+			log.Info().Int("deleted", deleted).Msg("purged outdated slots")
 		}
-		defer networkStore.Close()
-		stores.Set(network, networkStore)
+	}
+}
 
-		go func(network, nodeURL string) {
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-				}
-				if err := scrape(ctx, networkStore, network, nodeURL); err != nil {
-					log.Printf("scrape(%s): %s", network, err)
-					time.Sleep(time.Second * 16)
-				}
-			}
-		}(network, nodeURL)
+// purgeOutdated purges the slots before the network's retention window.
+// It runs whenever scraping starts, so a shrunk window takes effect on restart
+// (or on reload) rather than requiring the database to be deleted.
+func purgeOutdated(store *Store, network NetworkConfig, networkSpec *NetworkSpec) (deleted int, err error) {
+	start := retentionStart(network, networkSpec)
+	if start == 0 {
+		return 0, nil
 	}
+	return store.Purge(0, start-1)
+}
 
-	e := echo.New()
-	e.Pre(middleware.RemoveTrailingSlash())
-	e.GET("/:network/:slot", func(c echo.Context) error {
-		network := c.Param("network")
-		hideAttestations := c.QueryParams().Has("hide-attestations")
-		hideTransactions := c.QueryParams().Has("hide-transactions")
-		slot, err := strconv.Atoi(c.Param("slot"))
+// retentionStart returns the first slot of the network's retention window.
+func retentionStart(network NetworkConfig, networkSpec *NetworkSpec) phase0.Slot {
+	currentSlot := phase0.Slot(time.Since(networkSpec.GenesisTime) / network.SlotDuration(networkSpec))
+	if currentSlot <= phase0.Slot(network.RetentionSlots) {
+		return 0
+	}
+	return currentSlot - phase0.Slot(network.RetentionSlots)
+}
+
+// verifyRoot checks the locally computed block root of the slot against the
+// root reported by the node.
+func verifyRoot(ctx context.Context, svc client.Service, slot phase0.Slot, root phase0.Root) error {
+	ctx, cancel := nodeContext(ctx)
+	defer cancel()
+	resp, err := svc.(client.BeaconBlockRootProvider).BeaconBlockRoot(ctx, &api.BeaconBlockRootOpts{Block: fmt.Sprint(slot)})
+	if err != nil {
+		return errors.Wrapf(err, "failed to get block root %d", slot)
+	}
+	if resp.Data == nil {
+		return fmt.Errorf("node reports no block root at slot %d", slot)
+	}
+	if nodeRoot := *resp.Data; nodeRoot != root {
+		return fmt.Errorf("block root at slot %d is %#x, but node reports %#x", slot, root, nodeRoot)
+	}
+	return nil
+}
+
+// trackLag periodically updates the network's scrape lag metric,
+// and logs when the lag rises above or falls back below lagWarningSlots.
+func trackLag(ctx context.Context, store *Store, network NetworkConfig) {
+	log := componentLogger("scraper", network.Name)
+	ticker := time.NewTicker(lagInterval)
+	defer ticker.Stop()
+	lagging := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		lag, ok, err := lagSlots(store, network)
 		if err != nil {
-			return err
+			log.Error().Err(err).Msg("failed to compute scrape lag")
+			continue
 		}
-		store, ok := stores.Get(network)
 		if !ok {
-			return echo.NewHTTPError(http.StatusNotFound, "network not found")
+			continue
 		}
-		block, err := store.Block(phase0.Slot(slot))
-		if err == badger.ErrKeyNotFound {
-			return echo.NewHTTPError(http.StatusNotFound, "block not scraped")
+		metricScrapeLag.WithLabelValues(network.Name).Set(float64(lag))
+		if lag > lagWarningSlots && !lagging {
+			log.Warn().Uint64("lag_slots", lag).Msg("scraping is lagging behind head")
+		} else if lag <= lagWarningSlots && lagging {
+			log.Info().Uint64("lag_slots", lag).Msg("scraping caught up to head")
+		}
+		lagging = lag > lagWarningSlots
+	}
+}
+
+// lagSlots returns how many slots the store's highest filled slot is behind the
+// node's head slot, or the current slot by the clock if the head isn't known.
+// With -no-scrape, it's never behind the clock, since nothing is scraped to
+// catch up to it.
+// ok is false until the network's spec and first slot are stored.
+func lagSlots(store *Store, network NetworkConfig) (lag uint64, ok bool, err error) {
+	networkSpec, err := store.Spec()
+	if err != nil || networkSpec == nil {
+		return 0, false, err
+	}
+	highestSlot, ok, err := store.HighestFilledSlot()
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	currentSlot, ok, err := store.HeadSlot()
+	if err != nil {
+		return 0, false, err
+	}
+	if !ok {
+		if *noScrape {
+			return 0, true, nil
 		}
+		currentSlot = phase0.Slot(time.Since(networkSpec.GenesisTime) / network.SlotDuration(networkSpec))
+	}
+	if highestSlot >= currentSlot {
+		return 0, true, nil
+	}
+	return uint64(currentSlot - highestSlot), true, nil
+}
+
+// getStore returns the store of the given network, or an HTTP error if the
+// network isn't configured or its store isn't open.
+func getStore(network string) (*Store, error) {
+	if store, ok := stores.Get(network); ok {
+		return store, nil
+	}
+	if _, ok := networks.Get(network); ok {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "network not available")
+	}
+	return nil, echo.NewHTTPError(http.StatusNotFound, "network not found")
+}
+
+// blockOptions control which parts of a block are included in responses.
+type blockOptions struct {
+	hideTransactions bool
+
+	// fields selects which JSON fields to respond with, if set.
+	fields fieldSelection
+
+	// paginate is set if any of the attestations-* params are given.
+	// A negative attestationsLimit means no limit.
+	paginate           bool
+	attestationsOffset int
+	attestationsLimit  int
+
+	// full bypasses -max-response-bytes, see truncate.go.
+	full bool
+}
+
+// parseBlockOptions parses blockOptions from the request's query params.
+// hide-attestations is a shortcut for attestations-limit=0.
+func parseBlockOptions(c echo.Context) (opts blockOptions, err error) {
+	params := c.QueryParams()
+	opts.hideTransactions = params.Has("hide-transactions")
+	if params.Has("fields") {
+		opts.fields, err = parseFields(params.Get("fields"))
 		if err != nil {
-			log.Printf("Error getting block: %v", err)
-			return err
+			return opts, echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
-		if block == nil {
-			return c.JSON(http.StatusNotFound, map[string]interface{}{
-				"code":    404,
-				"message": "block not found",
-			})
+	}
+	opts.attestationsLimit = -1
+	if params.Has("attestations-offset") {
+		opts.paginate = true
+		opts.attestationsOffset, err = strconv.Atoi(params.Get("attestations-offset"))
+		if err != nil || opts.attestationsOffset < 0 {
+			return opts, echo.NewHTTPError(http.StatusBadRequest, "invalid attestations-offset")
 		}
-		var resp struct {
-			Version string      `json:"version"`
-			Root    string      `json:"root"`
-			Data    interface{} `json:"data"`
-		}
-		resp.Version = strings.ToLower(block.Version.String())
-		resp.Root = "0x" + hex.EncodeToString(block.BlockRoot[:])
-		switch block.Version {
-		case spec.DataVersionPhase0:
-			resp.Data = block.Phase0
-			if hideAttestations {
-				block.Phase0.Message.Body.Attestations = nil
-			}
-		case spec.DataVersionAltair:
-			resp.Data = block.Altair
-			if hideAttestations {
-				block.Altair.Message.Body.Attestations = nil
-			}
-		case spec.DataVersionBellatrix:
-			resp.Data = block.Bellatrix
-			if hideAttestations {
-				block.Bellatrix.Message.Body.Attestations = nil
-			}
-			if hideTransactions {
-				block.Bellatrix.Message.Body.ExecutionPayload.Transactions = nil
-			}
+	}
+	if params.Has("attestations-limit") {
+		opts.paginate = true
+		opts.attestationsLimit, err = strconv.Atoi(params.Get("attestations-limit"))
+		if err != nil || opts.attestationsLimit < 0 {
+			return opts, echo.NewHTTPError(http.StatusBadRequest, "invalid attestations-limit")
 		}
+	}
+	if params.Has("hide-attestations") {
+		opts.attestationsLimit = 0
+	}
+	opts.full, _ = strconv.ParseBool(params.Get("full"))
+	return opts, nil
+}
 
-		// Encode faster with goccy/go-json.
-		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-		c.Response().WriteHeader(http.StatusOK)
-		err = json.NewEncoder(c.Response().Writer).Encode(resp)
-		if err != nil {
-			log.Printf("failed to encode JSON: %s", err)
+// pageAttestations returns the page of attestations selected by opts. They're
+// of any fork's type, since the paging is the same.
+func pageAttestations[A any](opts blockOptions, attestations []A) []A {
+	if opts.attestationsLimit == 0 {
+		return nil
+	}
+	start := opts.attestationsOffset
+	if start > len(attestations) {
+		start = len(attestations)
+	}
+	end := len(attestations)
+	if opts.attestationsLimit > 0 && start+opts.attestationsLimit < end {
+		end = start + opts.attestationsLimit
+	}
+	return attestations[start:end]
+}
+
+// trimPayload returns the fork's execution payload, without its transactions
+// if opts hide them.
+func (opts blockOptions) trimPayload(payload interface{}) interface{} {
+	if !opts.hideTransactions {
+		return payload
+	}
+	return withoutTransactions(payload)
+}
+
+// trimsAttestations returns whether opts may remove any attestations.
+func (opts blockOptions) trimsAttestations() bool {
+	return opts.attestationsOffset > 0 || opts.attestationsLimit >= 0
+}
+
+// attestationsPage describes the page of attestations in a response.
+type attestationsPage struct {
+	Offset int `json:"offset"`
+	Count  int `json:"count"`
+	Total  int `json:"total"`
+}
+
+// blockResponse is the JSON representation of a block.
+type blockResponse struct {
+	Version      string            `json:"version"`
+	Root         string            `json:"root"`
+	Attestations *attestationsPage `json:"attestations,omitempty"`
+	Data         interface{}       `json:"data"`
+}
+
+// newBlockResponse returns the block's response, trimmed according to opts.
+func newBlockResponse(block *BlockWithRoot, opts blockOptions) *blockResponse {
+	var resp blockResponse
+	resp.Version = strings.ToLower(block.Version.String())
+	resp.Root = "0x" + hex.EncodeToString(block.BlockRoot[:])
+
+	resp.Data = blockData(block.VersionedSignedBeaconBlock, opts)
+	if opts.paginate {
+		var attestations []interface{}
+		if fields, err := messageFields(block.VersionedSignedBeaconBlock); err == nil {
+			attestations = fields.Attestations
+		}
+		offset := opts.attestationsOffset
+		if offset > len(attestations) {
+			offset = len(attestations)
+		}
+		resp.Attestations = &attestationsPage{
+			Offset: offset,
+			Count:  len(pageAttestations(opts, attestations)),
+			Total:  len(attestations),
+		}
+	}
+	return &resp
+}
+
+// writeBlock writes the block as a JSON response, trimmed according to opts.
+// Unknown fields are rejected, since they're likely a typo.
+func writeBlock(c echo.Context, block *BlockWithRoot, opts blockOptions) error {
+	if *maxResponseBytes > 0 {
+		return writeBlockCapped(c, block, opts)
+	}
+	resp, err := blockResponseFields(newBlockResponse(block, opts), opts)
+	if err != nil {
+		return err
+	}
+	return writeJSON(c, resp)
+}
+
+// blockResponseFields returns the response with only the fields selected by
+// opts, or an HTTP error if any is unknown.
+func blockResponseFields(resp *blockResponse, opts blockOptions) (interface{}, error) {
+	if opts.fields == nil {
+		return resp, nil
+	}
+	selected, err := selectFields(resp, opts.fields, true)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return selected, nil
+}
+
+// writeJSON writes v as a JSON response, encoding faster with goccy/go-json.
+func writeJSON(c echo.Context, v interface{}) error {
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c.Response().WriteHeader(http.StatusOK)
+	err := json.NewEncoder(c.Response()).Encode(v)
+	if err != nil {
+		componentLogger("api", "").Error().Err(err).Msg("failed to encode JSON")
+		return err
+	}
+	return nil
+}
+
+// slotResponse is the JSON representation of a slot within a range.
+// Status is one of "block", "empty" or "unscraped".
+type slotResponse struct {
+	Slot   phase0.Slot `json:"slot"`
+	Status string      `json:"status"`
+	*blockResponse
+}
+
+// newSlotResponse returns the response of a scraped slot within a range,
+// whose block is nil if it's empty. Since blocks of different forks have different
+// fields, selected fields which a block doesn't have are left out rather than
+// rejected.
+func newSlotResponse(slot phase0.Slot, block *BlockWithRoot, opts blockOptions) (interface{}, error) {
+	if block == nil {
+		return slotResponse{Slot: slot, Status: "empty"}, nil
+	}
+	resp := slotResponse{Slot: slot, Status: "block", blockResponse: newBlockResponse(block, opts)}
+	if opts.fields == nil {
+		return resp, nil
+	}
+	selected, err := selectFields(resp.blockResponse, opts.fields, false)
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := selected.(map[string]interface{})
+	if !ok {
+		fields = map[string]interface{}{}
+	}
+	fields["slot"], fields["status"] = resp.Slot, resp.Status
+	return fields, nil
+}
+
+// writeSlotRange streams the slots within the given range (inclusive) as a
+// JSON array (or as SSZ, see sszrange.go), so that only one block is held in
+// memory at a time.
+func writeSlotRange(c echo.Context, store *Store, from, to phase0.Slot, opts blockOptions) error {
+	if acceptsSSZ(c.Request()) {
+		return writeSlotRangeSSZ(c, store, from, to)
+	}
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c.Response().WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(c.Response())
+	delim := "["
+	write := func(resp interface{}) error {
+		if _, err := io.WriteString(c.Response(), delim); err != nil {
 			return err
 		}
-		return nil
-	})
-	e.GET("/:network", func(ctx echo.Context) error {
-		network := ctx.Param("network")
-		store, ok := stores.Get(network)
-		if !ok {
-			return echo.NewHTTPError(http.StatusNotFound, "network not found")
+		delim = ","
+		return enc.Encode(resp)
+	}
+
+	next := from
+	err := store.IterateBlocks(from, to, func(slot phase0.Slot, block *BlockWithRoot) error {
+		for ; next < slot; next++ {
+			if err := write(slotResponse{Slot: next, Status: "unscraped"}); err != nil {
+				return err
+			}
 		}
-		slots, blocks, err := store.Count()
+		next = slot + 1
+		resp, err := newSlotResponse(slot, block, opts)
 		if err != nil {
 			return err
 		}
-		return ctx.JSON(http.StatusOK, map[string]interface{}{
-			"slots":  slots,
-			"blocks": blocks,
-		})
+		return write(resp)
 	})
-	go func() {
-		if err := e.Start(":8080"); err != nil && err != http.ErrServerClosed {
-			e.Logger.Fatal("shutting down the server")
+	for ; err == nil && next <= to; next++ {
+		err = write(slotResponse{Slot: next, Status: "unscraped"})
+	}
+	if err == nil {
+		if delim == "[" {
+			_, err = io.WriteString(c.Response(), "[]")
+		} else {
+			_, err = io.WriteString(c.Response(), "]")
 		}
-	}()
+	}
+	if err != nil {
+		// Too late to report an error status, so just cut the response short.
+		componentLogger("api", store.network).Error().Err(err).Uint64("from", uint64(from)).Uint64("to", uint64(to)).Msg("failed to write slots")
+	}
+	return nil
+}
 
-	// Wait for interrupt signal to gracefully shutdown the server with a timeout of 10 seconds.
-	// Use a buffered channel to avoid missing signals as recommended for signal.Notify
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
-	defer cancel()
-	if err := e.Shutdown(ctx); err != nil {
-		e.Logger.Fatal(err)
+// loadBlock returns the block at the given slot from the cache or the store,
+// or an HTTP error if the slot wasn't scraped. The block is nil for empty slots.
+func loadBlock(store *Store, slot phase0.Slot) (*BlockWithRoot, error) {
+	if block, ok := blockCache.Get(store.network, slot); ok {
+		return block, nil
+	}
+	block, err := store.Block(slot)
+	if err == badger.ErrKeyNotFound {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "block not scraped")
 	}
+	if err != nil {
+		componentLogger("api", store.network).Error().Err(err).Msg("failed to get block")
+		return nil, err
+	}
+	blockCache.Add(store.network, slot, block)
+	return block, nil
 }
 
-func scrape(ctx context.Context, store *Store, network, nodeURL string) error {
+func scrape(ctx context.Context, store *Store, network NetworkConfig) (err error) {
+	log := componentLogger("scraper", network.Name)
+
+	// Stop the event subscription and the client along with scrape, so
+	// that they don't outlive it when it fails.
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
 	// Connect to the node.
-	svc, err := auto.New(ctx, auto.WithAddress(nodeURL), auto.WithLogLevel(zerolog.ErrorLevel))
+	// The client's own timeout bounds the requests made while connecting.
+	// Its context must not time out, since the client closes itself when it's done.
+	svc, err := auto.New(ctx,
+		auto.WithAddress(network.NodeURL),
+		auto.WithLogLevel(clientLevel),
+		auto.WithTimeout(*nodeTimeout),
+	)
 	if err != nil {
 		return errors.Wrap(err, "failed to connect to node")
 	}
+	nodes.Set(network.Name, svc)
+	defer nodes.Del(network.Name)
 
-	// Get the genesis time.
-	genesisTime, err := svc.(client.GenesisTimeProvider).GenesisTime(ctx)
+	// Get the network spec, fetching it from the node on first connect.
+	networkSpec, err := store.Spec()
 	if err != nil {
-		return errors.Wrap(err, "failed to get genesis time")
+		return errors.Wrap(err, "failed to read spec")
 	}
+	if networkSpec == nil {
+		networkSpec, err = fetchSpec(ctx, svc)
+		if err != nil {
+			return err
+		}
+		if err := store.SetSpec(networkSpec); err != nil {
+			return errors.Wrap(err, "failed to store spec")
+		}
+	}
+	genesisTime := networkSpec.GenesisTime
 
 	// Compute the slot to start scraping from.
-	currentSlot := phase0.Slot(time.Since(genesisTime).Seconds() / secondsPerSlot)
-	startSlot := currentSlot - scrapeSlots
+	slotDuration := network.SlotDuration(networkSpec)
+	if network.ExpireByTTL {
+		store.SetExpiry(&slotExpiry{
+			genesisTime:    genesisTime,
+			slotDuration:   slotDuration,
+			retentionSlots: phase0.Slot(network.RetentionSlots),
+		})
+	}
+	currentSlot := phase0.Slot(time.Since(genesisTime) / slotDuration)
+	startSlot := phase0.Slot(0)
+	if currentSlot > phase0.Slot(network.ScrapeSlots) {
+		startSlot = currentSlot - phase0.Slot(network.ScrapeSlots)
+	}
 
-	// Purge out of range slots.
-	deleted, err := store.Purge(0, startSlot)
+	// Purge the slots which fell out of the retention window, including
+	// after it was shrunk. Slots brought into range by growing it are
+	// backfilled below, since only the slots not yet filled are scraped.
+	deleted, err := purgeOutdated(store, network, networkSpec)
 	if err != nil {
 		return errors.Wrap(err, "failed to purge out of range slots")
 	}
-	log.Printf("%-10s purged %d outdated slots, starting from slot %d", network, deleted, startSlot)
-
-	// Spawn goroutines to scrape the blocks.
-	printTicker := time.NewTicker(time.Second)
-	const rateInterval = 10 * time.Second
-	rate := ratecounter.NewRateCounter(rateInterval)
-	jobs := make(chan phase0.Slot)
-	errs := make(chan error)
-	for i := 0; i < scrapeConcurrency; i++ {
-		go func() {
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case slot := <-jobs:
-					block, err := svc.(client.SignedBeaconBlockProvider).SignedBeaconBlock(ctx, fmt.Sprint(slot))
-					if err != nil {
-						// Hack to gracefully handle missing blocks from Prysm.
-						notFound := false
-						errString := err.Error()
-						for _, s := range []string{
-							"Could not get block from block ID: rpc error: code = NotFound",
-							"rpc error: code = NotFound desc = Could not find requested block: signed beacon block can't be nil", // v2.1.0
-							"Could not reconstruct full execution payload to create signed beacon block: block hash field in execution header",
-						} {
-							if strings.Contains(errString, s) {
-								notFound = true
-								break
-							}
-						}
-						if !notFound {
-							errs <- fmt.Errorf("failed to get block %d: %w", slot, err)
-							return
-						}
-						block = nil
-					}
 
-					// Print progress.
-					select {
-					case <-printTicker.C:
-						icon := "✅"
-						if block == nil {
-							icon = "❌"
-						}
-						slotsPerSecond := float64(rate.Rate()) / rateInterval.Seconds()
-						eta := time.Duration(float64(currentSlot-slot)/slotsPerSecond) * time.Second
-						log.Printf("%-10s %-8d %s %6.0f slots/s\teta: %s", network, slot, icon, slotsPerSecond, eta)
-					default:
-					}
+	// Resume after the scrape checkpoint, before which every slot of the
+	// window is already filled.
+	windowStart := startSlot
+	checkpoint, ok, err := store.AdvanceCheckpoint(windowStart)
+	if err != nil {
+		return errors.Wrap(err, "failed to advance checkpoint")
+	}
+	if ok {
+		startSlot = checkpoint + 1
+	}
+	log.Info().Int("deleted", deleted).Uint64("start_slot", uint64(startSlot)).Msg("purged outdated slots, starting")
+
+	// Start the pipeline which fetches and writes the blocks. When scrape
+	// returns, it's stopped, and the blocks it already fetched are written
+	// before it does, so that they needn't be fetched again after a restart.
+	progress := newScrapeProgress(store, network.Name, genesisTime, slotDuration, startSlot)
+	fetch := func(ctx context.Context, slot phase0.Slot) (*BlockWithRoot, error) {
+		block, err := fetchBlockWithRoot(ctx, svc, network, slot)
+		if err != nil {
+			return nil, err
+		}
+		progress.done(slot, block == nil)
+		return block, nil
+	}
+	pipeline := startScrapePipeline(ctx, store, network.Name, windowStart, network.ScrapeConcurrency, fetch)
+	defer func() {
+		// If the pipeline failed, that's what cut the run short.
+		if pipelineErr := pipeline.close(); pipelineErr != nil {
+			err = pipelineErr
+		}
+	}()
+
+	// The rest of the run stops along with the pipeline, so that when it
+	// fails (such as when every worker did), nothing is left waiting on it,
+	// and scrape returns to be restarted.
+	ctx = pipeline.Context()
+	go progress.run(ctx, log, *progressInterval)
+
+	// Get the current finalized checkpoint, which is then kept up to date by events.
+	finalityCtx, cancel := nodeContext(ctx)
+	finality, err := svc.(client.FinalityProvider).Finality(finalityCtx, &api.FinalityOpts{State: "head"})
+	cancel()
+	if err != nil {
+		return errors.Wrap(err, "failed to get finality")
+	}
+	if finality.Data.Finalized != nil {
+		if err := store.SetFinalized(finality.Data.Finalized); err != nil {
+			return errors.Wrap(err, "failed to set finalized checkpoint")
+		}
+	}
+
+	// Track the node's head slot, which is persisted for lag and served.
+	var headSlot phase0.Slot
+	setHeadSlot := func(slot phase0.Slot) {
+		headSlot = slot
+		if err := store.SetHeadSlot(slot); err != nil {
+			log.Error().Err(err).Msg("failed to set head slot")
+		}
+	}
+	nodeHeadSlot, err := fetchHeadSlot(ctx, svc)
+	if err != nil {
+		return err
+	}
+	setHeadSlot(nodeHeadSlot)
 
-					// Save it.
-					var blockWithRoot *BlockWithRoot
-					if block != nil {
-						blockWithRoot = &BlockWithRoot{VersionedSignedBeaconBlock: block}
-						blockWithRoot.BlockRoot, err = block.Root()
-						if err != nil {
-							errs <- errors.Wrap(err, "failed to get block root hash")
-							return
-						}
+	// Subscribe to chain reorgs to re-scrape replaced blocks, to finalized
+	// checkpoints, and to heads to track the head slot (and optionally to
+	// fetch new blocks as soon as they're seen). The client reconnects the
+	// event stream by itself if it drops.
+	heads := make(chan phase0.Slot, 1)
+	nextSlot := uint64(startSlot) // The slot the loop below is at.
+	topics := []string{"chain_reorg", "finalized_checkpoint", "head"}
+	err = svc.(client.EventsProvider).Events(ctx, topics, func(event *apiv1.Event) {
+		switch data := event.Data.(type) {
+		case *apiv1.HeadEvent:
+			if err := store.SetHeadSlot(data.Slot); err != nil {
+				log.Error().Err(err).Msg("failed to set head slot")
+			}
+			if !network.HeadEvents {
+				return
+			}
+			// Keep only the latest head.
+			select {
+			case <-heads:
+			default:
+			}
+			heads <- data.Slot
+		case *apiv1.FinalizedCheckpointEvent:
+			checkpoint := &phase0.Checkpoint{Epoch: data.Epoch, Root: data.Block}
+			if err := store.SetFinalized(checkpoint); err != nil {
+				log.Error().Err(err).Msg("failed to set finalized checkpoint")
+			}
+		case *apiv1.ChainReorgEvent:
+			// Nodes may report a depth past genesis, such as on a fresh
+			// chain, so don't let it wrap around.
+			from := phase0.Slot(0)
+			if phase0.Slot(data.Depth) <= data.Slot {
+				from = data.Slot - phase0.Slot(data.Depth)
+			}
+			invalidated, err := store.Invalidate(from, data.Slot)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to invalidate reorged slots")
+				return
+			}
+			log.Info().Uint64("depth", data.Depth).Uint64("slot", uint64(data.Slot)).Int("invalidated", len(invalidated)).Msg("reorg, re-scraping slots")
+			// Re-scrape only the slots the loop below has passed, leaving
+			// the rest to it, so that they still wait for confirmation.
+			reached := phase0.Slot(atomic.LoadUint64(&nextSlot))
+			go func() {
+				for _, slot := range invalidated {
+					if slot >= reached {
+						return
 					}
-					err = store.SetBlock(slot, blockWithRoot)
-					if err != nil {
-						errs <- errors.Wrap(err, "failed to set block")
+					progress.submitted(slot)
+					if pipeline.submit(slot) != nil {
 						return
 					}
-					rate.Incr(1)
 				}
-			}
-		}()
+			}()
+		}
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to subscribe to events")
 	}
 
 	// Scrape the blocks.
-	var headSlot phase0.Slot
 	for slot := startSlot; ; slot++ {
-		// Skip slot if it's already in the store.
+		atomic.StoreUint64(&nextSlot, uint64(slot))
+
+		// Skip past the slots already in the store. The producer is held
+		// back by the workers (since submit blocks until one takes the slot), so it's only the
+		// stored slots it could spin through, such as after a restart.
 		exists, err := store.Filled(slot)
 		if err != nil {
 			return errors.Wrap(err, "failed to check if block exists")
 		}
 		if exists {
+			next, err := store.FirstUnfilledSlot(slot)
+			if err != nil {
+				return errors.Wrap(err, "failed to find the first unfilled slot")
+			}
+			slot = next - 1
 			continue
 		}
 
-		// Wait for next block to be at least 12 slots behind.
-		futureSlot := slot + 12
-		futureSlotTime := genesisTime.Add(secondsPerSlot * time.Second * time.Duration(futureSlot))
-		if time.Now().Before(futureSlotTime) {
-			select {
-			case <-time.After(time.Until(futureSlotTime)):
-			case err := <-errs:
-				return err
-			case <-ctx.Done():
-				return nil
+		if network.HeadEvents {
+			// Wait for the node to see a head at least ConfirmationDepth
+			// slots past this slot.
+			for headSlot < slot+phase0.Slot(network.ConfirmationDepth) {
+				select {
+				case headSlot = <-heads:
+				case <-time.After(2 * slotDuration):
+					// The event stream may have dropped, so poll the node meanwhile.
+					nodeHeadSlot, err := fetchHeadSlot(ctx, svc)
+					if err != nil {
+						return err
+					}
+					setHeadSlot(nodeHeadSlot)
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		} else {
+			// Wait for next block to be at least ConfirmationDepth slots behind.
+			futureSlot := slot + phase0.Slot(network.ConfirmationDepth)
+			futureSlotTime := genesisTime.Add(slotDuration * time.Duration(futureSlot))
+			if time.Now().Before(futureSlotTime) {
+				select {
+				case <-time.After(time.Until(futureSlotTime)):
+				case <-ctx.Done():
+					return nil
+				}
 			}
-		}
 
-		// Wait for Beacon node to catch up.
-		for headSlot < futureSlot {
-			syncState, err := svc.(client.NodeSyncingProvider).NodeSyncing(ctx)
-			if err != nil {
-				return err
+			// Wait for Beacon node to catch up.
+			for headSlot < futureSlot {
+				nodeHeadSlot, err := fetchHeadSlot(ctx, svc)
+				if err != nil {
+					return err
+				}
+				setHeadSlot(nodeHeadSlot)
+				select {
+				case <-time.After(slotDuration):
+				case <-ctx.Done():
+					return nil
+				}
 			}
-			headSlot = syncState.HeadSlot
-			time.Sleep(time.Second * secondsPerSlot)
 		}
 
 		// Get the next block.
-		jobs <- slot
+		progress.submitted(slot)
+		if pipeline.submit(slot) != nil {
+			return nil
+		}
 	}
 }
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteSlotRange(t *testing.T) {
+	store := newTestStore(t)
+	require.NoError(t, store.SetBlock(2, testBlock(2)))
+	require.NoError(t, store.SetBlock(3, nil))
+	require.NoError(t, store.SetBlock(5, testBlock(5)))
+
+	opts := blockOptions{attestationsLimit: -1}
+	get := func(from, to phase0.Slot) []map[string]interface{} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, writeSlotRange(c, store, from, to, opts))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var resp []map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp
+	}
+
+	resp := get(1, 6)
+	require.Len(t, resp, 6)
+	for i, status := range []string{"unscraped", "block", "empty", "unscraped", "block", "unscraped"} {
+		require.Equal(t, float64(i+1), resp[i]["slot"])
+		require.Equal(t, status, resp[i]["status"])
+	}
+	require.Equal(t, "phase0", resp[1]["version"])
+	require.NotContains(t, resp[2], "data")
+
+	resp = get(10, 11)
+	require.Len(t, resp, 2)
+	require.Equal(t, "unscraped", resp[1]["status"])
+
+	// Selected fields which a block doesn't have are left out.
+	var err error
+	opts.fields, err = parseFields("root,data.message.body.execution_payload")
+	require.NoError(t, err)
+	resp = get(2, 3)
+	require.Equal(t, []map[string]interface{}{
+		{"slot": float64(2), "status": "block", "root": "0x0000000000000000000000000000000000000000000000000000000000000000"},
+		{"slot": float64(3), "status": "empty"},
+	}, resp)
+}
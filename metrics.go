@@ -0,0 +1,125 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	metricScrapedSlots = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blockbuster_scraped_slots_total",
+		Help: "Number of slots scraped, by whether they had a block or were empty.",
+	}, []string{"network", "kind"})
+	metricScrapeLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blockbuster_scrape_lag_slots",
+		Help: "How many slots the highest scraped slot is behind the current slot.",
+	}, []string{"network"})
+	metricScrapeRate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blockbuster_scrape_slots_per_second",
+		Help: "Rate at which slots are being scraped.",
+	}, []string{"network"})
+	metricNodeErrorRate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blockbuster_node_errors_per_second",
+		Help: "Rate at which block requests to a node fail, including those retried.",
+	}, []string{"network"})
+	metricEmptyRate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blockbuster_empty_slots_per_second",
+		Help: "Rate at which scraped slots turn out to have no block.",
+	}, []string{"network"})
+	metricScrapeETA = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blockbuster_scrape_eta_seconds",
+		Help: "Estimated time until the unscraped slots up to the head are scraped (+Inf if never, at the current rate).",
+	}, []string{"network"})
+	metricGCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "blockbuster_gc_duration_seconds",
+		Help:    "Duration of BadgerDB value log garbage collection runs.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+	}, []string{"network"})
+	metricHTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blockbuster_http_requests_total",
+		Help: "Number of HTTP requests, by route, method and status code.",
+	}, []string{"route", "method", "code"})
+	metricHTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "blockbuster_http_request_duration_seconds",
+		Help:    "Latency of HTTP requests, by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+	metricCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blockbuster_cache_requests_total",
+		Help: "Number of cache lookups, by cache and hit or miss.",
+	}, []string{"cache", "result"})
+	metricNodeTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blockbuster_node_timeouts_total",
+		Help: "Number of block requests to a node which timed out.",
+	}, []string{"network"})
+	metricNodeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blockbuster_node_errors_total",
+		Help: "Number of block requests to a node which failed, including those retried.",
+	}, []string{"network"})
+	metricDroppedSubscribers = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "blockbuster_dropped_subscribers_total",
+		Help: "Number of live block subscribers dropped for falling behind.",
+	})
+	metricStoreSize = prometheus.NewDesc(
+		"blockbuster_store_size_bytes",
+		"Size of the BadgerDB store on disk, by LSM tree and value log.",
+		[]string{"network", "kind"}, nil,
+	)
+)
+
+// registerMetrics registers all the metrics with the given registry.
+func registerMetrics(registry *prometheus.Registry) {
+	registry.MustRegister(
+		metricScrapedSlots,
+		metricScrapeLag,
+		metricScrapeRate,
+		metricNodeErrorRate,
+		metricEmptyRate,
+		metricScrapeETA,
+		metricGCDuration,
+		metricHTTPRequests,
+		metricHTTPDuration,
+		metricCacheRequests,
+		metricNodeTimeouts,
+		metricNodeErrors,
+		metricDroppedSubscribers,
+		storeCollector{},
+	)
+}
+
+// storeCollector collects the size of every open store.
+type storeCollector struct{}
+
+func (storeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricStoreSize
+}
+
+func (storeCollector) Collect(ch chan<- prometheus.Metric) {
+	stores.Range(func(network string, store *Store) bool {
+		lsm, vlog := store.db.Size()
+		ch <- prometheus.MustNewConstMetric(metricStoreSize, prometheus.GaugeValue, float64(lsm), network, "lsm")
+		ch <- prometheus.MustNewConstMetric(metricStoreSize, prometheus.GaugeValue, float64(vlog), network, "vlog")
+		return true
+	})
+}
+
+// metricsMiddleware records request counts and latencies by route template,
+// so that slot parameters don't blow up the label cardinality.
+func metricsMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+		if err != nil {
+			c.Error(err)
+		}
+		route := c.Path()
+		method := c.Request().Method
+		code := strconv.Itoa(c.Response().Status)
+		metricHTTPRequests.WithLabelValues(route, method, code).Inc()
+		metricHTTPDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+		return nil
+	}
+}
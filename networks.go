@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/labstack/echo"
+)
+
+// networkSummary describes a network's store, as served by /:network and
+// listed by /networks.
+type networkSummary struct {
+	Name           string       `json:"name"`
+	RetentionSlots uint64       `json:"retention_slots"`
+	LowestSlot     *phase0.Slot `json:"lowest_slot"`
+	HighestSlot    *phase0.Slot `json:"highest_slot"`
+	CheckpointSlot *phase0.Slot `json:"checkpoint_slot"`
+	Slots          int          `json:"slots"`
+	Blocks         int          `json:"blocks"`
+	HeadSlot       *phase0.Slot `json:"head_slot"`
+	LagSlots       *uint64      `json:"lag_slots"`
+}
+
+// summarizeNetwork summarizes the network's store. Fields which aren't
+// known yet are left nil.
+func summarizeNetwork(store *Store, network NetworkConfig) (*networkSummary, error) {
+	summary := &networkSummary{
+		Name:           network.Name,
+		RetentionSlots: network.RetentionSlots,
+	}
+	var err error
+	summary.Slots, summary.Blocks, err = store.CachedCount()
+	if err != nil {
+		return nil, err
+	}
+	if slot, ok, err := store.LowestFilledSlot(); err != nil {
+		return nil, err
+	} else if ok {
+		summary.LowestSlot = &slot
+	}
+	if slot, ok, err := store.HighestFilledSlot(); err != nil {
+		return nil, err
+	} else if ok {
+		summary.HighestSlot = &slot
+	}
+	if slot, ok, err := store.Checkpoint(); err != nil {
+		return nil, err
+	} else if ok {
+		summary.CheckpointSlot = &slot
+	}
+	if slot, ok, err := store.HeadSlot(); err != nil {
+		return nil, err
+	} else if ok {
+		summary.HeadSlot = &slot
+	}
+	if lag, ok, err := lagSlots(store, network); err != nil {
+		return nil, err
+	} else if ok {
+		summary.LagSlots = &lag
+	}
+	return summary, nil
+}
+
+// networksHandler lists the networks whose stores are open, sorted by name.
+func networksHandler(c echo.Context) error {
+	summaries := []*networkSummary{}
+	var err error
+	stores.Range(func(name string, store *Store) bool {
+		network, _ := networks.Get(name)
+		network.Name = name
+		var summary *networkSummary
+		summary, err = summarizeNetwork(store, network)
+		if err != nil {
+			return false
+		}
+		summaries = append(summaries, summary)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Name < summaries[j].Name
+	})
+	return c.JSON(http.StatusOK, summaries)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworksHandler(t *testing.T) {
+	for _, name := range []string{"networks-b", "networks-a"} {
+		store := newTestStore(t)
+		stores.Set(name, store)
+		networks.Set(name, NetworkConfig{Name: name, RetentionSlots: 100})
+		name := name
+		t.Cleanup(func() {
+			stores.Del(name)
+			networks.Del(name)
+		})
+		if name == "networks-a" {
+			require.NoError(t, store.SetBlock(3, testBlock(3)))
+			require.NoError(t, store.SetBlock(4, nil))
+			require.NoError(t, store.SetBlock(5, testBlock(5)))
+			require.NoError(t, store.SetHeadSlot(9))
+			_, _, err := store.AdvanceCheckpoint(3)
+			require.NoError(t, err)
+		}
+	}
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/networks", nil), rec)
+	require.NoError(t, networksHandler(c))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var summaries []*networkSummary
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &summaries))
+	require.Len(t, summaries, 2)
+
+	slot := func(s phase0.Slot) *phase0.Slot { return &s }
+	require.Equal(t, &networkSummary{
+		Name:           "networks-a",
+		RetentionSlots: 100,
+		LowestSlot:     slot(3),
+		HighestSlot:    slot(5),
+		CheckpointSlot: slot(5),
+		Slots:          3,
+		Blocks:         2,
+		HeadSlot:       slot(9),
+	}, summaries[0])
+	require.Equal(t, &networkSummary{Name: "networks-b", RetentionSlots: 100}, summaries[1])
+}
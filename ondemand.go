@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+)
+
+// fetchSlotHandler serves the block at a slot, fetching it from the node and
+// storing it first if it isn't stored, such as when it's older than the
+// retention window. Slots fetched from before the window are pinned, so that
+// they aren't purged straight away.
+func fetchSlotHandler(c echo.Context) error {
+	network := c.Param("network")
+	slot, err := strconv.Atoi(c.Param("slot"))
+	if err != nil || slot < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid slot")
+	}
+	opts, err := parseBlockOptions(c)
+	if err != nil {
+		return err
+	}
+	store, err := getStore(network)
+	if err != nil {
+		return err
+	}
+	block, err := fetchSlot(c.Request().Context(), store, network, phase0.Slot(slot))
+	if err != nil {
+		return err
+	}
+	if block == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "block not found")
+	}
+	setBlindedHeader(c, block.Blinded)
+	return writeBlock(c, block, opts)
+}
+
+// fetchSlot returns the block at the slot from the store, or otherwise from
+// the node, storing it.
+func fetchSlot(ctx context.Context, store *Store, network string, slot phase0.Slot) (*BlockWithRoot, error) {
+	filled, err := store.Filled(slot)
+	if err != nil {
+		return nil, err
+	}
+	if filled {
+		return loadBlock(store, slot)
+	}
+	return refetchSlot(ctx, store, network, slot, true)
+}
+
+// refetchSlot fetches the block at the slot from the node and stores it,
+// overwriting whatever is stored. With pin, the slot is pinned if it's from
+// before the retention window.
+func refetchSlot(ctx context.Context, store *Store, network string, slot phase0.Slot, pin bool) (*BlockWithRoot, error) {
+	svc, ok := nodes.Get(network)
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusServiceUnavailable, "not connected to the network's node")
+	}
+	networkSpec, err := store.Spec()
+	if err != nil {
+		return nil, err
+	}
+	headSlot, headKnown, err := store.HeadSlot()
+	if err != nil {
+		return nil, err
+	}
+	if networkSpec == nil || !headKnown {
+		return nil, echo.NewHTTPError(http.StatusServiceUnavailable, "network not scraped yet")
+	}
+	if slot > headSlot {
+		// The node would report it as empty, but it may yet have a block.
+		return nil, echo.NewHTTPError(http.StatusNotFound, "slot is after the node's head")
+	}
+
+	config, ok := networks.Get(network)
+	if !ok {
+		config = NetworkConfig{Name: network}
+	}
+	block, err := fetchBlockWithRoot(ctx, svc, config, slot)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch block")
+	}
+
+	if pin && slot < retentionStart(config, networkSpec) {
+		if err := store.Pin(slot); err != nil {
+			return nil, err
+		}
+	}
+	if err := store.SetBlock(slot, block); err != nil {
+		return nil, err
+	}
+	componentLogger("api", network).Info().Uint64("slot", uint64(slot)).Bool("block", block != nil).Msg("fetched slot on demand")
+	return block, nil
+}
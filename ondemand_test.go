@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNode serves the blocks it has, and a 404 for the rest, as the client
+// returns it.
+type fakeNode struct {
+	blocks map[string]*spec.VersionedSignedBeaconBlock
+}
+
+func (n *fakeNode) Name() string    { return "fake" }
+func (n *fakeNode) Address() string { return "fake" }
+func (n *fakeNode) IsActive() bool  { return true }
+func (n *fakeNode) IsSynced() bool  { return true }
+
+func (n *fakeNode) SignedBeaconBlock(ctx context.Context, opts *api.SignedBeaconBlockOpts) (*api.Response[*spec.VersionedSignedBeaconBlock], error) {
+	if block, ok := n.blocks[opts.Block]; ok {
+		return &api.Response[*spec.VersionedSignedBeaconBlock]{Data: block, Metadata: map[string]any{}}, nil
+	}
+	return nil, &api.Error{
+		Method:     http.MethodGet,
+		Endpoint:   "/eth/v2/beacon/blocks/" + opts.Block,
+		StatusCode: http.StatusNotFound,
+		Data:       []byte(`{"code":404,"message":"NOT_FOUND: beacon block"}`),
+	}
+}
+
+func TestFetchSlot(t *testing.T) {
+	const network = "ondemand"
+	store := newTestStore(t)
+	networks.Set(network, NetworkConfig{Name: network, RetentionSlots: 10})
+	t.Cleanup(func() { networks.Del(network) })
+	ctx := context.Background()
+
+	_, err := fetchSlot(ctx, store, network, 5)
+	require.ErrorContains(t, err, "not connected")
+
+	nodes.Set(network, &fakeNode{blocks: map[string]*spec.VersionedSignedBeaconBlock{
+		"5":  testBlock(5).VersionedSignedBeaconBlock,
+		"95": testBlock(95).VersionedSignedBeaconBlock,
+	}})
+	t.Cleanup(func() { nodes.Del(network) })
+	require.NoError(t, store.SetSpec(&NetworkSpec{
+		GenesisTime:    time.Now().Add(-100 * 12 * time.Second),
+		SecondsPerSlot: 12,
+		SlotsPerEpoch:  32,
+	}))
+	require.NoError(t, store.SetHeadSlot(100))
+
+	// Slots before the retention window are fetched, stored and pinned.
+	block, err := fetchSlot(ctx, store, network, 5)
+	require.NoError(t, err)
+	require.Equal(t, phase0.Slot(5), block.Phase0.Message.Slot)
+	empty, err := fetchSlot(ctx, store, network, 6)
+	require.NoError(t, err)
+	require.Nil(t, empty)
+	// Those within it aren't pinned, as they're purged when they fall out of it.
+	block, err = fetchSlot(ctx, store, network, 95)
+	require.NoError(t, err)
+	require.Equal(t, phase0.Slot(95), block.Phase0.Message.Slot)
+
+	_, err = store.Purge(0, 100)
+	require.NoError(t, err)
+	for slot, expected := range map[phase0.Slot]bool{5: true, 6: true, 95: false} {
+		filled, err := store.Filled(slot)
+		require.NoError(t, err)
+		require.Equal(t, expected, filled, "slot %d", slot)
+	}
+
+	// Stored slots are served without asking the node.
+	nodes.Del(network)
+	block, err = fetchSlot(ctx, store, network, 5)
+	require.NoError(t, err)
+	require.Equal(t, phase0.Slot(5), block.Phase0.Message.Slot)
+
+	// Slots after the node's head may yet have a block.
+	nodes.Set(network, &fakeNode{})
+	_, err = fetchSlot(ctx, store, network, 101)
+	require.ErrorContains(t, err, "after the node's head")
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/attestantio/go-eth2-client/spec/electra"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/labstack/echo"
+)
+
+// operation is a kind of rare operation in a block's body, such as deposits,
+// which can be fetched per slot and scanned for over a range of slots.
+type operation struct {
+	// name is the operation's route, such as "deposits".
+	name string
+
+	// eventType is the operation's type in the events endpoint, such as "deposit".
+	eventType string
+
+	// get returns the block's operations of this kind, and how many there are.
+	get func(fields *blockFields) (operations interface{}, count int)
+}
+
+var operations = []operation{
+	{"deposits", "deposit", func(f *blockFields) (interface{}, int) {
+		return f.Deposits, len(f.Deposits)
+	}},
+	{"voluntary-exits", "voluntary_exit", func(f *blockFields) (interface{}, int) {
+		return f.VoluntaryExits, len(f.VoluntaryExits)
+	}},
+	{"proposer-slashings", "proposer_slashing", func(f *blockFields) (interface{}, int) {
+		return f.ProposerSlashings, len(f.ProposerSlashings)
+	}},
+	{"attester-slashings", "attester_slashing", func(f *blockFields) (interface{}, int) {
+		return f.AttesterSlashings, len(f.AttesterSlashings)
+	}},
+
+	// Execution requests, from Electra.
+	{"deposit-requests", "deposit_request", func(f *blockFields) (interface{}, int) {
+		if f.ExecutionRequests == nil {
+			return []*electra.DepositRequest{}, 0
+		}
+		return f.ExecutionRequests.Deposits, len(f.ExecutionRequests.Deposits)
+	}},
+	{"withdrawal-requests", "withdrawal_request", func(f *blockFields) (interface{}, int) {
+		if f.ExecutionRequests == nil {
+			return []*electra.WithdrawalRequest{}, 0
+		}
+		return f.ExecutionRequests.Withdrawals, len(f.ExecutionRequests.Withdrawals)
+	}},
+	{"consolidation-requests", "consolidation_request", func(f *blockFields) (interface{}, int) {
+		if f.ExecutionRequests == nil {
+			return []*electra.ConsolidationRequest{}, 0
+		}
+		return f.ExecutionRequests.Consolidations, len(f.ExecutionRequests.Consolidations)
+	}},
+}
+
+// slotOperations are the operations of a kind in the block at a slot.
+type slotOperations struct {
+	Slot phase0.Slot `json:"slot"`
+	Data interface{} `json:"data"`
+}
+
+// operationHandler serves the operations of a kind in the block at a slot.
+// Empty slots have none, rather than not being found.
+func operationHandler(op operation) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		slot, err := strconv.Atoi(c.Param("slot"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid slot")
+		}
+		store, err := getStore(c.Param("network"))
+		if err != nil {
+			return err
+		}
+		block, err := loadBlock(store, phase0.Slot(slot))
+		if err != nil {
+			return err
+		}
+		if block == nil {
+			return writeJSON(c, []interface{}{})
+		}
+		fields, err := messageFields(block.VersionedSignedBeaconBlock)
+		if err != nil {
+			return err
+		}
+		operations, _ := op.get(fields)
+		return writeJSON(c, operations)
+	}
+}
+
+// operationRangeHandler serves the operations of a kind within a range of
+// slots (inclusive), scanned in a single pass, listing only the slots which
+// have any.
+func operationRangeHandler(op operation) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		from, to, err := parseSlotRange(c, *maxScanSlots)
+		if err != nil {
+			return err
+		}
+		store, err := getStore(c.Param("network"))
+		if err != nil {
+			return err
+		}
+		found := []*slotOperations{}
+		err = store.ForEachBlock(from, to, nil, func(slot phase0.Slot, block *BlockWithRoot) error {
+			fields, err := messageFields(block.VersionedSignedBeaconBlock)
+			if err != nil {
+				return err
+			}
+			if operations, count := op.get(fields); count > 0 {
+				found = append(found, &slotOperations{Slot: slot, Data: operations})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return writeJSON(c, found)
+	}
+}
+
+// slotEvents counts the operations of each requested type in a block.
+type slotEvents struct {
+	Slot   phase0.Slot    `json:"slot"`
+	Counts map[string]int `json:"counts"`
+}
+
+// eventsHandler scans a range of slots (inclusive) in a single pass for the
+// operations of the types in the types param (or of every type), listing
+// the slots which have any along with their counts, and the totals.
+func eventsHandler(c echo.Context) error {
+	ops := operations
+	if types := c.QueryParam("types"); types != "" {
+		ops = nil
+		for _, eventType := range strings.Split(types, ",") {
+			op, ok := operationByEventType(strings.TrimSpace(eventType))
+			if !ok {
+				return echo.NewHTTPError(http.StatusBadRequest, "unknown event type "+strconv.Quote(eventType))
+			}
+			ops = append(ops, op)
+		}
+	}
+	from, to, err := parseSlotRange(c, *maxScanSlots)
+	if err != nil {
+		return err
+	}
+	store, err := getStore(c.Param("network"))
+	if err != nil {
+		return err
+	}
+	found := []*slotEvents{}
+	totals := make(map[string]int, len(ops))
+	for _, op := range ops {
+		totals[op.eventType] = 0
+	}
+	err = store.ForEachBlock(from, to, nil, func(slot phase0.Slot, block *BlockWithRoot) error {
+		fields, err := messageFields(block.VersionedSignedBeaconBlock)
+		if err != nil {
+			return err
+		}
+		var events *slotEvents
+		for _, op := range ops {
+			_, count := op.get(fields)
+			if count == 0 {
+				continue
+			}
+			if events == nil {
+				events = &slotEvents{Slot: slot, Counts: map[string]int{}}
+				found = append(found, events)
+			}
+			events.Counts[op.eventType] = count
+			totals[op.eventType] += count
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return writeJSON(c, map[string]interface{}{
+		"slots":  found,
+		"totals": totals,
+	})
+}
+
+func operationByEventType(eventType string) (operation, bool) {
+	for _, op := range operations {
+		if op.eventType == eventType {
+			return op, true
+		}
+	}
+	return operation{}, false
+}
+
+// parseSlotRange parses the from and to query params of a range of at most
+// maxSlots slots (inclusive).
+func parseSlotRange(c echo.Context, maxSlots int) (from, to phase0.Slot, err error) {
+	fromParam, err := strconv.Atoi(c.QueryParam("from"))
+	if err != nil {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "invalid from slot")
+	}
+	toParam, err := strconv.Atoi(c.QueryParam("to"))
+	if err != nil {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "invalid to slot")
+	}
+	if fromParam < 0 || toParam < fromParam {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "invalid slot range")
+	}
+	if toParam-fromParam >= maxSlots {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "slot range too large")
+	}
+	return phase0.Slot(fromParam), phase0.Slot(toParam), nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationHandlers(t *testing.T) {
+	const network = "operations"
+	store := newTestStore(t)
+	stores.Set(network, store)
+	t.Cleanup(func() { stores.Del(network) })
+
+	exiting := testBlock(2)
+	exiting.Phase0.Message.Body.VoluntaryExits = []*phase0.SignedVoluntaryExit{
+		{Message: &phase0.VoluntaryExit{Epoch: 1, ValidatorIndex: 7}},
+	}
+	require.NoError(t, store.SetBlock(1, testBlock(1)))
+	require.NoError(t, store.SetBlock(2, exiting))
+	require.NoError(t, store.SetBlock(3, nil))
+
+	var exits operation
+	for _, op := range operations {
+		if op.name == "voluntary-exits" {
+			exits = op
+		}
+	}
+
+	e := echo.New()
+	serve := func(handler echo.HandlerFunc, target, slot string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, target, nil), rec)
+		c.SetParamNames("network", "slot")
+		c.SetParamValues(network, slot)
+		if err := handler(c); err != nil {
+			e.HTTPErrorHandler(err, c)
+		}
+		return rec
+	}
+
+	// Per slot.
+	rec := serve(operationHandler(exits), "/operations/2/voluntary-exits", "2")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var slotExits []*phase0.SignedVoluntaryExit
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &slotExits))
+	require.Len(t, slotExits, 1)
+	require.Equal(t, phase0.ValidatorIndex(7), slotExits[0].Message.ValidatorIndex)
+
+	rec = serve(operationHandler(exits), "/operations/3/voluntary-exits", "3")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, "[]", rec.Body.String())
+
+	// Over a range, only slots which have any are listed.
+	rec = serve(operationRangeHandler(exits), "/operations/voluntary-exits?from=0&to=10", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var found []struct {
+		Slot phase0.Slot                   `json:"slot"`
+		Data []*phase0.SignedVoluntaryExit `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &found))
+	require.Len(t, found, 1)
+	require.Equal(t, phase0.Slot(2), found[0].Slot)
+	require.Len(t, found[0].Data, 1)
+
+	rec = serve(operationRangeHandler(exits), "/operations/voluntary-exits?from=5&to=1", "")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = serve(operationRangeHandler(exits), "/operations/voluntary-exits?from=0&to=100000", "")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestEventsHandler(t *testing.T) {
+	const network = "events"
+	store := newTestStore(t)
+	stores.Set(network, store)
+	t.Cleanup(func() { stores.Del(network) })
+
+	block := testBlock(2)
+	block.Phase0.Message.Body.VoluntaryExits = []*phase0.SignedVoluntaryExit{
+		{Message: &phase0.VoluntaryExit{ValidatorIndex: 1}},
+		{Message: &phase0.VoluntaryExit{ValidatorIndex: 2}},
+	}
+	require.NoError(t, store.SetBlock(1, testBlock(1)))
+	require.NoError(t, store.SetBlock(2, block))
+	require.NoError(t, store.SetBlock(3, nil))
+
+	e := echo.New()
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, target, nil), rec)
+		c.SetParamNames("network")
+		c.SetParamValues(network)
+		if err := eventsHandler(c); err != nil {
+			e.HTTPErrorHandler(err, c)
+		}
+		return rec
+	}
+
+	rec := serve("/events/events?from=0&to=10")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{
+		"slots": [{"slot": 2, "counts": {"voluntary_exit": 2}}],
+		"totals": {"deposit": 0, "voluntary_exit": 2, "proposer_slashing": 0, "attester_slashing": 0}
+	}`, rec.Body.String())
+
+	rec = serve("/events/events?types=deposit,attester_slashing&from=0&to=10")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"slots": [], "totals": {"deposit": 0, "attester_slashing": 0}}`, rec.Body.String())
+
+	rec = serve("/events/events?types=withdrawal&from=0&to=10")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/binary"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// When a network keeps orphans, a block replaced by a different one at its
+// slot (such as after a reorg) is kept under keyOrphaned||slot||root, with
+// the same value it was stored with under keySlot.
+
+// orphanKey returns the key to keep the given stored block value under.
+func orphanKey(slot phase0.Slot, value []byte) []byte {
+	key := slotKey(keyOrphaned, slot)
+	return append(key, value[8:40]...)
+}
+
+// OrphanedBlocks returns the blocks which were replaced at the given slot.
+func (s *Store) OrphanedBlocks(slot phase0.Slot) ([]*BlockWithRoot, error) {
+	blocks := []*BlockWithRoot{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		prefix := slotKey(keyOrphaned, slot)
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prefix})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			err := it.Item().Value(func(val []byte) error {
+				block, err := decodeBlock(val)
+				if err != nil {
+					return err
+				}
+				blocks = append(blocks, block)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return blocks, err
+}
+
+// purgeOrphans removes the orphaned blocks within the given range (inclusive),
+// except those of pinned slots.
+func purgeOrphans(txn *badger.Txn, from, to phase0.Slot) error {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = keyOrphaned
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	for it.Seek(slotKey(keyOrphaned, from)); it.Valid(); it.Next() {
+		key := it.Item().KeyCopy(nil)
+		slot := phase0.Slot(binary.BigEndian.Uint64(key[len(keyOrphaned):]))
+		if slot > to {
+			break
+		}
+		if pinned, err := isPinned(txn, slot); err != nil {
+			return err
+		} else if pinned {
+			continue
+		}
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/labstack/echo"
+)
+
+// participation counts the attesters covered by a block's attestations. Since
+// aggregates of the same committee may overlap, the total is an upper bound
+// on the number of distinct validators, but a cheap proxy for network health.
+type participation struct {
+	Attesters    int                         `json:"attesters"`
+	Attestations []*attestationParticipation `json:"attestations"`
+}
+
+// attestationParticipation counts the aggregation bits set in an attestation.
+// From Electra, an attestation aggregates across the committees listed in
+// CommitteeIndices, the first of which is its CommitteeIndex, and its
+// CommitteeSize is theirs together.
+type attestationParticipation struct {
+	Slot             phase0.Slot             `json:"slot"`
+	CommitteeIndex   phase0.CommitteeIndex   `json:"committee_index"`
+	CommitteeIndices []phase0.CommitteeIndex `json:"committee_indices,omitempty"`
+	Attesters        int                     `json:"attesters"`
+	CommitteeSize    int                     `json:"committee_size"`
+}
+
+// ParticipationCache is a SlotCache of block participations.
+type ParticipationCache = SlotCache[*participation]
+
+// NewParticipationCache returns a cache holding up to size participations, or nil if size is zero.
+func NewParticipationCache(size int) *ParticipationCache {
+	return NewSlotCache[*participation]("participation", size)
+}
+
+// newParticipation returns the participation of the given block, which is
+// empty for empty slots.
+func newParticipation(block *BlockWithRoot) (*participation, error) {
+	p := &participation{Attestations: []*attestationParticipation{}}
+	if block == nil {
+		return p, nil
+	}
+	fields, err := messageFields(block.VersionedSignedBeaconBlock)
+	if err != nil {
+		return nil, err
+	}
+	for _, attestation := range fields.Attestations {
+		data, bits, committees, err := attestationBits(attestation)
+		if err != nil {
+			return nil, err
+		}
+		attesters := int(bits.Count())
+		p.Attesters += attesters
+		a := &attestationParticipation{
+			Slot:             data.Slot,
+			CommitteeIndex:   data.Index,
+			CommitteeIndices: committees,
+			Attesters:        attesters,
+			CommitteeSize:    int(bits.Len()),
+		}
+		if len(committees) > 0 {
+			a.CommitteeIndex = committees[0]
+		}
+		p.Attestations = append(p.Attestations, a)
+	}
+	return p, nil
+}
+
+// loadParticipation returns the participation of the block at the given slot
+// from the participation cache, or otherwise from the decoded block.
+func loadParticipation(store *Store, slot phase0.Slot) (*participation, error) {
+	if p, ok := participationCache.Get(store.network, slot); ok {
+		return p, nil
+	}
+	block, err := loadBlock(store, slot)
+	if err != nil {
+		return nil, err
+	}
+	p, err := newParticipation(block)
+	if err != nil {
+		return nil, err
+	}
+	participationCache.Add(store.network, slot, p)
+	return p, nil
+}
+
+// participationHandler serves the participation of the block at a slot.
+func participationHandler(c echo.Context) error {
+	slot, err := strconv.Atoi(c.Param("slot"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid slot")
+	}
+	store, err := getStore(c.Param("network"))
+	if err != nil {
+		return err
+	}
+	p, err := loadParticipation(store, phase0.Slot(slot))
+	if err != nil {
+		return err
+	}
+	return writeJSON(c, p)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/electra"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadParticipation(t *testing.T) {
+	store := newTestStore(t)
+	store.network = "participation"
+	prevCache := participationCache
+	participationCache = NewParticipationCache(10)
+	store.participationCache = participationCache
+	t.Cleanup(func() { participationCache = prevCache })
+
+	block := testBlock(2)
+	block.Phase0.Message.Body.Attestations = []*phase0.Attestation{
+		{
+			// A committee of 4, of which bits 1 and 3 are set.
+			AggregationBits: []byte{0x1a},
+			Data:            &phase0.AttestationData{Slot: 1, Index: 5, Source: &phase0.Checkpoint{}, Target: &phase0.Checkpoint{}},
+		},
+		{
+			// A committee of 2, of which bit 0 is set.
+			AggregationBits: []byte{0x05},
+			Data:            &phase0.AttestationData{Slot: 1, Index: 6, Source: &phase0.Checkpoint{}, Target: &phase0.Checkpoint{}},
+		},
+	}
+	require.NoError(t, store.SetBlock(2, block))
+	require.NoError(t, store.SetBlock(3, nil))
+
+	p, err := loadParticipation(store, 2)
+	require.NoError(t, err)
+	require.Equal(t, &participation{
+		Attesters: 3,
+		Attestations: []*attestationParticipation{
+			{Slot: 1, CommitteeIndex: 5, Attesters: 2, CommitteeSize: 4},
+			{Slot: 1, CommitteeIndex: 6, Attesters: 1, CommitteeSize: 2},
+		},
+	}, p)
+	cached, ok := participationCache.Get(store.network, 2)
+	require.True(t, ok)
+	require.Same(t, p, cached)
+
+	// Empty slots have none.
+	p, err = loadParticipation(store, 3)
+	require.NoError(t, err)
+	require.Equal(t, &participation{Attestations: []*attestationParticipation{}}, p)
+
+	// Rewriting the slot evicts it.
+	require.NoError(t, store.SetBlock(2, testBlock(2)))
+	_, ok = participationCache.Get(store.network, 2)
+	require.False(t, ok)
+
+	// Electra attestations aggregate across the committees in their
+	// committee bits.
+	electraBlock := testForkBlocks()[5]
+	electraBlock.Electra.Message.Slot = 4
+	electraBlock.Electra.Message.Body.Attestations = []*electra.Attestation{{
+		// Committees 0 and 2, of 4 members together, of which bits 1 and 3 are set.
+		AggregationBits: []byte{0x1a},
+		Data:            &phase0.AttestationData{Slot: 3, Source: &phase0.Checkpoint{}, Target: &phase0.Checkpoint{}},
+		CommitteeBits:   []byte{0x05, 0, 0, 0, 0, 0, 0, 0},
+	}}
+	require.NoError(t, store.SetBlock(4, &BlockWithRoot{VersionedSignedBeaconBlock: electraBlock}))
+	p, err = loadParticipation(store, 4)
+	require.NoError(t, err)
+	require.Equal(t, &participation{
+		Attesters: 2,
+		Attestations: []*attestationParticipation{
+			{Slot: 3, CommitteeIndex: 0, CommitteeIndices: []phase0.CommitteeIndex{0, 2}, Attesters: 2, CommitteeSize: 4},
+		},
+	}, p)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/binary"
+	"net/http"
+	"strconv"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/labstack/echo"
+)
+
+// A pinned slot is marked by the key keyPin||slot, and survives Purge.
+
+// Pin marks the slot to survive purges, and expiry.
+func (s *Store) Pin(slot phase0.Slot) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Set(slotKey(keyPin, slot), nil); err != nil {
+			return err
+		}
+		return persist(txn, slot)
+	})
+}
+
+// Unpin lets the slot be purged again, once it's outside the retention window.
+func (s *Store) Unpin(slot phase0.Slot) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(slotKey(keyPin, slot))
+	})
+}
+
+// Pins returns the pinned slots in ascending order.
+func (s *Store) Pins() ([]phase0.Slot, error) {
+	slots := []phase0.Slot{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = keyPin
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			slots = append(slots, phase0.Slot(binary.BigEndian.Uint64(it.Item().Key()[len(keyPin):])))
+		}
+		return nil
+	})
+	return slots, err
+}
+
+// isPinned returns whether the slot is pinned.
+func isPinned(txn *badger.Txn, slot phase0.Slot) (bool, error) {
+	_, err := txn.Get(slotKey(keyPin, slot))
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// pinsHandler lists the network's pinned slots.
+func pinsHandler(c echo.Context) error {
+	store, err := getStore(c.Param("network"))
+	if err != nil {
+		return err
+	}
+	slots, err := store.Pins()
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"slots": slots})
+}
+
+// pinHandler pins the slot, or unpins it for DELETE requests.
+func pinHandler(c echo.Context) error {
+	slot, err := strconv.ParseUint(c.Param("slot"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid slot")
+	}
+	store, err := getStore(c.Param("network"))
+	if err != nil {
+		return err
+	}
+	if c.Request().Method == http.MethodDelete {
+		err = store.Unpin(phase0.Slot(slot))
+	} else {
+		err = store.Pin(phase0.Slot(slot))
+	}
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPins(t *testing.T) {
+	store := newTestStore(t)
+	store.keepOrphans = true
+
+	for slot := phase0.Slot(1); slot <= 5; slot++ {
+		require.NoError(t, store.SetBlock(slot, testBlock(slot)))
+	}
+	// Orphan a block at slot 3.
+	replacement := testBlock(3)
+	replacement.BlockRoot = phase0.Root{3}
+	require.NoError(t, store.SetBlock(3, replacement))
+
+	require.NoError(t, store.Pin(3))
+	require.NoError(t, store.Pin(9))
+	pins, err := store.Pins()
+	require.NoError(t, err)
+	require.Equal(t, []phase0.Slot{3, 9}, pins)
+
+	// A pinned slot survives a purge covering it, along with its orphans.
+	deleted, err := store.Purge(0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 4, deleted)
+	filled, err := store.Filled(3)
+	require.NoError(t, err)
+	require.True(t, filled)
+	orphans, err := store.OrphanedBlocks(3)
+	require.NoError(t, err)
+	require.Len(t, orphans, 1)
+
+	// Once unpinned, it's purged.
+	require.NoError(t, store.Unpin(3))
+	deleted, err = store.Purge(0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+	filled, err = store.Filled(3)
+	require.NoError(t, err)
+	require.False(t, filled)
+	pins, err = store.Pins()
+	require.NoError(t, err)
+	require.Equal(t, []phase0.Slot{9}, pins)
+}
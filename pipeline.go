@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/pkg/errors"
+)
+
+// scrapePipeline fetches the slots submitted to it with a pool of workers,
+// and writes the fetched blocks to the store in batches. The first error
+// stops it as a whole, so that neither the workers nor the submitter are
+// left waiting on each other.
+type scrapePipeline struct {
+	store   *Store
+	network string
+	start   phase0.Slot
+	fetch   func(ctx context.Context, slot phase0.Slot) (*BlockWithRoot, error)
+
+	ctx     context.Context
+	cancel  func()
+	jobs    chan phase0.Slot
+	results chan scrapeResult
+	workers sync.WaitGroup
+	writer  sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+type scrapeResult struct {
+	slot  phase0.Slot
+	block *BlockWithRoot
+}
+
+// startScrapePipeline starts a pipeline which runs until ctx is done, it
+// fails or it's closed. fetch returns the block at a slot, or nil if it has
+// none, and is called by concurrency workers at once. start is the first slot
+// of the scraped window, from which the scrape checkpoint is advanced.
+func startScrapePipeline(ctx context.Context, store *Store, network string, start phase0.Slot, concurrency int, fetch func(ctx context.Context, slot phase0.Slot) (*BlockWithRoot, error)) *scrapePipeline {
+	p := &scrapePipeline{
+		store:   store,
+		network: network,
+		start:   start,
+		fetch:   fetch,
+		jobs:    make(chan phase0.Slot),
+		results: make(chan scrapeResult),
+	}
+	p.ctx, p.cancel = context.WithCancel(ctx)
+	for i := 0; i < concurrency; i++ {
+		p.workers.Add(1)
+		go p.work()
+	}
+	p.writer.Add(1)
+	go p.write()
+	return p
+}
+
+// fail stops the pipeline with the given error, unless it already failed.
+func (p *scrapePipeline) fail(err error) {
+	p.mu.Lock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.mu.Unlock()
+	p.cancel()
+}
+
+// Context returns a context which is canceled once the pipeline stops.
+func (p *scrapePipeline) Context() context.Context {
+	return p.ctx
+}
+
+// Done returns a channel which is closed once the pipeline stops.
+func (p *scrapePipeline) Done() <-chan struct{} {
+	return p.ctx.Done()
+}
+
+// Err returns the error which the pipeline failed with, or nil if it didn't
+// (such as when it was stopped by its context).
+func (p *scrapePipeline) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// submit queues the slot to be fetched, and returns an error if the pipeline
+// stopped first: its failure, or otherwise its context's error.
+func (p *scrapePipeline) submit(slot phase0.Slot) error {
+	select {
+	case p.jobs <- slot:
+		return nil
+	case <-p.ctx.Done():
+		if err := p.Err(); err != nil {
+			return err
+		}
+		return p.ctx.Err()
+	}
+}
+
+// close stops the pipeline, waiting for the blocks already fetched to be
+// written, and returns the error it failed with, if any.
+func (p *scrapePipeline) close() error {
+	p.cancel()
+	p.workers.Wait()
+	close(p.results)
+	p.writer.Wait()
+	return p.Err()
+}
+
+func (p *scrapePipeline) work() {
+	defer p.workers.Done()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case slot := <-p.jobs:
+			block, err := p.fetch(p.ctx, slot)
+			if err != nil {
+				// Fetches cut short by stopping aren't failures.
+				if p.ctx.Err() == nil {
+					p.fail(err)
+				}
+				return
+			}
+			// The writer takes results until the workers are done.
+			p.results <- scrapeResult{slot, block}
+		}
+	}
+}
+
+// write writes the fetched blocks in batches, until results is closed.
+// After a write fails, the rest of the results are dropped.
+func (p *scrapePipeline) write() {
+	defer p.writer.Done()
+	flushTicker := time.NewTicker(time.Second)
+	defer flushTicker.Stop()
+	batch := make(map[phase0.Slot]*BlockWithRoot, scrapeBatchSize)
+	failed := false
+	flush := func() {
+		if len(batch) == 0 || failed {
+			return
+		}
+		if err := p.store.SetBlocks(batch); err != nil {
+			failed = true
+			p.fail(errors.Wrap(err, "failed to set blocks"))
+			return
+		}
+		if _, _, err := p.store.AdvanceCheckpoint(p.start); err != nil {
+			failed = true
+			p.fail(errors.Wrap(err, "failed to advance checkpoint"))
+			return
+		}
+		scrapeStatusOf(p.network).scraped(time.Now())
+		for _, block := range batch {
+			if block != nil {
+				metricScrapedSlots.WithLabelValues(p.network, "block").Inc()
+			} else {
+				metricScrapedSlots.WithLabelValues(p.network, "empty").Inc()
+			}
+		}
+		batch = make(map[phase0.Slot]*BlockWithRoot, scrapeBatchSize)
+	}
+	for {
+		select {
+		case result, ok := <-p.results:
+			if !ok {
+				flush()
+				return
+			}
+			if failed {
+				continue
+			}
+			batch[result.slot] = result.block
+			if len(batch) >= scrapeBatchSize {
+				flush()
+			}
+		case <-flushTicker.C:
+			flush()
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+// flakyNode fails the first request for each block, as a node which is
+// briefly unavailable does.
+type flakyNode struct {
+	fakeNode
+	mu     sync.Mutex
+	failed map[string]bool
+}
+
+func (n *flakyNode) SignedBeaconBlock(ctx context.Context, opts *api.SignedBeaconBlockOpts) (*api.Response[*spec.VersionedSignedBeaconBlock], error) {
+	n.mu.Lock()
+	failed := n.failed[opts.Block]
+	n.failed[opts.Block] = true
+	n.mu.Unlock()
+	if !failed {
+		return nil, errors.New("connection refused")
+	}
+	return n.fakeNode.SignedBeaconBlock(ctx, opts)
+}
+
+// within fails the test if fn doesn't return in time, such as when the
+// pipeline deadlocks.
+func within(t *testing.T, timeout time.Duration, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatal("timed out")
+	}
+}
+
+func TestScrapePipeline(t *testing.T) {
+	// The store is closed first, so that only the pipeline's goroutines
+	// could be left behind. The rate counters' stop once their windows
+	// empty. Run with -race to also check the pipeline's synchronization.
+	ignore := goleak.IgnoreCurrent()
+	noLeaks := func(t *testing.T, store *Store) {
+		require.NoError(t, store.Close())
+		goleak.VerifyNone(t, ignore, goleak.IgnoreTopFunction("github.com/paulbellamy/ratecounter.(*RateCounter).run.func1"))
+	}
+	blocks := func(slots ...phase0.Slot) map[string]*spec.VersionedSignedBeaconBlock {
+		blocks := make(map[string]*spec.VersionedSignedBeaconBlock)
+		for _, slot := range slots {
+			blocks[fmt.Sprint(slot)] = testBlock(slot).VersionedSignedBeaconBlock
+		}
+		return blocks
+	}
+	fetchFrom := func(node *fakeNode) func(ctx context.Context, slot phase0.Slot) (*BlockWithRoot, error) {
+		return func(ctx context.Context, slot phase0.Slot) (*BlockWithRoot, error) {
+			block, err := getBlock(ctx, node, slot)
+			if isBlockNotFound(err) {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			return &BlockWithRoot{VersionedSignedBeaconBlock: block}, nil
+		}
+	}
+
+	t.Run("Shutdown", func(t *testing.T) {
+		store := newTestStore(t)
+		node := &fakeNode{blocks: blocks(1, 2, 4)}
+		pipeline := startScrapePipeline(context.Background(), store, "pipeline", 0, 4, fetchFrom(node))
+		within(t, 5*time.Second, func() {
+			for slot := phase0.Slot(0); slot < 6; slot++ {
+				require.NoError(t, pipeline.submit(slot))
+			}
+			require.NoError(t, pipeline.close())
+		})
+
+		// The blocks fetched before closing are written.
+		empty, unscraped, err := store.MissingSlots(0, 5)
+		require.NoError(t, err)
+		require.Equal(t, []phase0.Slot{0, 3, 5}, empty)
+		require.Empty(t, unscraped)
+		noLeaks(t, store)
+	})
+
+	t.Run("TransientError", func(t *testing.T) {
+		store := newTestStore(t)
+		node := &flakyNode{fakeNode: fakeNode{blocks: blocks(1, 2)}, failed: make(map[string]bool)}
+		fetch := func(ctx context.Context, slot phase0.Slot) (*BlockWithRoot, error) {
+			block, err := fetchBlock(ctx, node, "pipeline", slot)
+			if err != nil || block == nil {
+				return nil, err
+			}
+			return &BlockWithRoot{VersionedSignedBeaconBlock: block}, nil
+		}
+		pipeline := startScrapePipeline(context.Background(), store, "pipeline", 0, 2, fetch)
+		within(t, 10*time.Second, func() {
+			for slot := phase0.Slot(0); slot < 4; slot++ {
+				require.NoError(t, pipeline.submit(slot))
+			}
+		})
+		// Closing would cut short the retries still in progress.
+		require.Eventually(t, func() bool {
+			filled, err := store.Filled(3)
+			return err == nil && filled
+		}, 5*time.Second, 10*time.Millisecond)
+		require.NoError(t, pipeline.close())
+
+		// The failed requests are retried rather than failing the pipeline.
+		empty, unscraped, err := store.MissingSlots(0, 3)
+		require.NoError(t, err)
+		require.Equal(t, []phase0.Slot{0, 3}, empty)
+		require.Empty(t, unscraped)
+		noLeaks(t, store)
+	})
+
+	t.Run("PermanentError", func(t *testing.T) {
+		store := newTestStore(t)
+		errFailed := errors.New("failed")
+		fetch := func(ctx context.Context, slot phase0.Slot) (*BlockWithRoot, error) {
+			if slot >= 3 {
+				return nil, errFailed
+			}
+			return nil, nil
+		}
+		pipeline := startScrapePipeline(context.Background(), store, "pipeline", 0, 2, fetch)
+
+		// Once every worker failed, submitting doesn't block, but returns
+		// the first error.
+		within(t, 5*time.Second, func() {
+			var err error
+			for slot := phase0.Slot(0); err == nil; slot++ {
+				err = pipeline.submit(slot)
+			}
+			require.ErrorIs(t, err, errFailed)
+			<-pipeline.Done()
+			require.ErrorIs(t, pipeline.Err(), errFailed)
+			require.ErrorIs(t, pipeline.close(), errFailed)
+		})
+		noLeaks(t, store)
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		store := newTestStore(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		fetched := make(chan struct{})
+		fetch := func(ctx context.Context, slot phase0.Slot) (*BlockWithRoot, error) {
+			if slot == 0 {
+				return nil, nil
+			}
+			fetched <- struct{}{}
+			// Hang until stopped, as a request to an unresponsive node does.
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		pipeline := startScrapePipeline(ctx, store, "pipeline", 0, 2, fetch)
+		within(t, 5*time.Second, func() {
+			require.NoError(t, pipeline.submit(0))
+			require.NoError(t, pipeline.submit(1))
+			<-fetched
+			cancel()
+
+			// Being stopped isn't a failure.
+			require.ErrorIs(t, pipeline.submit(2), context.Canceled)
+			require.NoError(t, pipeline.Err())
+			require.NoError(t, pipeline.close())
+		})
+		filled, err := store.Filled(0)
+		require.NoError(t, err)
+		require.True(t, filled)
+		filled, err = store.Filled(1)
+		require.NoError(t, err)
+		require.False(t, filled)
+		noLeaks(t, store)
+	})
+}
+
+func TestScrapePipelineAllWorkersFail(t *testing.T) {
+	store := newTestStore(t)
+	errFailed := errors.New("failed")
+	fetch := func(ctx context.Context, slot phase0.Slot) (*BlockWithRoot, error) {
+		return nil, errFailed
+	}
+	pipeline := startScrapePipeline(context.Background(), store, "pipeline", 0, 4, fetch)
+
+	// A producer like scrape's, which waits on the run's context between
+	// slots, returns once every worker failed rather than blocking forever.
+	ctx := pipeline.Context()
+	produce := func() error {
+		for slot := phase0.Slot(0); ; slot++ {
+			if slot >= 4 {
+				// Wait for a slot which is far off.
+				select {
+				case <-time.After(time.Hour):
+				case <-ctx.Done():
+					return nil
+				}
+			}
+			if pipeline.submit(slot) != nil {
+				return nil
+			}
+		}
+	}
+	within(t, 5*time.Second, func() {
+		require.NoError(t, produce())
+		require.ErrorIs(t, pipeline.close(), errFailed)
+	})
+	require.ErrorIs(t, ctx.Err(), context.Canceled)
+}
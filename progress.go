@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/paulbellamy/ratecounter"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// How often progress is logged with -quiet.
+	quietProgressInterval = time.Minute
+
+	// How often the scrape rate is sampled, and the ETA recomputed.
+	progressSampleInterval = time.Second
+
+	// Window over which the rates of fetched slots, empty slots and failed
+	// block requests are counted.
+	rateWindow = 30 * time.Second
+)
+
+// scrapeProgress tracks how far a scrape got, for logging its progress.
+//
+// Its frontier is the lowest slot which was submitted but not yet fetched,
+// or else the slot after the last one submitted, so that every slot before it
+// was fetched (or was already stored). The ETA is of the slots which remain
+// unscraped from the frontier up to the node's head, at the windowed rate,
+// rather than of the distance from whichever slot a worker last finished.
+type scrapeProgress struct {
+	store        *Store
+	network      string
+	genesisTime  time.Time
+	slotDuration time.Duration
+
+	mu      sync.Mutex
+	pending map[phase0.Slot]int // How many times each slot is in progress.
+	next    phase0.Slot
+	fetched int
+	empty   int // How many of the fetched slots had no block.
+
+	rate      *ratecounter.RateCounter
+	emptyRate *ratecounter.RateCounter
+}
+
+// newScrapeProgress returns the progress of a scrape starting at the given slot.
+func newScrapeProgress(store *Store, network string, genesisTime time.Time, slotDuration time.Duration, start phase0.Slot) *scrapeProgress {
+	return &scrapeProgress{
+		store:        store,
+		network:      network,
+		genesisTime:  genesisTime,
+		slotDuration: slotDuration,
+		pending:      make(map[phase0.Slot]int),
+		next:         start,
+		rate:         ratecounter.NewRateCounter(rateWindow),
+		emptyRate:    ratecounter.NewRateCounter(rateWindow),
+	}
+}
+
+// submitted records that the slot is about to be fetched.
+func (p *scrapeProgress) submitted(slot phase0.Slot) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending[slot]++
+	if slot >= p.next {
+		p.next = slot + 1
+	}
+}
+
+// done records that the slot was fetched, and whether it had no block.
+func (p *scrapeProgress) done(slot phase0.Slot, empty bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending[slot]--; p.pending[slot] <= 0 {
+		delete(p.pending, slot)
+	}
+	p.fetched++
+	p.rate.Incr(1)
+	if empty {
+		p.empty++
+		p.emptyRate.Incr(1)
+	}
+}
+
+// counts returns how many slots were fetched, and how many of them were empty.
+func (p *scrapeProgress) counts() (fetched, empty int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.fetched, p.empty
+}
+
+// frontier returns the slot every slot before which was fetched.
+func (p *scrapeProgress) frontier() phase0.Slot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	frontier := p.next
+	for slot := range p.pending {
+		if slot < frontier {
+			frontier = slot
+		}
+	}
+	return frontier
+}
+
+// remaining returns how many slots from the frontier up to the node's head
+// (or the current slot, if it's unknown) remain unscraped.
+func (p *scrapeProgress) remaining(now time.Time) (int, error) {
+	head, ok, err := p.store.HeadSlot()
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		head = phase0.Slot(now.Sub(p.genesisTime) / p.slotDuration)
+	}
+	return p.store.CountUnscraped(p.frontier(), head)
+}
+
+// eta returns how long until the remaining slots are scraped at the given
+// rate, accounting for a new slot coming every slot duration meanwhile.
+// Returns false if they never would be.
+func (p *scrapeProgress) eta(remaining int, slotsPerSecond float64) (time.Duration, bool) {
+	if remaining == 0 {
+		return 0, true
+	}
+	gain := slotsPerSecond - 1/p.slotDuration.Seconds()
+	if gain <= 0 {
+		return 0, false
+	}
+	seconds := float64(remaining) / gain
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second), true
+}
+
+// run samples the progress into metrics, and logs it every interval (or
+// every quietProgressInterval as a summary with -quiet), until the context
+// is done. Intervals in which nothing happened aren't logged, and an interval
+// of 0 disables logging.
+func (p *scrapeProgress) run(ctx context.Context, log *zerolog.Logger, interval time.Duration) {
+	message := "scraping"
+	if *quiet {
+		interval = quietProgressInterval
+		message = "scrape summary"
+	}
+	sampler := time.NewTicker(progressSampleInterval)
+	defer sampler.Stop()
+	var logs <-chan time.Time
+	if interval > 0 {
+		logger := time.NewTicker(interval)
+		defer logger.Stop()
+		logs = logger.C
+	}
+
+	// The latest sample. Failed requests and empty slots are tracked apart,
+	// to tell a node returning errors from slots which are genuinely empty.
+	var (
+		slotsPerSecond  float64
+		errorsPerSecond float64
+		emptyPerSecond  float64
+		remaining       int
+		eta             time.Duration
+		etaOK           bool
+	)
+	errorCounter := metricNodeErrors.WithLabelValues(p.network)
+	status := scrapeStatusOf(p.network)
+
+	loggedFetched, loggedEmpty, loggedErrors := 0, 0, counterValue(errorCounter)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case now := <-sampler.C:
+			slotsPerSecond = perSecond(p.rate)
+			emptyPerSecond = perSecond(p.emptyRate)
+			errorsPerSecond = perSecond(status.errors)
+			metricNodeErrorRate.WithLabelValues(p.network).Set(errorsPerSecond)
+			metricEmptyRate.WithLabelValues(p.network).Set(emptyPerSecond)
+			status.setRates(errorsPerSecond, emptyPerSecond)
+
+			var err error
+			remaining, err = p.remaining(now)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to count the remaining slots")
+				continue
+			}
+			eta, etaOK = p.eta(remaining, slotsPerSecond)
+			metricScrapeRate.WithLabelValues(p.network).Set(slotsPerSecond)
+			if etaOK {
+				metricScrapeETA.WithLabelValues(p.network).Set(eta.Seconds())
+			} else {
+				metricScrapeETA.WithLabelValues(p.network).Set(math.Inf(1))
+			}
+
+		case <-logs:
+			fetched, empty := p.counts()
+			errors := counterValue(errorCounter)
+			if fetched == loggedFetched && errors == loggedErrors {
+				// Nothing happened, such as while waiting for new slots.
+				continue
+			}
+
+			event := log.Info().
+				Int("slots", fetched-loggedFetched).
+				Uint64("slot", uint64(p.frontier())).
+				Int("remaining", remaining).
+				Float64("slots_per_second", math.Round(slotsPerSecond)).
+				Int("empty", empty-loggedEmpty).
+				Int("errors", int(errors-loggedErrors)).
+				Float64("errors_per_second", math.Round(errorsPerSecond*100)/100)
+			if etaOK {
+				event = event.Str("eta", eta.String())
+			} else {
+				event = event.Str("eta", "never")
+			}
+			event.Msg(message)
+			loggedFetched, loggedEmpty, loggedErrors = fetched, empty, errors
+		}
+	}
+}
+
+// perSecond returns the rate counted over the rate window, per second.
+func perSecond(rate *ratecounter.RateCounter) float64 {
+	return float64(rate.Rate()) / rateWindow.Seconds()
+}
+
+// counterValue returns the current value of a counter.
+func counterValue(counter interface{ Write(*dto.Metric) error }) float64 {
+	var m dto.Metric
+	if err := counter.Write(&m); err != nil {
+		return 0
+	}
+	return m.GetCounter().GetValue()
+}
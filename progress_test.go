@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScrapeProgress(t *testing.T) {
+	store := newTestStore(t)
+	genesisTime := time.Unix(0, 0)
+	progress := newScrapeProgress(store, "progress", genesisTime, 12*time.Second, 100)
+	require.Equal(t, phase0.Slot(100), progress.frontier())
+
+	// The frontier is held back by the slots still in progress, rather than
+	// following the last slot done.
+	for slot := phase0.Slot(100); slot < 104; slot++ {
+		progress.submitted(slot)
+	}
+	progress.done(101, false)
+	progress.done(103, true)
+	require.Equal(t, phase0.Slot(100), progress.frontier())
+	progress.done(100, false)
+	require.Equal(t, phase0.Slot(102), progress.frontier())
+	progress.done(102, false)
+	require.Equal(t, phase0.Slot(104), progress.frontier())
+
+	// A slot re-queued behind it (such as after a reorg) holds it back again.
+	progress.submitted(50)
+	require.Equal(t, phase0.Slot(50), progress.frontier())
+	progress.done(50, false)
+	require.Equal(t, phase0.Slot(104), progress.frontier())
+	fetched, empty := progress.counts()
+	require.Equal(t, 5, fetched)
+	require.Equal(t, 1, empty)
+	require.Equal(t, 5/rateWindow.Seconds(), perSecond(progress.rate))
+	require.Equal(t, 1/rateWindow.Seconds(), perSecond(progress.emptyRate))
+
+	// What remains are the unscraped slots up to the head, or else the
+	// current slot, skipping those already stored ahead of the frontier.
+	now := genesisTime.Add(304 * 12 * time.Second)
+	remaining, err := progress.remaining(now)
+	require.NoError(t, err)
+	require.Equal(t, 201, remaining)
+	require.NoError(t, store.SetBlocks(map[phase0.Slot]*BlockWithRoot{
+		150: nil,
+		151: testBlock(151),
+	}))
+	require.NoError(t, store.SetHeadSlot(203))
+	remaining, err = progress.remaining(now)
+	require.NoError(t, err)
+	require.Equal(t, 98, remaining)
+
+	// The ETA accounts for the chain moving on at a slot every 12 seconds.
+	eta, ok := progress.eta(100, 1.0/12+1)
+	require.True(t, ok)
+	require.Equal(t, 100*time.Second, eta)
+	_, ok = progress.eta(100, 1.0/12)
+	require.False(t, ok)
+	eta, ok = progress.eta(0, 0)
+	require.True(t, ok)
+	require.Zero(t, eta)
+}
+
+func TestCounterValue(t *testing.T) {
+	counter := metricNodeErrors.WithLabelValues("counter")
+	before := counterValue(counter)
+	counter.Add(3)
+	require.Equal(t, before+3, counterValue(counter))
+}
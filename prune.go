@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// With prune_empty, empty slots get no record, saving its write and its key,
+// and are only recorded as empty in the bitmaps (see bitmap.go). Filled and
+// FirstUnfilledSlot consult the bitmaps for slots without a record, so that
+// pruned slots aren't fetched again, HighestFilledSlot and CachedCount do so
+// that lag and counts include them, and Invalidate and Purge cover them too.
+// Bitmaps rebuilt from the records lose them though, and they're then taken
+// as unscraped. Since replicas only pull the records, and bitmaps expire by
+// bucket rather than by slot, prune_empty is refused along with expire_by_ttl
+// and on replicas, and a primary with it refuses to export.
+
+// prunedEmpty returns whether the slot, which has no record, was pruned as
+// empty.
+func (s *Store) prunedEmpty(txn *badger.Txn, slot phase0.Slot) (bool, error) {
+	if !s.pruneEmpty {
+		return false, nil
+	}
+	bitmap, _, err := readBitmap(txn, uint64(slot/bitmapSlots))
+	if err != nil {
+		return false, err
+	}
+	return bitmap.state(slot) == slotEmpty, nil
+}
+
+// prunedEmptySlots returns the slots within the given range (inclusive)
+// which were pruned as empty, reading only the stored bitmaps.
+func (s *Store) prunedEmptySlots(txn *badger.Txn, from, to phase0.Slot) ([]phase0.Slot, error) {
+	if !s.pruneEmpty {
+		return nil, nil
+	}
+	var slots []phase0.Slot
+	it := txn.NewIterator(badger.IteratorOptions{Prefix: keyBitmap})
+	defer it.Close()
+	for it.Seek(bitmapKey(uint64(from / bitmapSlots))); it.Valid(); it.Next() {
+		bucket := binary.BigEndian.Uint64(it.Item().Key()[len(keyBitmap):])
+		if bucket > uint64(to/bitmapSlots) {
+			break
+		}
+		var bitmap slotBitmap
+		err := it.Item().Value(func(val []byte) error {
+			bitmap = slotBitmap(binary.BigEndian.Uint64(val))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for slot := phase0.Slot(bucket * bitmapSlots); slot < phase0.Slot((bucket+1)*bitmapSlots); slot++ {
+			if slot < from || slot > to || bitmap.state(slot) != slotEmpty {
+				continue
+			}
+			// Empty slots stored before prune_empty still have records.
+			if _, err := txn.Get(slotKey(keySlot, slot)); err == nil {
+				continue
+			} else if err != badger.ErrKeyNotFound {
+				return nil, err
+			}
+			slots = append(slots, slot)
+		}
+	}
+	return slots, nil
+}
+
+// highestPrunedEmpty returns the highest slot pruned as empty which wasn't
+// invalidated since, or ok=false if there's none, reading the stored bitmaps
+// from the top.
+func (s *Store) highestPrunedEmpty(txn *badger.Txn) (slot phase0.Slot, ok bool, err error) {
+	if !s.pruneEmpty {
+		return 0, false, nil
+	}
+	it := txn.NewIterator(badger.IteratorOptions{Prefix: keyBitmap, Reverse: true})
+	defer it.Close()
+	for it.Seek(bitmapKey(math.MaxUint64)); it.Valid(); it.Next() {
+		bucket := binary.BigEndian.Uint64(it.Item().Key()[len(keyBitmap):])
+		var bitmap slotBitmap
+		err := it.Item().Value(func(val []byte) error {
+			bitmap = slotBitmap(binary.BigEndian.Uint64(val))
+			return nil
+		})
+		if err != nil {
+			return 0, false, err
+		}
+		for i := bitmapSlots - 1; i >= 0; i-- {
+			slot := phase0.Slot(bucket*bitmapSlots + uint64(i))
+			if bitmap.state(slot) != slotEmpty {
+				continue
+			}
+			for _, prefix := range [][]byte{keySlot, keyDirty} {
+				if _, err = txn.Get(slotKey(prefix, slot)); err != badger.ErrKeyNotFound {
+					break
+				}
+			}
+			if err == nil {
+				// It has a record from before prune_empty, or is dirty.
+				continue
+			}
+			if err != badger.ErrKeyNotFound {
+				return 0, false, err
+			}
+			return slot, true, nil
+		}
+	}
+	return 0, false, nil
+}
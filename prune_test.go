@@ -0,0 +1,149 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruneEmpty(t *testing.T) {
+	for _, pruneEmpty := range []bool{false, true} {
+		store := newTestStore(t)
+		store.pruneEmpty = pruneEmpty
+
+		// Slots 2 to 6 and 8 are scraped, of which 3 and 6 are empty.
+		require.NoError(t, store.SetBlocks(map[phase0.Slot]*BlockWithRoot{
+			2: testBlock(2),
+			3: nil,
+			4: testBlock(4),
+			5: testBlock(5),
+		}))
+		require.NoError(t, store.SetBlock(6, nil))
+		require.NoError(t, store.SetBlock(8, testBlock(8)))
+
+		// Empty slots only have records without pruning.
+		for _, slot := range []phase0.Slot{3, 6} {
+			_, _, err := store.RawRecord(slot)
+			if pruneEmpty {
+				require.ErrorIs(t, err, badger.ErrKeyNotFound, "slot %d", slot)
+			} else {
+				require.NoError(t, err, "slot %d", slot)
+			}
+		}
+		slots, blocks, err := store.Count()
+		require.NoError(t, err)
+		require.Equal(t, 4, blocks)
+		if pruneEmpty {
+			require.Equal(t, 4, slots)
+		} else {
+			require.Equal(t, 6, slots)
+		}
+
+		// Either way, they're filled, read as empty and found by /gaps, so
+		// that they aren't fetched again.
+		for slot := phase0.Slot(0); slot <= 9; slot++ {
+			filled, err := store.Filled(slot)
+			require.NoError(t, err)
+			require.Equal(t, slot >= 2 && slot != 7 && slot != 9, filled, "slot %d", slot)
+		}
+		for from, expected := range map[phase0.Slot]phase0.Slot{0: 0, 2: 7, 3: 7, 6: 7, 8: 9} {
+			next, err := store.FirstUnfilledSlot(from)
+			require.NoError(t, err)
+			require.Equal(t, expected, next, "from %d", from)
+		}
+		block, err := store.Block(3)
+		require.NoError(t, err)
+		require.Nil(t, block)
+		_, ok, err := store.BlockHeader(3)
+		require.NoError(t, err)
+		require.False(t, ok)
+		blockBytes, _, err := store.BlockSSZ(3)
+		require.NoError(t, err)
+		require.Nil(t, blockBytes)
+		_, err = store.Block(7)
+		require.ErrorIs(t, err, badger.ErrKeyNotFound)
+		empty, unscraped, err := store.MissingSlots(2, 8)
+		require.NoError(t, err)
+		require.Equal(t, []phase0.Slot{3, 6}, empty)
+		require.Equal(t, []phase0.Slot{7}, unscraped)
+		checkpoint, ok, err := store.AdvanceCheckpoint(2)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, phase0.Slot(6), checkpoint)
+
+		// Invalidating covers them, until they're set again.
+		invalidated, err := store.Invalidate(3, 4)
+		require.NoError(t, err)
+		require.Equal(t, []phase0.Slot{3, 4}, invalidated)
+		filled, err := store.Filled(3)
+		require.NoError(t, err)
+		require.False(t, filled)
+		checkpoint, ok, err = store.Checkpoint()
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, phase0.Slot(2), checkpoint)
+		require.NoError(t, store.SetBlock(3, nil))
+		filled, err = store.Filled(3)
+		require.NoError(t, err)
+		require.True(t, filled)
+
+		// And so does purging.
+		deleted, err := store.Purge(0, 6)
+		require.NoError(t, err)
+		require.Equal(t, 5, deleted)
+		empty, unscraped, err = store.MissingSlots(2, 8)
+		require.NoError(t, err)
+		require.Empty(t, empty)
+		require.Equal(t, []phase0.Slot{2, 3, 4, 5, 6, 7}, unscraped)
+		for slot := phase0.Slot(2); slot <= 6; slot++ {
+			filled, err := store.Filled(slot)
+			require.NoError(t, err)
+			require.False(t, filled, "slot %d", slot)
+		}
+	}
+}
+
+func TestPruneEmptyReporting(t *testing.T) {
+	store := newTestStore(t)
+	store.pruneEmpty = true
+
+	// Slot 2 has a block, and slots 3 and 40, in the next bitmap, are empty.
+	require.NoError(t, store.SetBlocks(map[phase0.Slot]*BlockWithRoot{
+		2: testBlock(2),
+		3: nil,
+	}))
+	require.NoError(t, store.SetBlock(40, nil))
+
+	// The highest filled slot, which lag is counted from, is the pruned one.
+	slot, ok, err := store.HighestFilledSlot()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, phase0.Slot(40), slot)
+
+	// The latest block is still the one below them.
+	slot, block, err := store.LatestBlock()
+	require.NoError(t, err)
+	require.Equal(t, phase0.Slot(2), slot)
+	require.Equal(t, phase0.Slot(2), block.Phase0.Message.Slot)
+
+	// The pruned slots are counted as empty ones.
+	slots, blocks, err := store.CachedCount()
+	require.NoError(t, err)
+	require.Equal(t, 3, slots)
+	require.Equal(t, 1, blocks)
+
+	// Once invalidated, a pruned slot is no longer the highest filled one.
+	_, err = store.Invalidate(40, 40)
+	require.NoError(t, err)
+	slot, ok, err = store.HighestFilledSlot()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, phase0.Slot(3), slot)
+
+	// Nor is there a latest block once its slot is reorged to empty.
+	require.NoError(t, store.SetBlock(2, nil))
+	_, _, err = store.LatestBlock()
+	require.ErrorIs(t, err, badger.ErrKeyNotFound)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// How often to forget the buckets of clients which have been idle long enough to refill.
+const rateLimitSweepInterval = time.Minute
+
+// unlimitedPaths are the routes which aren't rate limited, so that monitoring keeps working.
+var unlimitedPaths = map[string]bool{
+	"/metrics": true,
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// tokenBucket holds a client's tokens as of the last time it was refilled.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter limits the rate of requests per client IP, allowing bursts.
+type rateLimiter struct {
+	rate       float64 // Tokens per second.
+	burst      float64
+	trustProxy bool
+	now        func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// newRateLimiter returns a limiter allowing rate requests per second per
+// client, in bursts of up to burst requests. If trustProxy is set, clients
+// are identified by the X-Forwarded-For header rather than their address.
+func newRateLimiter(rate float64, burst int, trustProxy bool) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:       rate,
+		burst:      float64(burst),
+		trustProxy: trustProxy,
+		now:        time.Now,
+		buckets:    make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token from the client's bucket, or otherwise returns how
+// long until one is available.
+func (l *rateLimiter) allow(client string) (ok bool, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	bucket, ok := l.buckets[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = bucket
+	}
+	bucket.tokens = l.refill(bucket, now)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// refill returns the tokens in the bucket as of now.
+func (l *rateLimiter) refill(bucket *tokenBucket, now time.Time) float64 {
+	return math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+}
+
+// sweep forgets the buckets which are full again, since they're the same as new ones.
+func (l *rateLimiter) sweep(now time.Time) {
+	for client, bucket := range l.buckets {
+		if l.refill(bucket, now) >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+	l.lastSweep = now
+}
+
+// clientIP returns the IP address of the request's client.
+func (l *rateLimiter) clientIP(r *http.Request) string {
+	if l.trustProxy {
+		// The last address is the one our proxy saw, whereas clients can
+		// put anything before it.
+		if forwarded := r.Header.Get(echo.HeaderXForwardedFor); forwarded != "" {
+			ips := strings.Split(forwarded, ",")
+			return strings.TrimSpace(ips[len(ips)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// middleware responds with 429 Too Many Requests to clients over the limit.
+func (l *rateLimiter) middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if unlimitedPaths[c.Path()] {
+			return next(c)
+		}
+		ok, retryAfter := l.allow(l.clientIP(c.Request()))
+		if !ok {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+			return echo.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded")
+		}
+		return next(c)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newRateLimiter(2, 3, false)
+	limiter.now = func() time.Time { return now }
+
+	// The burst is allowed at once, then a token refills every half second.
+	for i := 0; i < 3; i++ {
+		ok, _ := limiter.allow("a")
+		require.True(t, ok)
+	}
+	ok, retryAfter := limiter.allow("a")
+	require.False(t, ok)
+	require.Equal(t, 500*time.Millisecond, retryAfter)
+	ok, _ = limiter.allow("b")
+	require.True(t, ok)
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = limiter.allow("a")
+	require.True(t, ok)
+	ok, _ = limiter.allow("a")
+	require.False(t, ok)
+
+	// Idle clients are forgotten once their buckets are full.
+	now = now.Add(rateLimitSweepInterval)
+	ok, _ = limiter.allow("c")
+	require.True(t, ok)
+	require.Len(t, limiter.buckets, 1)
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	limiter := newRateLimiter(1, 1, true)
+	e := echo.New()
+	e.Use(limiter.middleware)
+	e.GET("/metrics", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET("/:network", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	get := func(path, forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	require.Equal(t, http.StatusOK, get("/mainnet", "1.1.1.1, 10.0.0.1").Code)
+	rec := get("/mainnet", "2.2.2.2, 10.0.0.1")
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "1", rec.Header().Get("Retry-After"))
+	require.Equal(t, http.StatusOK, get("/mainnet", "10.0.0.2").Code)
+	require.Equal(t, http.StatusOK, get("/metrics", "10.0.0.1").Code)
+}
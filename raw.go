@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/labstack/echo"
+)
+
+// RawRecord returns a copy of the slot's stored record, as written by
+// SetBlocks, and whether it was invalidated. Returns badger.ErrKeyNotFound
+// if the slot wasn't scraped.
+func (s *Store) RawRecord(slot phase0.Slot) (val []byte, dirty bool, err error) {
+	err = s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(slotKey(keySlot, slot))
+		if err != nil {
+			return err
+		}
+		if val, err = item.ValueCopy(nil); err != nil {
+			return err
+		}
+		_, err = txn.Get(slotKey(keyDirty, slot))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		dirty = err == nil
+		return err
+	})
+	return
+}
+
+// rawRecord describes a stored record, for debugging corrupt ones.
+type rawRecord struct {
+	Slot  phase0.Slot `json:"slot"`
+	Size  int         `json:"size"`
+	Dirty bool        `json:"dirty"`
+
+	// Header is the record's first 8 bytes, which hold the codec and
+	// version of its block, or are all set if the slot is empty.
+	Header  string  `json:"header,omitempty"`
+	Empty   bool    `json:"empty"`
+	Blinded bool    `json:"blinded"`
+	Codec   string  `json:"codec,omitempty"`
+	Fork    string  `json:"fork,omitempty"`
+	Root    string  `json:"root,omitempty"`
+	Body    int     `json:"body_size"`
+	SSZ     *string `json:"ssz,omitempty"`
+	Length  *int    `json:"ssz_size,omitempty"`
+
+	// Error is why the record fails verification, if it does.
+	Error string `json:"error,omitempty"`
+}
+
+// describeRecord describes the slot's record, with its decompressed SSZ if
+// withSSZ is set.
+func describeRecord(slot phase0.Slot, val []byte, dirty, withSSZ bool) *rawRecord {
+	record := &rawRecord{Slot: slot, Size: len(val), Dirty: dirty}
+	if err := verifyRecord(slot, val); err != nil {
+		record.Error = err.Error()
+	}
+	if len(val) < 8 {
+		return record
+	}
+	record.Header = fmt.Sprintf("%#016x", binary.BigEndian.Uint64(val[:8]))
+	version, codec, ok := readHeader(val)
+	if !ok {
+		record.Empty = true
+		return record
+	}
+	record.Blinded = isBlindedRecord(val)
+	record.Codec = codec.String()
+	record.Fork = strings.ToLower(version.String())
+	if len(val) < 40 {
+		return record
+	}
+	record.Root = fmt.Sprintf("%#x", val[8:40])
+	record.Body = len(val) - 40
+	if withSSZ {
+		blockBytes, err := codec.Decode(val[40:])
+		if err != nil {
+			if record.Error == "" {
+				record.Error = err.Error()
+			}
+			return record
+		}
+		ssz, length := fmt.Sprintf("%#x", blockBytes), len(blockBytes)
+		record.SSZ, record.Length = &ssz, &length
+	}
+	return record
+}
+
+// rawHandler serves the slot's stored record with -debug: described as JSON,
+// with its decompressed SSZ if the ssz param is true, or as is to clients
+// which accept application/octet-stream.
+func rawHandler(c echo.Context) error {
+	slot, err := strconv.ParseUint(c.Param("slot"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid slot")
+	}
+	withSSZ, _ := strconv.ParseBool(c.QueryParam("ssz"))
+	store, err := getStore(c.Param("network"))
+	if err != nil {
+		return err
+	}
+	val, dirty, err := store.RawRecord(phase0.Slot(slot))
+	if err == badger.ErrKeyNotFound {
+		return echo.NewHTTPError(http.StatusNotFound, "block not scraped")
+	}
+	if err != nil {
+		return err
+	}
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMEOctetStream) {
+		return c.Blob(http.StatusOK, echo.MIMEOctetStream, val)
+	}
+	return c.JSON(http.StatusOK, describeRecord(phase0.Slot(slot), val, dirty, withSSZ))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRawHandler(t *testing.T) {
+	const network = "raw"
+	store := newTestStore(t)
+	stores.Set(network, store)
+	t.Cleanup(func() { stores.Del(network) })
+
+	block := testBlock(1)
+	require.NoError(t, store.SetBlock(1, block))
+	require.NoError(t, store.SetBlock(2, nil))
+	_, err := store.Invalidate(2, 2)
+	require.NoError(t, err)
+	corrupt := make([]byte, 40)
+	binary.BigEndian.PutUint64(corrupt, uint64(CodecSnappy)<<56|forkNumber(spec.DataVersionAltair))
+	corrupt = append(corrupt, "not snappy"...)
+	err = store.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(slotKey(keySlot, 3), corrupt)
+	})
+	require.NoError(t, err)
+
+	e := echo.New()
+	get := func(slot, query, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/"+network+"/"+slot+"/raw"+query, nil)
+		if accept != "" {
+			req.Header.Set(echo.HeaderAccept, accept)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("network", "slot")
+		c.SetParamValues(network, slot)
+		if err := rawHandler(c); err != nil {
+			e.HTTPErrorHandler(err, c)
+		}
+		return rec
+	}
+	describe := func(slot, query string) *rawRecord {
+		rec := get(slot, query, "")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var record rawRecord
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &record))
+		return &record
+	}
+
+	record := describe("1", "?ssz=true")
+	val, _, err := store.RawRecord(1)
+	require.NoError(t, err)
+	ssz, err := block.Phase0.MarshalSSZ()
+	require.NoError(t, err)
+	require.Equal(t, len(val), record.Size)
+	require.Equal(t, "phase0", record.Fork)
+	require.Equal(t, "snappy", record.Codec)
+	require.Equal(t, len(val)-40, record.Body)
+	require.NotNil(t, record.Length)
+	require.Equal(t, len(ssz), *record.Length)
+	require.Empty(t, record.Error)
+	require.False(t, record.Dirty)
+
+	// Without ssz, only its size is described.
+	record = describe("1", "")
+	require.Nil(t, record.SSZ)
+	require.Equal(t, len(val)-40, record.Body)
+
+	record = describe("2", "")
+	require.True(t, record.Empty)
+	require.True(t, record.Dirty)
+	require.Equal(t, "0x7fffffffffffffff", record.Header)
+
+	// Corrupt records are described as far as they can be.
+	record = describe("3", "?ssz=true")
+	require.Equal(t, "altair", record.Fork)
+	require.Equal(t, 10, record.Body)
+	require.NotEmpty(t, record.Error)
+	require.Nil(t, record.SSZ)
+
+	// The record is served as is to clients which accept octet streams.
+	rec := get("3", "", echo.MIMEOctetStream)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, corrupt, rec.Body.Bytes())
+
+	require.Equal(t, http.StatusNotFound, get("4", "", "").Code)
+	require.Equal(t, http.StatusBadRequest, get("x", "", "").Code)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/http"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/labstack/echo"
+)
+
+// How many slots are re-indexed in each transaction.
+const reindexBatchSlots = 256
+
+// ReindexResult describes a Reindex run, which started (or resumed) from
+// From and reached To.
+type ReindexResult struct {
+	Blocks   int
+	From, To phase0.Slot
+	Duration time.Duration
+}
+
+// Reindex rewrites the secondary indexes of every stored block, such as to
+// backfill indexes added after the blocks were stored. Rewriting is
+// idempotent, and progress is recorded under keyReindex after each batch, so
+// that a run which is interrupted (such as by ctx) is resumed by the next.
+// Runs are serialized.
+func (s *Store) Reindex(ctx context.Context) (result ReindexResult, err error) {
+	s.reindexMu.Lock()
+	defer s.reindexMu.Unlock()
+
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+
+	from, resumed, err := s.reindexCursor()
+	if err != nil {
+		return result, err
+	}
+	if !resumed {
+		var ok bool
+		from, ok, err = s.LowestFilledSlot()
+		if err != nil || !ok {
+			return result, err
+		}
+	}
+	to, ok, err := s.HighestFilledSlot()
+	if err != nil || !ok {
+		return result, err
+	}
+	result.From, result.To = from, from
+
+	log := componentLogger("store", s.network)
+	log.Info().Uint64("from", uint64(from)).Uint64("to", uint64(to)).Bool("resumed", resumed).Msg("re-indexing blocks")
+	for batch := from; batch <= to; batch += reindexBatchSlots {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		last := batch + reindexBatchSlots - 1
+		if last > to {
+			last = to
+		}
+		n, err := s.reindexBatch(batch, last)
+		if err != nil {
+			return result, err
+		}
+		result.Blocks += n
+		result.To = last
+		log.Info().Uint64("slot", uint64(last)).Int("blocks", result.Blocks).Msg("re-indexed blocks")
+	}
+
+	// Done, so the next run starts over.
+	err = s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(keyReindex)
+	})
+	return result, err
+}
+
+// reindexCursor returns the slot an interrupted run should resume from.
+func (s *Store) reindexCursor() (slot phase0.Slot, ok bool, err error) {
+	err = s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(keyReindex)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ok = true
+		return item.Value(func(val []byte) error {
+			slot = phase0.Slot(binary.BigEndian.Uint64(val))
+			return nil
+		})
+	})
+	return
+}
+
+// reindexBatch rewrites the indexes of the blocks within the given range
+// (inclusive), and records the slot after it as the cursor.
+func (s *Store) reindexBatch(from, to phase0.Slot) (int, error) {
+	blocks := make(map[phase0.Slot]*BlockWithRoot)
+	err := s.ForEachBlock(from, to, nil, func(slot phase0.Slot, block *BlockWithRoot) error {
+		blocks[slot] = block
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		err = s.db.Update(func(txn *badger.Txn) error {
+			for slot, block := range blocks {
+				// Skip slots which were overwritten since, and so reindexed.
+				item, err := txn.Get(slotKey(keySlot, slot))
+				if err == badger.ErrKeyNotFound {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				var (
+					same      bool
+					recordLen int
+				)
+				err = item.Value(func(val []byte) error {
+					if checkRecord(val) != nil {
+						return nil
+					}
+					_, _, ok := readHeader(val)
+					same = ok && bytes.Equal(val[8:40], block.BlockRoot[:])
+					recordLen = len(val)
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				if !same {
+					continue
+				}
+
+				prevKeys, err := indexedKeys(txn, slot)
+				if err != nil {
+					return err
+				}
+				expiresAt, err := s.expiresAt(txn, slot)
+				if err != nil {
+					return err
+				}
+				if err := writeIndexes(withExpiry(txn, expiresAt), slot, prevKeys, s.blockIndexKeys(slot, block, recordLen)); err != nil {
+					return err
+				}
+			}
+			var cursor [8]byte
+			binary.BigEndian.PutUint64(cursor[:], uint64(to+1))
+			return txn.Set(keyReindex, cursor[:])
+		})
+		// Retry if a slot was written concurrently.
+		if err != badger.ErrConflict {
+			return len(blocks), err
+		}
+	}
+}
+
+// reindexHandler re-indexes the network's stored blocks, resuming an
+// interrupted run.
+func reindexHandler(c echo.Context) error {
+	store, err := getStore(c.Param("network"))
+	if err != nil {
+		return err
+	}
+	result, err := store.Reindex(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"blocks":           result.Blocks,
+		"from":             result.From,
+		"to":               result.To,
+		"duration_seconds": result.Duration.Seconds(),
+	})
+}
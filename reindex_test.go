@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReindex(t *testing.T) {
+	store := newTestStore(t)
+
+	// Store blocks across a few batches, and drop their indexes, as if they
+	// were stored before the indexes existed.
+	slots := []phase0.Slot{3, 300, 600}
+	for _, slot := range slots {
+		block := testBlock(slot)
+		block.BlockRoot = phase0.Root{byte(slot), byte(slot >> 8)}
+		require.NoError(t, store.SetBlock(slot, block))
+	}
+	require.NoError(t, store.SetBlock(4, nil))
+	dropIndexes := func() {
+		err := store.db.Update(func(txn *badger.Txn) error {
+			for _, slot := range slots {
+				keys, err := indexedKeys(txn, slot)
+				if err != nil {
+					return err
+				}
+				if err := writeIndexes(txn, slot, keys, nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+	}
+	indexed := func(slot phase0.Slot) bool {
+		_, _, err := store.BlockByRoot(phase0.Root{byte(slot), byte(slot >> 8)})
+		if err == badger.ErrKeyNotFound {
+			return false
+		}
+		require.NoError(t, err)
+		return true
+	}
+	dropIndexes()
+	require.False(t, indexed(3))
+
+	result, err := store.Reindex(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 3, result.Blocks)
+	require.Equal(t, phase0.Slot(3), result.From)
+	require.Equal(t, phase0.Slot(600), result.To)
+	for _, slot := range slots {
+		require.True(t, indexed(slot))
+	}
+	proposed, err := store.ProposerSlots(0, 0, 1000)
+	require.NoError(t, err)
+	require.Equal(t, slots, proposed)
+
+	// Running again is harmless.
+	result, err = store.Reindex(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 3, result.Blocks)
+	require.True(t, indexed(300))
+
+	// An interrupted run is resumed from its cursor.
+	dropIndexes()
+	err = store.db.Update(func(txn *badger.Txn) error {
+		var cursor [8]byte
+		binary.BigEndian.PutUint64(cursor[:], 259)
+		return txn.Set(keyReindex, cursor[:])
+	})
+	require.NoError(t, err)
+	result, err = store.Reindex(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Blocks)
+	require.Equal(t, phase0.Slot(259), result.From)
+	require.False(t, indexed(3))
+	require.True(t, indexed(300))
+	require.True(t, indexed(600))
+
+	// A cancelled run stops before its first batch.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = store.Reindex(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+)
+
+// networkRunner is a running network, which can be stopped on its own.
+type networkRunner struct {
+	config NetworkConfig
+	cancel func()
+	done   chan struct{}
+}
+
+// networkRunners runs the configured networks. It's only used by main's goroutine.
+type networkRunners map[string]*networkRunner
+
+// start runs the given network until ctx is done or it's stopped.
+func (r networkRunners) start(ctx context.Context, network NetworkConfig) {
+	ctx, cancel := context.WithCancel(ctx)
+	runner := &networkRunner{
+		config: network,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	r[network.Name] = runner
+	networks.Set(network.Name, network)
+	go func() {
+		defer close(runner.done)
+		runNetwork(ctx, network)
+	}()
+}
+
+// stop stops the given network and waits for its store to close.
+func (r networkRunners) stop(name string) {
+	runner, ok := r[name]
+	if !ok {
+		return
+	}
+	runner.cancel()
+	<-runner.done
+	delete(r, name)
+	networks.Del(name)
+}
+
+// stopAll stops every network.
+func (r networkRunners) stopAll() {
+	for name := range r {
+		r.stop(name)
+	}
+}
+
+// apply starts the networks added to the config, restarts those whose
+// config changed and stops those removed from it, leaving the rest running.
+func (r networkRunners) apply(ctx context.Context, config *Config) {
+	configured := make(map[string]bool, len(config.Networks))
+	for _, network := range config.Networks {
+		configured[network.Name] = true
+		runner, ok := r[network.Name]
+		switch {
+		case !ok:
+			componentLogger("config", network.Name).Info().Msg("starting")
+		case runner.config != network:
+			componentLogger("config", network.Name).Info().Msg("restarting with changed config")
+			r.stop(network.Name)
+		default:
+			continue
+		}
+		r.start(ctx, network)
+	}
+	for name := range r {
+		if !configured[name] {
+			componentLogger("config", name).Info().Msg("stopping, since it was removed from the config")
+			r.stop(name)
+		}
+	}
+}
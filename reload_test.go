@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkRunners(t *testing.T) {
+	prevDataDir := *dataDir
+	*dataDir = t.TempDir()
+	t.Cleanup(func() { *dataDir = prevDataDir })
+
+	// The nodes are unreachable, so the networks just keep retrying to scrape.
+	a := NetworkConfig{Name: "a", NodeURL: "http://127.0.0.1:1"}
+	b := NetworkConfig{Name: "b", NodeURL: "http://127.0.0.1:1"}
+	opened := func(name string) func() bool {
+		return func() bool {
+			_, ok := stores.Get(name)
+			return ok
+		}
+	}
+
+	runners := networkRunners{}
+	runners.apply(context.Background(), &Config{Networks: []NetworkConfig{a, b}})
+	require.Eventually(t, opened("a"), 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, opened("b"), 5*time.Second, 10*time.Millisecond)
+	storeA, _ := stores.Get("a")
+
+	// Removing b closes its store, and a keeps running untouched.
+	runners.apply(context.Background(), &Config{Networks: []NetworkConfig{a}})
+	require.False(t, opened("b")())
+	_, ok := networks.Get("b")
+	require.False(t, ok)
+	store, ok := stores.Get("a")
+	require.True(t, ok)
+	require.Same(t, storeA, store)
+
+	// Changing a's config restarts it.
+	a.HeadEvents = true
+	runners.apply(context.Background(), &Config{Networks: []NetworkConfig{a}})
+	require.Eventually(t, opened("a"), 5*time.Second, 10*time.Millisecond)
+	network, _ := networks.Get("a")
+	require.True(t, network.HeadEvents)
+
+	runners.stopAll()
+	require.False(t, opened("a")())
+	require.Empty(t, runners)
+}
+
+func TestNoScrape(t *testing.T) {
+	prevDataDir := *dataDir
+	*dataDir = t.TempDir()
+	*noScrape = true
+	t.Cleanup(func() {
+		*dataDir = prevDataDir
+		*noScrape = false
+	})
+
+	// The node URL may be left out.
+	network := NetworkConfig{Name: "archive", RetentionSlots: 10, ScrapeConcurrency: 1}
+	require.NoError(t, (&Config{Networks: []NetworkConfig{network}}).Validate())
+
+	// The database was populated before, and is well behind the clock.
+	store, err := OpenStore(*dataDir, network.Name)
+	require.NoError(t, err)
+	require.NoError(t, store.SetSpec(&NetworkSpec{
+		GenesisTime:    time.Now().Add(-100 * 12 * time.Second),
+		SecondsPerSlot: 12,
+		SlotsPerEpoch:  32,
+	}))
+	require.NoError(t, store.SetBlock(50, testBlock(50)))
+	require.NoError(t, store.Close())
+
+	runners := networkRunners{}
+	runners.apply(context.Background(), &Config{Networks: []NetworkConfig{network}})
+	t.Cleanup(runners.stopAll)
+	require.Eventually(t, func() bool {
+		_, ok := stores.Get(network.Name)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Its blocks are served, without connecting to a node.
+	store, _ = stores.Get(network.Name)
+	block, err := fetchSlot(context.Background(), store, network.Name, 50)
+	require.NoError(t, err)
+	require.NotNil(t, block)
+	_, ok := nodes.Get(network.Name)
+	require.False(t, ok)
+	_, err = fetchSlot(context.Background(), store, network.Name, 60)
+	require.Equal(t, http.StatusServiceUnavailable, err.(*echo.HTTPError).Code)
+
+	// And it's ready, despite the clock.
+	r := readiness(network, 16)
+	require.True(t, r.Ready)
+	require.Zero(t, *r.LagSlots)
+}
+
+func TestCloseStopsNetwork(t *testing.T) {
+	prevDataDir := *dataDir
+	*dataDir = t.TempDir()
+	t.Cleanup(func() { *dataDir = prevDataDir })
+
+	// Closing a network's store stops it, like stopping its runner does.
+	network := NetworkConfig{Name: "closed", NodeURL: "http://127.0.0.1:1"}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runNetwork(context.Background(), network)
+	}()
+	require.Eventually(t, func() bool {
+		_, ok := stores.Get(network.Name)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+	store, _ := stores.Get(network.Name)
+	require.NoError(t, store.Close())
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("network didn't stop")
+	}
+	_, ok := stores.Get(network.Name)
+	require.False(t, ok)
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+)
+
+// A replica (run with -replicate-from) serves a copy of a primary's stores,
+// without scraping. Every replicateInterval, it pulls the records of the
+// slots since its finalized slot from the primary's GET /:network/since/:slot,
+// asking for application/octet-stream (see ExportSince), and replaces its own records of those slots with them
+// (see Import). Slots before the finalized slot no longer change, except when
+// pinned or repaired on the primary, which a replica doesn't pick up.
+//
+// An export starts with the slot it's since, followed by records of a key,
+// a value and when it expires (0 for never), and ends with a record of an
+// empty key, so that an export which was cut short is rejected.
+
+// How often replicas pull from the primary.
+const replicateInterval = 12 * time.Second
+
+// replicatedPrefixes are the prefixes of the records exported for each slot,
+// along with the secondary index keys recorded under keyIndexes.
+var replicatedPrefixes = [][]byte{keySlot, keyDirty, keyIndexes, keyPin, keyOrphaned, keyAnnotation}
+
+// ExportSince writes the records of the slots from the given one onwards,
+// along with the network's spec, head, scrape checkpoint and finalized
+// checkpoint, from a consistent snapshot of the store.
+func (s *Store) ExportSince(w io.Writer, from phase0.Slot) error {
+	bw := bufio.NewWriter(w)
+	var header [8]byte
+	binary.BigEndian.PutUint64(header[:], uint64(from))
+	if _, err := bw.Write(header[:]); err != nil {
+		return err
+	}
+	err := s.db.View(func(txn *badger.Txn) error {
+		for _, prefix := range replicatedPrefixes {
+			if err := exportPrefix(bw, txn, prefix, from); err != nil {
+				return err
+			}
+		}
+		// These come last, so that the finalized checkpoint isn't imported
+		// unless the slots before it were.
+		for _, key := range [][]byte{keySpec, keyHead, keyCheckpoint, keyFinalized} {
+			item, err := txn.Get(key)
+			if err == badger.ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := exportItem(bw, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeRecord(bw, nil, nil, 0); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// exportPrefix writes the records under the prefix from the given slot onwards.
+func exportPrefix(w *bufio.Writer, txn *badger.Txn, prefix []byte, from phase0.Slot) error {
+	it := txn.NewIterator(badger.IteratorOptions{Prefix: prefix})
+	defer it.Close()
+	for it.Seek(slotKey(prefix, from)); it.Valid(); it.Next() {
+		if err := exportItem(w, it.Item()); err != nil {
+			return err
+		}
+		if !bytes.Equal(prefix, keyIndexes) {
+			continue
+		}
+		slot := phase0.Slot(binary.BigEndian.Uint64(it.Item().Key()[len(keyIndexes):]))
+		keys, err := indexedKeys(txn, slot)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			item, err := txn.Get(key)
+			if err == badger.ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := exportItem(w, item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func exportItem(w *bufio.Writer, item *badger.Item) error {
+	return item.Value(func(val []byte) error {
+		return writeRecord(w, item.Key(), val, item.ExpiresAt())
+	})
+}
+
+func writeRecord(w *bufio.Writer, key, val []byte, expiresAt uint64) error {
+	var buf [binary.MaxVarintLen64]byte
+	for _, b := range [][]byte{key, val} {
+		if _, err := w.Write(buf[:binary.PutUvarint(buf[:], uint64(len(b)))]); err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(buf[:binary.PutUvarint(buf[:], expiresAt)])
+	return err
+}
+
+// readRecord reads a record written by writeRecord. key is empty at the end
+// of the export.
+func readRecord(r *bufio.Reader) (key, val []byte, expiresAt uint64, err error) {
+	for _, b := range []*[]byte{&key, &val} {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if n > uint64(maxRecordSize) {
+			return nil, nil, 0, fmt.Errorf("record of %d bytes is too large", n)
+		}
+		*b = make([]byte, n)
+		if _, err := io.ReadFull(r, *b); err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	expiresAt, err = binary.ReadUvarint(r)
+	return key, val, expiresAt, err
+}
+
+// The largest key or value accepted by Import, well above any block.
+const maxRecordSize = 64 << 20
+
+// Import replaces the records of the slots from the one an export written by
+// ExportSince is since onwards with those of the export. The records are
+// written in batches, so until an import succeeds, some of those slots may
+// be missing. Returns the number of slots imported.
+func (s *Store) Import(r io.Reader) (slots int, err error) {
+	br := bufio.NewReader(r)
+	var header [8]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return 0, errors.Wrap(err, "failed to read export header")
+	}
+	from := phase0.Slot(binary.BigEndian.Uint64(header[:]))
+
+	s.bitmapMu.Lock()
+	defer s.bitmapMu.Unlock()
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+	evicted, err := s.clearSince(wb, from)
+	if err != nil {
+		return 0, err
+	}
+	// The scrape checkpoint is the primary's, if it has one.
+	if err := wb.Delete(keyCheckpoint); err != nil {
+		return 0, err
+	}
+
+	var head *phase0.Slot
+	var finalized *phase0.Checkpoint
+	for {
+		key, val, expiresAt, err := readRecord(br)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to read export")
+		}
+		if len(key) == 0 {
+			break
+		}
+		entry := badger.NewEntry(key, val)
+		entry.ExpiresAt = expiresAt
+		if err := wb.SetEntry(entry); err != nil {
+			return 0, err
+		}
+		switch {
+		case bytes.HasPrefix(key, keySlot) && len(key) == len(keySlot)+8:
+			evicted = append(evicted, phase0.Slot(binary.BigEndian.Uint64(key[len(keySlot):])))
+			slots++
+		case bytes.Equal(key, keyHead) && len(val) == 8:
+			slot := phase0.Slot(binary.BigEndian.Uint64(val))
+			head = &slot
+		case bytes.Equal(key, keyFinalized) && len(val) == 40:
+			finalized = &phase0.Checkpoint{Epoch: phase0.Epoch(binary.BigEndian.Uint64(val[:8]))}
+			copy(finalized.Root[:], val[8:40])
+		}
+	}
+	if err := wb.Flush(); err != nil {
+		return 0, err
+	}
+	for _, slot := range evicted {
+		s.evict(slot)
+	}
+	if head != nil {
+		s.head.Store(*head)
+	}
+	if finalized != nil {
+		s.finalized.Store(finalized)
+	}
+	return slots, nil
+}
+
+// clearSince deletes the records of the slots from the given one onwards,
+// and the bitmaps covering them, which are rebuilt when next read. Returns
+// the slots which were stored.
+func (s *Store) clearSince(wb *badger.WriteBatch, from phase0.Slot) (slots []phase0.Slot, err error) {
+	err = s.db.View(func(txn *badger.Txn) error {
+		for _, prefix := range append(append([][]byte{}, replicatedPrefixes...), keyBitmap) {
+			start := slotKey(prefix, from)
+			if bytes.Equal(prefix, keyBitmap) {
+				start = bitmapKey(uint64(from / bitmapSlots))
+			}
+			err := func() error {
+				it := txn.NewIterator(badger.IteratorOptions{Prefix: prefix})
+				defer it.Close()
+				for it.Seek(start); it.Valid(); it.Next() {
+					key := it.Item().KeyCopy(nil)
+					switch {
+					case bytes.Equal(prefix, keySlot):
+						slots = append(slots, phase0.Slot(binary.BigEndian.Uint64(key[len(keySlot):])))
+					case bytes.Equal(prefix, keyIndexes):
+						slot := phase0.Slot(binary.BigEndian.Uint64(key[len(keyIndexes):]))
+						indexKeys, err := indexedKeys(txn, slot)
+						if err != nil {
+							return err
+						}
+						for _, indexKey := range indexKeys {
+							if err := wb.Delete(indexKey); err != nil {
+								return err
+							}
+						}
+					}
+					if err := wb.Delete(key); err != nil {
+						return err
+					}
+				}
+				return nil
+			}()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// exportHandler streams an export of the network's slots since the given
+// one, for replicas to import. It's served by GET /:network/since/:slot to
+// admins which accept application/octet-stream.
+func exportHandler(c echo.Context) error {
+	network := c.Param("network")
+	store, err := getStore(network)
+	if err != nil {
+		return err
+	}
+	slot, err := strconv.ParseUint(c.Param("slot"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid slot")
+	}
+	if store.pruneEmpty {
+		return echo.NewHTTPError(http.StatusConflict, "network prunes empty slots, which can't be replicated")
+	}
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMEOctetStream)
+	c.Response().WriteHeader(http.StatusOK)
+	if err := store.ExportSince(c.Response().Writer, phase0.Slot(slot)); err != nil {
+		// Too late to report an error status, so just cut the response short.
+		componentLogger("api", network).Error().Err(err).Msg("export failed")
+	}
+	return nil
+}
+
+// replicate keeps the network's store in sync with the primary's until the
+// context is done.
+func replicate(ctx context.Context, store *Store, network NetworkConfig) {
+	log := componentLogger("replica", network.Name)
+	ticker := time.NewTicker(replicateInterval)
+	defer ticker.Stop()
+	for {
+		start := time.Now()
+		slots, err := pullFromPrimary(ctx, store, network)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Error().Err(err).Msg("failed to pull from primary")
+		} else {
+			log.Debug().Int("slots", slots).Dur("duration", time.Since(start)).Msg("pulled from primary")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pullFromPrimary imports the slots since the store's finalized slot (or all
+// of them, at first) from the primary.
+func pullFromPrimary(ctx context.Context, store *Store, network NetworkConfig) (slots int, err error) {
+	from, _, err := store.FinalizedSlot()
+	if err != nil {
+		return 0, err
+	}
+	u := fmt.Sprintf("%s/%s/since/%d", strings.TrimSuffix(*replicateFrom, "/"), url.PathEscape(network.Name), from)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set(echo.HeaderAccept, echo.MIMEOctetStream)
+	if *adminToken != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+*adminToken)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("primary responded with %s", resp.Status)
+	}
+	slots, err = store.Import(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	// Bitmaps rebuilt on the replica must expire along with the slots.
+	if network.ExpireByTTL && store.slotExpiry() == nil {
+		networkSpec, err := store.Spec()
+		if err != nil {
+			return 0, err
+		}
+		if networkSpec != nil {
+			store.SetExpiry(&slotExpiry{
+				genesisTime:    networkSpec.GenesisTime,
+				slotDuration:   network.SlotDuration(networkSpec),
+				retentionSlots: phase0.Slot(network.RetentionSlots),
+			})
+		}
+	}
+	return slots, nil
+}
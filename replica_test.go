@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplica(t *testing.T) {
+	const network = "replicated"
+	block := func(slot phase0.Slot, root byte) *BlockWithRoot {
+		block := testBlock(slot)
+		block.BlockRoot = phase0.Root{root}
+		return block
+	}
+
+	primary := newTestStore(t)
+	require.NoError(t, primary.SetSpec(&NetworkSpec{
+		GenesisTime:    time.Now().Add(-100 * 12 * time.Second),
+		SecondsPerSlot: 12,
+		SlotsPerEpoch:  2,
+	}))
+	require.NoError(t, primary.SetBlocks(map[phase0.Slot]*BlockWithRoot{
+		1: block(1, 1),
+		3: block(3, 3),
+		4: block(4, 4),
+		5: block(5, 5),
+		6: nil,
+	}))
+	require.NoError(t, primary.Pin(5))
+	require.NoError(t, primary.SetHeadSlot(6))
+	require.NoError(t, primary.SetFinalized(&phase0.Checkpoint{Epoch: 2}))
+	_, _, err := primary.AdvanceCheckpoint(1)
+	require.NoError(t, err)
+
+	// The replica has a block at 4 which was since replaced, and one at 9
+	// which was since purged.
+	replica := newTestStore(t)
+	require.NoError(t, replica.SetBlocks(map[phase0.Slot]*BlockWithRoot{
+		2: block(2, 2),
+		4: block(4, 40),
+		9: block(9, 9),
+	}))
+	_, err = replica.SlotStates(0, 9)
+	require.NoError(t, err)
+
+	var export bytes.Buffer
+	require.NoError(t, primary.ExportSince(&export, 3))
+
+	// An export which was cut short is rejected.
+	_, err = replica.Import(bytes.NewReader(export.Bytes()[:export.Len()-1]))
+	require.Error(t, err)
+
+	slots, err := replica.Import(bytes.NewReader(export.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, 4, slots)
+
+	// Slots before 3 are left alone, and the rest are the primary's.
+	empty, unscraped, err := replica.MissingSlots(0, 9)
+	require.NoError(t, err)
+	require.Equal(t, []phase0.Slot{6}, empty)
+	require.Equal(t, []phase0.Slot{0, 1, 7, 8, 9}, unscraped)
+	header, ok, err := replica.BlockHeader(4)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, phase0.Root{4}, header.Root)
+	_, _, err = replica.BlockByRoot(phase0.Root{40})
+	require.ErrorIs(t, err, badger.ErrKeyNotFound)
+	slot, _, err := replica.BlockByRoot(phase0.Root{5})
+	require.NoError(t, err)
+	require.Equal(t, phase0.Slot(5), slot)
+	pins, err := replica.Pins()
+	require.NoError(t, err)
+	require.Equal(t, []phase0.Slot{5}, pins)
+	head, _, err := replica.HeadSlot()
+	require.NoError(t, err)
+	require.Equal(t, phase0.Slot(6), head)
+	checkpoint, ok, err := replica.Checkpoint()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, phase0.Slot(1), checkpoint)
+	finalized, ok, err := replica.FinalizedSlot()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, phase0.Slot(4), finalized)
+
+	// Pulling from the primary brings in the slots before its finalized
+	// slot once, at first.
+	stores.Set(network, primary)
+	t.Cleanup(func() { stores.Del(network) })
+	e := echo.New()
+	e.GET("/:network/since/:slot", exportHandler)
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+	prevReplicateFrom := *replicateFrom
+	*replicateFrom = server.URL
+	t.Cleanup(func() { *replicateFrom = prevReplicateFrom })
+
+	fresh := newTestStore(t)
+	slots, err = pullFromPrimary(context.Background(), fresh, NetworkConfig{Name: network})
+	require.NoError(t, err)
+	require.Equal(t, 5, slots)
+	slots, err = pullFromPrimary(context.Background(), fresh, NetworkConfig{Name: network})
+	require.NoError(t, err)
+	require.Equal(t, 3, slots)
+	filled, err := fresh.Filled(1)
+	require.NoError(t, err)
+	require.True(t, filled)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/labstack/echo"
+)
+
+// How many slots GET /:network/since/:slot returns by default.
+const defaultSinceLimit = 32
+
+// sinceResponse is a page of the slots filled after a cursor. Next is the
+// cursor of the following page, which is the last slot of this one, or the
+// given cursor if nothing was filled after it yet.
+type sinceResponse struct {
+	Slots []interface{} `json:"slots"`
+	Next  phase0.Slot   `json:"next"`
+}
+
+// sinceHandler returns up to limit (at most maxRangeSlots) slots filled after
+// the given one, in order, for consumers to follow the store incrementally.
+// Unscraped and invalidated slots are skipped, so slots which are filled
+// behind the cursor later (such as by backfilling or after a reorg) are only
+// seen by consumers which start over from before them.
+func sinceHandler(c echo.Context) error {
+	after, err := strconv.ParseUint(c.Param("slot"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid slot")
+	}
+	limit := defaultSinceLimit
+	if param := c.QueryParam("limit"); param != "" {
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit < 1 || limit > maxRangeSlots {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxRangeSlots))
+		}
+	}
+	opts, err := parseBlockOptions(c)
+	if err != nil {
+		return err
+	}
+	store, err := getStore(c.Param("network"))
+	if err != nil {
+		return err
+	}
+
+	resp := sinceResponse{Slots: []interface{}{}, Next: phase0.Slot(after)}
+	err = store.IterateFilledAfter(phase0.Slot(after), limit, func(slot phase0.Slot, block *BlockWithRoot) error {
+		slotResp, err := newSlotResponse(slot, block, opts)
+		if err != nil {
+			return err
+		}
+		resp.Slots = append(resp.Slots, slotResp)
+		resp.Next = slot
+		return nil
+	})
+	if err != nil {
+		componentLogger("api", store.network).Error().Err(err).Msg("failed to get slots")
+		return err
+	}
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSinceHandler(t *testing.T) {
+	const network = "since"
+	store := newTestStore(t)
+	stores.Set(network, store)
+	t.Cleanup(func() { stores.Del(network) })
+
+	require.NoError(t, store.SetBlocks(map[phase0.Slot]*BlockWithRoot{
+		2: testBlock(2),
+		3: nil,
+		5: testBlock(5),
+		6: testBlock(6),
+		8: testBlock(8),
+	}))
+	_, err := store.Invalidate(6, 6)
+	require.NoError(t, err)
+
+	e := echo.New()
+	get := func(slot, query string) (int, *sinceResponse) {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/?"+query, nil), rec)
+		c.SetParamNames("network", "slot")
+		c.SetParamValues(network, slot)
+		if err := sinceHandler(c); err != nil {
+			e.HTTPErrorHandler(err, c)
+		}
+		if rec.Code != http.StatusOK {
+			return rec.Code, nil
+		}
+		var resp sinceResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return rec.Code, &resp
+	}
+	slots := func(resp *sinceResponse) (slots []float64, statuses []string) {
+		for _, s := range resp.Slots {
+			slot := s.(map[string]interface{})
+			slots = append(slots, slot["slot"].(float64))
+			statuses = append(statuses, slot["status"].(string))
+		}
+		return
+	}
+
+	_, resp := get("0", "limit=2")
+	s, statuses := slots(resp)
+	require.Equal(t, []float64{2, 3}, s)
+	require.Equal(t, []string{"block", "empty"}, statuses)
+	require.Equal(t, phase0.Slot(3), resp.Next)
+
+	// Invalidated slots are skipped.
+	_, resp = get("3", "")
+	s, _ = slots(resp)
+	require.Equal(t, []float64{5, 8}, s)
+	require.Equal(t, phase0.Slot(8), resp.Next)
+
+	// Nothing after the last slot yet, so the cursor stays.
+	_, resp = get("8", "")
+	require.Empty(t, resp.Slots)
+	require.Equal(t, phase0.Slot(8), resp.Next)
+	_, resp = get("18446744073709551615", "")
+	require.Empty(t, resp.Slots)
+
+	for _, query := range []string{"limit=0", "limit=129", "limit=many"} {
+		code, _ := get("0", query)
+		require.Equal(t, http.StatusBadRequest, code, query)
+	}
+	code, _ := get("-1", "")
+	require.Equal(t, http.StatusBadRequest, code)
+}
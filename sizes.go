@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/binary"
+	"net/http"
+	"sort"
+
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/labstack/echo"
+)
+
+// With record_sizes, the SSZ and compressed sizes of each stored block are
+// recorded in a size key under keySizes, which is recorded with the block's
+// secondary index keys, so that it's replaced, purged, expired and replicated
+// along with them. The sizes are in the key, so that a range of them is read
+// with a key-only iterator, without reading or decompressing any block.
+
+// SlotSize is the size of the block at a slot.
+type SlotSize struct {
+	Slot       phase0.Slot `json:"slot"`
+	SSZ        uint32      `json:"ssz"`
+	Compressed uint32      `json:"compressed"`
+}
+
+// sizeKey returns the size key of the block at the given slot.
+func sizeKey(size SlotSize) []byte {
+	key := make([]byte, len(keySizes)+16)
+	copy(key, keySizes)
+	binary.BigEndian.PutUint64(key[len(keySizes):], uint64(size.Slot))
+	binary.BigEndian.PutUint32(key[len(keySizes)+8:], size.SSZ)
+	binary.BigEndian.PutUint32(key[len(keySizes)+12:], size.Compressed)
+	return key
+}
+
+// blockIndexKeys returns the secondary index keys of the block at the given
+// slot, along with its size key if the store records sizes, of its record of
+// the given length.
+func (s *Store) blockIndexKeys(slot phase0.Slot, block *BlockWithRoot, recordLen int) [][]byte {
+	keys := indexKeys(slot, block)
+	if !s.recordSizes || block == nil {
+		return keys
+	}
+	size, err := sizeSSZ(block.VersionedSignedBeaconBlock)
+	if err != nil {
+		return keys
+	}
+	return append(keys, sizeKey(SlotSize{
+		Slot:       slot,
+		SSZ:        uint32(size),
+		Compressed: uint32(recordLen - 40),
+	}))
+}
+
+// sizeSSZ returns the length of a signed block's SSZ encoding, without
+// encoding it.
+func sizeSSZ(block *spec.VersionedSignedBeaconBlock) (int, error) {
+	switch block.Version {
+	case spec.DataVersionPhase0:
+		return block.Phase0.SizeSSZ(), nil
+	case spec.DataVersionAltair:
+		return block.Altair.SizeSSZ(), nil
+	case spec.DataVersionBellatrix:
+		return block.Bellatrix.SizeSSZ(), nil
+	case spec.DataVersionCapella:
+		return block.Capella.SizeSSZ(), nil
+	case spec.DataVersionDeneb:
+		return block.Deneb.SizeSSZ(), nil
+	case spec.DataVersionElectra:
+		return block.Electra.SizeSSZ(), nil
+	}
+	return 0, unsupportedForkError(block.Version)
+}
+
+// Sizes returns the recorded sizes of the blocks within the given range of
+// slots (inclusive), in slot order. Empty slots, and blocks stored without
+// record_sizes, have none.
+func (s *Store) Sizes(from, to phase0.Slot) ([]SlotSize, error) {
+	var sizes []SlotSize
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = keySizes
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(slotKey(keySizes, from)); it.Valid(); it.Next() {
+			key := it.Item().Key()[len(keySizes):]
+			if len(key) != 16 {
+				continue
+			}
+			size := SlotSize{
+				Slot:       phase0.Slot(binary.BigEndian.Uint64(key)),
+				SSZ:        binary.BigEndian.Uint32(key[8:]),
+				Compressed: binary.BigEndian.Uint32(key[12:]),
+			}
+			if size.Slot > to {
+				break
+			}
+			sizes = append(sizes, size)
+		}
+		return nil
+	})
+	return sizes, err
+}
+
+// sizeStats summarizes a distribution of block sizes, in bytes.
+type sizeStats struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	Avg float64 `json:"avg"`
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+// newSizeStats summarizes the given sizes, which it sorts.
+func newSizeStats(sizes []float64) *sizeStats {
+	if len(sizes) == 0 {
+		return nil
+	}
+	sort.Float64s(sizes)
+	var sum float64
+	for _, size := range sizes {
+		sum += size
+	}
+	// Nearest-rank percentiles.
+	percentile := func(p int) float64 {
+		return sizes[(len(sizes)*p+99)/100-1]
+	}
+	return &sizeStats{
+		Min: sizes[0],
+		Max: sizes[len(sizes)-1],
+		Avg: sum / float64(len(sizes)),
+		P50: percentile(50),
+		P90: percentile(90),
+		P99: percentile(99),
+	}
+}
+
+// sizesHandler summarizes the recorded sizes of the blocks within a range of
+// slots: their SSZ and compressed sizes, and the ratio between them.
+func sizesHandler(c echo.Context) error {
+	from, to, err := parseSlotRange(c, defaultScrapeSlots)
+	if err != nil {
+		return err
+	}
+	store, err := getStore(c.Param("network"))
+	if err != nil {
+		return err
+	}
+	sizes, err := store.Sizes(from, to)
+	if err != nil {
+		return err
+	}
+	ssz := make([]float64, len(sizes))
+	compressed := make([]float64, len(sizes))
+	ratio := make([]float64, len(sizes))
+	for i, size := range sizes {
+		ssz[i] = float64(size.SSZ)
+		compressed[i] = float64(size.Compressed)
+		if size.Compressed != 0 {
+			ratio[i] = float64(size.SSZ) / float64(size.Compressed)
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"blocks":     len(sizes),
+		"ssz":        newSizeStats(ssz),
+		"compressed": newSizeStats(compressed),
+		"ratio":      newSizeStats(ratio),
+	})
+}
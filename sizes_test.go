@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSizes(t *testing.T) {
+	store := newTestStore(t)
+	require.NoError(t, store.SetBlock(1, testBlock(1)))
+
+	// Sizes aren't recorded unless asked for.
+	sizes, err := store.Sizes(0, 10)
+	require.NoError(t, err)
+	require.Empty(t, sizes)
+
+	store.recordSizes = true
+	require.NoError(t, store.SetBlocks(map[phase0.Slot]*BlockWithRoot{
+		2: testBlock(2),
+		3: nil,
+		4: testBellatrixBlock(4, phase0.Hash32{4}),
+	}))
+	sizes, err = store.Sizes(0, 10)
+	require.NoError(t, err)
+	require.Len(t, sizes, 2)
+	for i, slot := range []phase0.Slot{2, 4} {
+		require.Equal(t, slot, sizes[i].Slot)
+		block, err := store.Block(slot)
+		require.NoError(t, err)
+		ssz, err := marshalBlock(block.VersionedSignedBeaconBlock)
+		require.NoError(t, err)
+		require.Equal(t, uint32(len(ssz)), sizes[i].SSZ)
+		record, _, err := store.RawRecord(slot)
+		require.NoError(t, err)
+		require.Equal(t, uint32(len(record)-40), sizes[i].Compressed)
+	}
+
+	// A slot's size goes with its block.
+	require.NoError(t, store.SetBlock(2, nil))
+	sizes, err = store.Sizes(0, 10)
+	require.NoError(t, err)
+	require.Len(t, sizes, 1)
+	require.Equal(t, phase0.Slot(4), sizes[0].Slot)
+	sizes, err = store.Sizes(0, 3)
+	require.NoError(t, err)
+	require.Empty(t, sizes)
+
+	// Re-indexing records the sizes of blocks stored before.
+	_, err = store.Reindex(context.Background())
+	require.NoError(t, err)
+	sizes, err = store.Sizes(0, 10)
+	require.NoError(t, err)
+	require.Len(t, sizes, 2)
+	require.Equal(t, phase0.Slot(1), sizes[0].Slot)
+
+	// And purging removes them.
+	_, err = store.Purge(0, 3)
+	require.NoError(t, err)
+	sizes, err = store.Sizes(0, 10)
+	require.NoError(t, err)
+	require.Len(t, sizes, 1)
+	require.Equal(t, phase0.Slot(4), sizes[0].Slot)
+}
+
+func TestSizeStats(t *testing.T) {
+	require.Nil(t, newSizeStats(nil))
+	sizes := make([]float64, 100)
+	for i := range sizes {
+		sizes[i] = float64(100 - i)
+	}
+	require.Equal(t, &sizeStats{Min: 1, Max: 100, Avg: 50.5, P50: 50, P90: 90, P99: 99}, newSizeStats(sizes))
+	require.Equal(t, &sizeStats{Min: 7, Max: 7, Avg: 7, P50: 7, P90: 7, P99: 7}, newSizeStats([]float64{7}))
+}
+
+func TestSizesHandler(t *testing.T) {
+	const network = "sizes"
+	store := newTestStore(t)
+	store.recordSizes = true
+	stores.Set(network, store)
+	t.Cleanup(func() { stores.Del(network) })
+	require.NoError(t, store.SetBlocks(map[phase0.Slot]*BlockWithRoot{
+		1: testBlock(1),
+		2: testBlock(2),
+	}))
+
+	e := echo.New()
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/"+network+"/sizes?"+query, nil), rec)
+		c.SetParamNames("network")
+		c.SetParamValues(network)
+		if err := sizesHandler(c); err != nil {
+			e.HTTPErrorHandler(err, c)
+		}
+		return rec
+	}
+	require.Equal(t, http.StatusBadRequest, get("from=2&to=1").Code)
+
+	rec := get("from=0&to=10")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Blocks     int        `json:"blocks"`
+		SSZ        *sizeStats `json:"ssz"`
+		Compressed *sizeStats `json:"compressed"`
+		Ratio      *sizeStats `json:"ratio"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, 2, body.Blocks)
+	require.NotZero(t, body.SSZ.Min)
+	require.NotZero(t, body.Compressed.Min)
+	require.NotZero(t, body.Ratio.Min)
+
+	rec = get("from=5&to=10")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"blocks":0,"ssz":null,"compressed":null,"ratio":null}`, rec.Body.String())
+}
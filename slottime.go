@@ -0,0 +1,96 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/labstack/echo"
+)
+
+// slotTime is the mapping between a slot and the time span it covers.
+type slotTime struct {
+	Slot  phase0.Slot  `json:"slot"`
+	Epoch phase0.Epoch `json:"epoch"`
+
+	// StartTime and EndTime are Unix timestamps, in seconds. EndTime is
+	// exclusive, and is the next slot's StartTime.
+	StartTime int64 `json:"start_time"`
+	EndTime   int64 `json:"end_time"`
+}
+
+// slotTimes maps slots to times with a network's persisted spec.
+type slotTimes struct {
+	genesisTime   time.Time
+	slotDuration  time.Duration
+	slotsPerEpoch uint64
+}
+
+// loadSlotTimes returns the network's slot timing, or a 503 if its spec
+// hasn't been fetched yet.
+func loadSlotTimes(network string) (*slotTimes, error) {
+	store, err := getStore(network)
+	if err != nil {
+		return nil, err
+	}
+	networkSpec, err := store.Spec()
+	if err != nil {
+		return nil, err
+	}
+	if networkSpec == nil {
+		return nil, echo.NewHTTPError(http.StatusServiceUnavailable, "genesis time not known yet")
+	}
+	config, _ := networks.Get(network)
+	return &slotTimes{
+		genesisTime:   networkSpec.GenesisTime,
+		slotDuration:  config.SlotDuration(networkSpec),
+		slotsPerEpoch: networkSpec.SlotsPerEpoch,
+	}, nil
+}
+
+// at returns the slot's time span.
+func (t *slotTimes) at(slot phase0.Slot) slotTime {
+	start := t.genesisTime.Add(time.Duration(slot) * t.slotDuration)
+	return slotTime{
+		Slot:      slot,
+		Epoch:     phase0.Epoch(uint64(slot) / t.slotsPerEpoch),
+		StartTime: start.Unix(),
+		EndTime:   start.Add(t.slotDuration).Unix(),
+	}
+}
+
+// slotAtHandler serves the slot in progress at the Unix time given by the
+// time param.
+func slotAtHandler(c echo.Context) error {
+	unix, err := strconv.ParseInt(c.QueryParam("time"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid time")
+	}
+	times, err := loadSlotTimes(c.Param("network"))
+	if err != nil {
+		return err
+	}
+	at := time.Unix(unix, 0)
+	if at.Before(times.genesisTime) {
+		return echo.NewHTTPError(http.StatusBadRequest, "time is before genesis")
+	}
+	return c.JSON(http.StatusOK, times.at(phase0.Slot(at.Sub(times.genesisTime)/times.slotDuration)))
+}
+
+// timeAtHandler serves the time span of the slot given by the slot param.
+func timeAtHandler(c echo.Context) error {
+	slot, err := strconv.ParseUint(c.QueryParam("slot"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid slot")
+	}
+	times, err := loadSlotTimes(c.Param("network"))
+	if err != nil {
+		return err
+	}
+	if slot >= uint64(math.MaxInt64/times.slotDuration) {
+		return echo.NewHTTPError(http.StatusBadRequest, "slot too far in the future")
+	}
+	return c.JSON(http.StatusOK, times.at(phase0.Slot(slot)))
+}
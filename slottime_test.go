@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlotTimeHandlers(t *testing.T) {
+	const network = "slottime"
+	store := newTestStore(t)
+	stores.Set(network, store)
+	networks.Set(network, NetworkConfig{Name: network})
+	t.Cleanup(func() {
+		stores.Del(network)
+		networks.Del(network)
+	})
+
+	e := echo.New()
+	get := func(handler echo.HandlerFunc, query string) (int, *slotTime) {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/?"+query, nil), rec)
+		c.SetParamNames("network")
+		c.SetParamValues(network)
+		if err := handler(c); err != nil {
+			e.HTTPErrorHandler(err, c)
+		}
+		if rec.Code != http.StatusOK {
+			return rec.Code, nil
+		}
+		var resp slotTime
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return rec.Code, &resp
+	}
+
+	// Unavailable until the genesis time is known.
+	code, _ := get(slotAtHandler, "time=1606824023")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+
+	// Mainnet's genesis.
+	require.NoError(t, store.SetSpec(&NetworkSpec{
+		GenesisTime:    time.Unix(1606824023, 0),
+		SecondsPerSlot: 12,
+		SlotsPerEpoch:  32,
+	}))
+
+	code, resp := get(slotAtHandler, "time=1606824023")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, &slotTime{Slot: 0, Epoch: 0, StartTime: 1606824023, EndTime: 1606824035}, resp)
+
+	// Midway through slot 100.
+	code, resp = get(slotAtHandler, "time=1606825229")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, &slotTime{Slot: 100, Epoch: 3, StartTime: 1606825223, EndTime: 1606825235}, resp)
+
+	code, resp = get(timeAtHandler, "slot=100")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, &slotTime{Slot: 100, Epoch: 3, StartTime: 1606825223, EndTime: 1606825235}, resp)
+
+	for _, tc := range []struct {
+		handler echo.HandlerFunc
+		query   string
+	}{
+		{slotAtHandler, "time=1606824022"},
+		{slotAtHandler, "time=soon"},
+		{timeAtHandler, "slot=-1"},
+		{timeAtHandler, "slot=18446744073709551615"},
+	} {
+		code, _ := get(tc.handler, tc.query)
+		require.Equal(t, http.StatusBadRequest, code, tc.query)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	client "github.com/attestantio/go-eth2-client"
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+)
+
+// NetworkSpec holds the network constants the scraper depends on. It's
+// fetched from the node on first connect and persisted under keySpec.
+type NetworkSpec struct {
+	ConfigName     string    `json:"config_name,omitempty"`
+	GenesisTime    time.Time `json:"genesis_time"`
+	SecondsPerSlot uint64    `json:"seconds_per_slot"`
+	SlotsPerEpoch  uint64    `json:"slots_per_epoch"`
+}
+
+// SlotDuration returns the duration of a slot.
+func (s *NetworkSpec) SlotDuration() time.Duration {
+	return time.Duration(s.SecondsPerSlot) * time.Second
+}
+
+// fetchSpec fetches the network spec from the node.
+func fetchSpec(ctx context.Context, svc client.Service) (*NetworkSpec, error) {
+	ctx, cancel := nodeContext(ctx)
+	defer cancel()
+	genesis, err := svc.(client.GenesisProvider).Genesis(ctx, &api.GenesisOpts{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get genesis time")
+	}
+	resp, err := svc.(client.SpecProvider).Spec(ctx, &api.SpecOpts{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get spec")
+	}
+	config := resp.Data
+	networkSpec := &NetworkSpec{GenesisTime: genesis.Data.GenesisTime.UTC()}
+	if name, ok := config["CONFIG_NAME"].(string); ok {
+		networkSpec.ConfigName = name
+	}
+	secondsPerSlot, ok := config["SECONDS_PER_SLOT"].(time.Duration)
+	if !ok || secondsPerSlot < time.Second {
+		return nil, fmt.Errorf("invalid SECONDS_PER_SLOT %v", config["SECONDS_PER_SLOT"])
+	}
+	networkSpec.SecondsPerSlot = uint64(secondsPerSlot / time.Second)
+	networkSpec.SlotsPerEpoch, ok = config["SLOTS_PER_EPOCH"].(uint64)
+	if !ok || networkSpec.SlotsPerEpoch == 0 {
+		return nil, fmt.Errorf("invalid SLOTS_PER_EPOCH %v", config["SLOTS_PER_EPOCH"])
+	}
+	return networkSpec, nil
+}
+
+// Spec returns the persisted network spec, or nil if it hasn't been stored yet.
+func (s *Store) Spec() (networkSpec *NetworkSpec, err error) {
+	err = s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(keySpec)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			networkSpec = &NetworkSpec{}
+			return json.Unmarshal(val, networkSpec)
+		})
+	})
+	return
+}
+
+// SetSpec persists the network spec.
+func (s *Store) SetSpec(networkSpec *NetworkSpec) error {
+	val, err := json.Marshal(networkSpec)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(keySpec, val)
+	})
+}
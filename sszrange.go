@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/labstack/echo"
+)
+
+// Ranges of slots (as served by /:network/range and /:network/epoch/:epoch)
+// are served as SSZ to clients which accept application/octet-stream, so that
+// bulk consumers needn't decode JSON. The response is framed as follows, with
+// integers in big-endian:
+//
+//	from (uint64) | count (uint32) | count frames
+//
+// with a frame for each slot from `from` onwards, in order:
+//
+//	status (uint8) | version (uint8) | length (uint32) | block (length bytes)
+//
+// where status is sszUnscraped, sszEmpty or sszBlock, and only blocks have
+// the rest of the frame: the block's version (its fork number: 0 is phase0,
+// 1 altair, 2 bellatrix, 3 capella, 4 deneb and 5 electra), and its signed
+// block's SSZ encoding.
+// Each block's version is in its frame, rather than all of them in the
+// header, so that the response can be streamed.
+
+const (
+	sszUnscraped byte = iota
+	sszEmpty
+	sszBlock
+)
+
+// acceptsSSZ returns whether the request asks for an SSZ response.
+func acceptsSSZ(r *http.Request) bool {
+	return strings.Contains(r.Header.Get(echo.HeaderAccept), echo.MIMEOctetStream)
+}
+
+// writeSlotRangeSSZ streams the slots within the given range (inclusive) in
+// the framing described above.
+func writeSlotRangeSSZ(c echo.Context, store *Store, from, to phase0.Slot) error {
+	if to-from >= math.MaxUint32 {
+		return echo.NewHTTPError(http.StatusBadRequest, "range is too large")
+	}
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMEOctetStream)
+	c.Response().WriteHeader(http.StatusOK)
+	w := bufio.NewWriter(c.Response())
+	var header [12]byte
+	binary.BigEndian.PutUint64(header[:8], uint64(from))
+	binary.BigEndian.PutUint32(header[8:], uint32(to-from+1))
+	_, err := w.Write(header[:])
+
+	next := from
+	if err == nil {
+		err = store.IterateBlocksSSZ(from, to, func(slot phase0.Slot, blockBytes []byte, version spec.DataVersion) error {
+			for ; next < slot; next++ {
+				if err := w.WriteByte(sszUnscraped); err != nil {
+					return err
+				}
+			}
+			next = slot + 1
+			if blockBytes == nil {
+				return w.WriteByte(sszEmpty)
+			}
+			var frame [6]byte
+			frame[0], frame[1] = sszBlock, byte(forkNumber(version))
+			binary.BigEndian.PutUint32(frame[2:], uint32(len(blockBytes)))
+			if _, err := w.Write(frame[:]); err != nil {
+				return err
+			}
+			_, err := w.Write(blockBytes)
+			return err
+		})
+	}
+	for ; err == nil && next <= to; next++ {
+		err = w.WriteByte(sszUnscraped)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		// Too late to report an error status, so just cut the response short.
+		componentLogger("api", store.network).Error().Err(err).Uint64("from", uint64(from)).Uint64("to", uint64(to)).Msg("failed to write slots")
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteSlotRangeSSZ(t *testing.T) {
+	store := newTestStore(t)
+	require.NoError(t, store.SetBlock(2, testBlock(2)))
+	require.NoError(t, store.SetBlock(3, nil))
+	require.NoError(t, store.SetBlock(5, testBellatrixBlock(5, phase0.Hash32{5})))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAccept, echo.MIMEOctetStream)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	require.NoError(t, writeSlotRange(c, store, 1, 6, blockOptions{}))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, echo.MIMEOctetStream, rec.Header().Get(echo.HeaderContentType))
+
+	body := rec.Body.Bytes()
+	require.Equal(t, uint64(1), binary.BigEndian.Uint64(body[:8]))
+	require.Equal(t, uint32(6), binary.BigEndian.Uint32(body[8:12]))
+	body = body[12:]
+	var statuses []byte
+	blocks := map[phase0.Slot]*spec.VersionedSignedBeaconBlock{}
+	for slot := phase0.Slot(1); slot <= 6; slot++ {
+		status := body[0]
+		statuses = append(statuses, status)
+		body = body[1:]
+		if status != sszBlock {
+			continue
+		}
+		version := forkOfNumber(uint64(body[0]))
+		n := binary.BigEndian.Uint32(body[1:5])
+		block, err := unmarshalBlock(version, body[5:5+n])
+		require.NoError(t, err)
+		blocks[slot] = block
+		body = body[5+n:]
+	}
+	require.Empty(t, body)
+	require.Equal(t, []byte{sszUnscraped, sszBlock, sszEmpty, sszUnscraped, sszBlock, sszUnscraped}, statuses)
+	require.Equal(t, spec.DataVersionPhase0, blocks[2].Version)
+	require.Equal(t, phase0.Slot(2), blocks[2].Phase0.Message.Slot)
+	require.Equal(t, spec.DataVersionBellatrix, blocks[5].Version)
+	require.Equal(t, phase0.Slot(5), blocks[5].Bellatrix.Message.Slot)
+}
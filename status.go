@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/cornelk/hashmap"
+	"github.com/labstack/echo"
+	"github.com/paulbellamy/ratecounter"
+)
+
+// scrapeStatus is the in-memory state of a network's scraping, for /status.
+type scrapeStatus struct {
+	mu              sync.Mutex
+	lastScrape      time.Time
+	errorsPerSecond float64
+	emptyPerSecond  float64
+
+	// errors counts the failed block requests over the rate window.
+	errors *ratecounter.RateCounter
+}
+
+// scrapeStatuses holds the scrape status of each network scraped since start.
+var scrapeStatuses = hashmap.New[string, *scrapeStatus]()
+
+// scrapeStatusOf returns the network's scrape status.
+func scrapeStatusOf(network string) *scrapeStatus {
+	if status, ok := scrapeStatuses.Get(network); ok {
+		return status
+	}
+	status, _ := scrapeStatuses.GetOrInsert(network, &scrapeStatus{
+		errors: ratecounter.NewRateCounter(rateWindow),
+	})
+	return status
+}
+
+// scraped records that scraped blocks were written at the given time.
+func (s *scrapeStatus) scraped(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastScrape = t
+}
+
+// setRates sets the sampled rates of failed block requests and of empty
+// slots, which are told apart so that a failing node isn't mistaken for
+// empty slots, or the other way around.
+func (s *scrapeStatus) setRates(errorsPerSecond, emptyPerSecond float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errorsPerSecond = errorsPerSecond
+	s.emptyPerSecond = emptyPerSecond
+}
+
+// networkStatus is a network's entry in /status.
+type networkStatus struct {
+	NodeURL         string       `json:"node_url"`
+	Connected       bool         `json:"connected"`
+	HeadSlot        *phase0.Slot `json:"head_slot"`
+	HighestSlot     *phase0.Slot `json:"highest_slot"`
+	LagSlots        *uint64      `json:"lag_slots"`
+	ErrorsPerSecond float64      `json:"errors_per_second"`
+	EmptyPerSecond  float64      `json:"empty_slots_per_second"`
+	LastScrape      *time.Time   `json:"last_scrape"`
+	Lease           *Lease       `json:"lease"`
+	Error           string       `json:"error,omitempty"`
+}
+
+// statusOf returns the network's status, from its scrape status and its
+// store. Fields which aren't known yet are left nil.
+func statusOf(network NetworkConfig) *networkStatus {
+	status := &networkStatus{NodeURL: redactURL(network.NodeURL)}
+	_, status.Connected = nodes.Get(network.Name)
+	if scrape, ok := scrapeStatuses.Get(network.Name); ok {
+		scrape.mu.Lock()
+		status.ErrorsPerSecond = scrape.errorsPerSecond
+		status.EmptyPerSecond = scrape.emptyPerSecond
+		if !scrape.lastScrape.IsZero() {
+			lastScrape := scrape.lastScrape
+			status.LastScrape = &lastScrape
+		}
+		scrape.mu.Unlock()
+	}
+	store, ok := stores.Get(network.Name)
+	if !ok {
+		status.Error = "store not open"
+		return status
+	}
+	fail := func(err error) *networkStatus {
+		status.Error = err.Error()
+		return status
+	}
+	lease, err := store.Lease()
+	if err != nil {
+		return fail(err)
+	}
+	status.Lease = lease
+	if slot, ok, err := store.HeadSlot(); err != nil {
+		return fail(err)
+	} else if ok {
+		status.HeadSlot = &slot
+	}
+	if slot, ok, err := store.HighestFilledSlot(); err != nil {
+		return fail(err)
+	} else if ok {
+		status.HighestSlot = &slot
+	}
+	if lag, ok, err := lagSlots(store, network); err != nil {
+		return fail(err)
+	} else if ok {
+		status.LagSlots = &lag
+	}
+	return status
+}
+
+// statusHandler serves the status of every configured network at once, as
+// an operator's dashboard.
+func statusHandler(c echo.Context) error {
+	statuses := make(map[string]*networkStatus)
+	networks.Range(func(name string, network NetworkConfig) bool {
+		network.Name = name
+		statuses[name] = statusOf(network)
+		return true
+	})
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"time":     time.Now().UTC(),
+		"networks": statuses,
+	})
+}
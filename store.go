@@ -3,40 +3,157 @@ package main
 import (
 	"context"
 	"encoding/binary"
-	"log"
+	"fmt"
 	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/attestantio/go-eth2-client/spec"
-	"github.com/attestantio/go-eth2-client/spec/altair"
-	"github.com/attestantio/go-eth2-client/spec/bellatrix"
 	"github.com/attestantio/go-eth2-client/spec/phase0"
 	"github.com/dgraph-io/badger/v3"
-	"github.com/klauspost/compress/snappy"
+	"github.com/pkg/errors"
 )
 
 const (
 	gcInterval = 30 * time.Minute
+
+	// How long the slot counts of summaries are cached for, see CachedCount.
+	slotCountsTTL = 10 * time.Second
+
+	// The sizes of a record's header and of the block root following it, see
+	// encodeBlock.
+	recordHeaderSize = 8
+	recordRootSize   = 32
+
+	// The size of the record of an empty slot, which has no block after its
+	// (zero) root.
+	emptyRecordSize = recordHeaderSize + recordRootSize
+
+	// The least fraction of a value log file that must be garbage for GC to rewrite it.
+	gcDiscardRatio = 0.7
 )
 
 var (
 	keyBoundaries = []byte{0}
 	keySlot       = []byte{1}
+	keyDirty      = []byte{2}
+	keySpec       = []byte{5}
+	keyFinalized  = []byte{7}
+	keyOrphaned   = []byte{8} // See orphans.go.
+	keyHead       = []byte{10}
+	keyPin        = []byte{11} // See pins.go.
+	keyBitmap     = []byte{12} // See bitmap.go.
+	keyReindex    = []byte{13} // See reindex.go.
+	keyCheckpoint = []byte{14} // See checkpoint.go.
+	// 15 held scrape leases, which are now kept outside the store (see
+	// lease.go), and expire by themselves.
+	keyAnnotation = []byte{17} // See annotations.go.
+
+	// Secondary indexes, see index.go.
+	keyIndexes       = []byte{3}
+	keyExecutionHash = []byte{4}
+	keyBlockRoot     = []byte{6}
+	keyProposer      = []byte{9}
+	keySizes         = []byte{16} // See sizes.go.
 )
 
+// slotKey returns the key of the given slot under the given prefix.
+func slotKey(prefix []byte, slot phase0.Slot) []byte {
+	key := make([]byte, len(prefix)+8)
+	copy(key, prefix)
+	binary.BigEndian.PutUint64(key[len(prefix):], uint64(slot))
+	return key
+}
+
 type Store struct {
-	db     *badger.DB
-	ctx    context.Context
-	cancel func()
+	network string
+	db      *badger.DB
+
+	// ctx is done once the store is closed, which waits for tasks, see goTask.
+	ctx       context.Context
+	cancel    func()
+	tasks     sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+
+	// Caches are evicted of slots as they're overwritten or purged.
+	cache              *BlockCache
+	summaryCache       *SummaryCache
+	participationCache *ParticipationCache
+
+	// broker publishes the slots as they're stored.
+	broker *Broker
+
+	// codec compresses newly written blocks. Existing blocks are
+	// decompressed with the codec they were written with.
+	codec Codec
+
+	// keepOrphans keeps the blocks replaced by different ones, see orphans.go.
+	keepOrphans bool
+
+	// recordSizes records the sizes of the blocks written, see sizes.go.
+	recordSizes bool
+
+	// pruneEmpty writes no records for empty slots, see prune.go.
+	pruneEmpty bool
+
+	// finalized holds the *phase0.Checkpoint last read or set, so that
+	// requests can check whether a slot is finalized without reading it.
+	finalized atomic.Value
+
+	// head holds the phase0.Slot last read or set, likewise, or noHeadSlot
+	// if there's none since the store was wiped.
+	head atomic.Value
+
+	// expiry holds the *slotExpiry slots are written with, see expiry.go.
+	expiry atomic.Value
+
+	// gcMu prevents concurrent value log GC runs, see RunGC.
+	gcMu sync.Mutex
+
+	// lastGC holds the GCResult of the last run, see Report.
+	lastGC atomic.Value
+
+	// bitmapMu serializes the updates of slot bitmaps, see bitmap.go.
+	bitmapMu sync.Mutex
+
+	// reindexMu prevents concurrent re-indexing runs, see Reindex.
+	reindexMu sync.Mutex
+
+	// checkpointMu serializes the updates of the scrape checkpoint, see
+	// checkpoint.go.
+	checkpointMu sync.Mutex
+
+	// counts holds the *slotCounts last counted by CachedCount.
+	counts atomic.Value
+
+	// lease is the store's scrape lease file, or nil if it's in memory.
+	lease *leaseFile
 }
 
 func OpenStore(dir, network string) (*Store, error) {
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, err
 	}
-	opt := badger.DefaultOptions(filepath.Join(dir, network))
+	s, err := openStore(badger.DefaultOptions(filepath.Join(dir, network)), network)
+	if err != nil {
+		return nil, err
+	}
+	s.lease = newLeaseFile(filepath.Join(dir, network+".lease"))
+	return s, nil
+}
+
+// OpenStoreInMemory opens a store which is kept in memory rather than on
+// disk, for tests and ephemeral use. Its blocks are lost when it's closed.
+func OpenStoreInMemory(network string) (*Store, error) {
+	return openStore(badger.DefaultOptions("").WithInMemory(true), network)
+}
+
+func openStore(opt badger.Options, network string) (*Store, error) {
 	opt.Logger = nil
 	db, err := badger.Open(opt)
 	if err != nil {
@@ -44,12 +161,16 @@ func OpenStore(dir, network string) (*Store, error) {
 	}
 
 	s := &Store{
-		db: db,
+		network: network,
+		db:      db,
+		broker:  NewBroker(),
 	}
 	s.ctx, s.cancel = context.WithCancel(context.Background())
 
-	// Garbage collection.
-	go s.gc()
+	// Garbage collection, of which there's no value log to need in memory.
+	if !opt.InMemory {
+		s.goTask(func(context.Context) { s.gc() })
+	}
 
 	return s, nil
 }
@@ -58,12 +179,7 @@ func (s *Store) gc() {
 	ticker := time.NewTicker(gcInterval)
 	defer ticker.Stop()
 	for {
-		start := time.Now()
-		err := s.db.RunValueLogGC(0.7)
-		if err != nil {
-			log.Printf("Error running value log GC: %v", err)
-		}
-		log.Printf("BadgerDB GC took %v", time.Since(start))
+		s.RunGC(gcDiscardRatio)
 		select {
 		case <-s.ctx.Done():
 			return
@@ -72,6 +188,46 @@ func (s *Store) gc() {
 	}
 }
 
+// FirstUnfilledSlot returns the first slot from the given one which isn't
+// Filled, reading the run of filled slots with a single key-only iterator
+// rather than checking each (besides slots pruned as empty, see prune.go).
+// Creating the iterators costs more than a Filled check, so it's for
+// skipping runs of filled slots.
+func (s *Store) FirstUnfilledSlot(from phase0.Slot) (slot phase0.Slot, err error) {
+	slot = from
+	err = s.db.View(func(txn *badger.Txn) error {
+		// The run of filled slots ends at the first invalidated one.
+		end := phase0.Slot(math.MaxUint64)
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = keyDirty
+		dirty := txn.NewIterator(opts)
+		dirty.Seek(slotKey(keyDirty, from))
+		if dirty.Valid() {
+			end = phase0.Slot(binary.BigEndian.Uint64(dirty.Item().Key()[len(keyDirty):]))
+		}
+		dirty.Close()
+
+		opts.Prefix = keySlot
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		it.Seek(slotKey(keySlot, from))
+		for slot < end {
+			if it.Valid() && phase0.Slot(binary.BigEndian.Uint64(it.Item().Key()[len(keySlot):])) == slot {
+				it.Next()
+			} else if empty, err := s.prunedEmpty(txn, slot); err != nil {
+				return err
+			} else if !empty {
+				break
+			}
+			slot++
+		}
+		return nil
+	})
+	return
+}
+
+// Filled returns whether the slot was scraped and wasn't invalidated since.
 func (s *Store) Filled(slot phase0.Slot) (bool, error) {
 	var exists bool
 	err := s.db.View(func(txn *badger.Txn) error {
@@ -82,12 +238,291 @@ func (s *Store) Filled(slot phase0.Slot) (bool, error) {
 			exists = true
 		} else if err != badger.ErrKeyNotFound {
 			return err
+		} else if exists, err = s.prunedEmpty(txn, slot); err != nil {
+			return err
+		}
+		if exists {
+			_, err := txn.Get(slotKey(keyDirty, slot))
+			if err == nil {
+				exists = false
+			} else if err != badger.ErrKeyNotFound {
+				return err
+			}
 		}
 		return nil
 	})
 	return exists, err
 }
 
+// LowestFilledSlot returns the lowest Filled slot, or ok=false if there's none.
+func (s *Store) LowestFilledSlot() (slot phase0.Slot, ok bool, err error) {
+	err = s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = keySlot
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			slot = phase0.Slot(binary.BigEndian.Uint64(it.Item().Key()[len(keySlot):]))
+			_, err := txn.Get(slotKey(keyDirty, slot))
+			if err == badger.ErrKeyNotFound {
+				ok = true
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// HighestFilledSlot returns the highest Filled slot, or ok=false if there's none.
+func (s *Store) HighestFilledSlot() (slot phase0.Slot, ok bool, err error) {
+	err = s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Reverse = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(slotKey(keySlot, math.MaxUint64)); it.ValidForPrefix(keySlot); it.Next() {
+			recordSlot := phase0.Slot(binary.BigEndian.Uint64(it.Item().Key()[len(keySlot):]))
+			_, err := txn.Get(slotKey(keyDirty, recordSlot))
+			if err == badger.ErrKeyNotFound {
+				slot, ok = recordSlot, true
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		// A higher slot may have been pruned as empty.
+		pruned, prunedOK, err := s.highestPrunedEmpty(txn)
+		if err != nil {
+			return err
+		}
+		if prunedOK && (!ok || pruned > slot) {
+			slot, ok = pruned, true
+		}
+		return nil
+	})
+	return
+}
+
+// LatestBlock returns the highest Filled slot which has a block, and its block.
+// Returns badger.ErrKeyNotFound if there's none.
+func (s *Store) LatestBlock() (slot phase0.Slot, block *BlockWithRoot, err error) {
+	err = s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(slotKey(keySlot, math.MaxUint64)); it.ValidForPrefix(keySlot); it.Next() {
+			item := it.Item()
+			slot = phase0.Slot(binary.BigEndian.Uint64(item.Key()[len(keySlot):]))
+			_, err := txn.Get(slotKey(keyDirty, slot))
+			if err == nil {
+				continue
+			}
+			if err != badger.ErrKeyNotFound {
+				return err
+			}
+			// Skip the slots the bitmaps know are empty without decoding
+			// them. With prune_empty, those have no record to begin with.
+			bitmap, _, err := readBitmap(txn, uint64(slot/bitmapSlots))
+			if err != nil {
+				return err
+			}
+			if bitmap.state(slot) == slotEmpty {
+				continue
+			}
+			err = item.Value(func(val []byte) (err error) {
+				block, err = decodeBlock(val)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if block != nil {
+				return nil
+			}
+		}
+		return badger.ErrKeyNotFound
+	})
+	return
+}
+
+// Finalized returns the latest finalized checkpoint, or nil if none was set.
+func (s *Store) Finalized() (checkpoint *phase0.Checkpoint, err error) {
+	if checkpoint, ok := s.finalized.Load().(*phase0.Checkpoint); ok {
+		return checkpoint, nil
+	}
+	defer func() {
+		if checkpoint != nil {
+			s.finalized.Store(checkpoint)
+		}
+	}()
+	err = s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(keyFinalized)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			checkpoint = &phase0.Checkpoint{Epoch: phase0.Epoch(binary.BigEndian.Uint64(val[:8]))}
+			copy(checkpoint.Root[:], val[8:40])
+			return nil
+		})
+	})
+	return
+}
+
+// SetFinalized sets the latest finalized checkpoint, unless it's older than
+// the current one.
+func (s *Store) SetFinalized(checkpoint *phase0.Checkpoint) error {
+	updated := false
+	err := s.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(keyFinalized)
+		if err == nil {
+			var epoch phase0.Epoch
+			err = item.Value(func(val []byte) error {
+				epoch = phase0.Epoch(binary.BigEndian.Uint64(val[:8]))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if checkpoint.Epoch < epoch {
+				return nil
+			}
+		} else if err != badger.ErrKeyNotFound {
+			return err
+		}
+		val := make([]byte, 40)
+		binary.BigEndian.PutUint64(val[:8], uint64(checkpoint.Epoch))
+		copy(val[8:], checkpoint.Root[:])
+		updated = true
+		return txn.Set(keyFinalized, val)
+	})
+	if err == nil && updated {
+		finalized := *checkpoint
+		s.finalized.Store(&finalized)
+	}
+	return err
+}
+
+// HeadSlot returns the latest head slot seen by the node. ok is false if none was set.
+func (s *Store) HeadSlot() (slot phase0.Slot, ok bool, err error) {
+	if slot, ok := s.head.Load().(phase0.Slot); ok {
+		if slot == noHeadSlot {
+			return 0, false, nil
+		}
+		return slot, true, nil
+	}
+	err = s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(keyHead)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			slot, ok = phase0.Slot(binary.BigEndian.Uint64(val)), true
+			return nil
+		})
+	})
+	if ok {
+		s.head.Store(slot)
+	}
+	return slot, ok, err
+}
+
+// SetHeadSlot sets the latest head slot seen by the node, which may be lower
+// than the previous one after a reorg.
+func (s *Store) SetHeadSlot(slot phase0.Slot) error {
+	if prev, ok := s.head.Load().(phase0.Slot); ok && prev == slot {
+		return nil
+	}
+	err := s.db.Update(func(txn *badger.Txn) error {
+		var val [8]byte
+		binary.BigEndian.PutUint64(val[:], uint64(slot))
+		return txn.Set(keyHead, val[:])
+	})
+	if err == nil {
+		s.head.Store(slot)
+	}
+	return err
+}
+
+// FinalizedSlot returns the first slot of the latest finalized epoch, at or
+// before which slots can no longer change. ok is false if none was set.
+func (s *Store) FinalizedSlot() (slot phase0.Slot, ok bool, err error) {
+	checkpoint, err := s.Finalized()
+	if err != nil || checkpoint == nil {
+		return 0, false, err
+	}
+	networkSpec, err := s.Spec()
+	if err != nil {
+		return 0, false, err
+	}
+	slotsPerEpoch := phase0.Slot(defaultSlotsPerEpoch)
+	if networkSpec != nil {
+		slotsPerEpoch = phase0.Slot(networkSpec.SlotsPerEpoch)
+	}
+	return phase0.Slot(checkpoint.Epoch) * slotsPerEpoch, true, nil
+}
+
+// Invalidate marks the scraped slots within the given range (inclusive) as dirty,
+// so that they're no longer Filled until they're set again. The stored blocks
+// remain readable meanwhile. Returns the slots which were marked.
+func (s *Store) Invalidate(from, to phase0.Slot) (invalidated []phase0.Slot, err error) {
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+	err = s.db.Update(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(slotKey(keySlot, from)); it.ValidForPrefix(keySlot); it.Next() {
+			slot := phase0.Slot(binary.BigEndian.Uint64(it.Item().Key()[len(keySlot):]))
+			if slot > to {
+				break
+			}
+			if err := txn.Set(slotKey(keyDirty, slot), nil); err != nil {
+				return err
+			}
+			invalidated = append(invalidated, slot)
+		}
+		pruned, err := s.prunedEmptySlots(txn, from, to)
+		if err != nil {
+			return err
+		}
+		for _, slot := range pruned {
+			if err := txn.Set(slotKey(keyDirty, slot), nil); err != nil {
+				return err
+			}
+		}
+		if len(pruned) > 0 {
+			invalidated = append(invalidated, pruned...)
+			sort.Slice(invalidated, func(i, j int) bool { return invalidated[i] < invalidated[j] })
+		}
+		if len(invalidated) == 0 {
+			return nil
+		}
+		return lowerCheckpoint(txn, invalidated[0])
+	})
+	return
+}
+
 func (s *Store) Count() (slots, blocks int, err error) {
 	err = s.db.View(func(txn *badger.Txn) error {
 		it := txn.NewIterator(badger.DefaultIteratorOptions)
@@ -96,8 +531,10 @@ func (s *Store) Count() (slots, blocks int, err error) {
 			slots++
 
 			err := it.Item().Value(func(val []byte) error {
-				version := spec.DataVersion(binary.BigEndian.Uint64(val[:8]))
-				if version != spec.DataVersion(math.MaxInt) {
+				if err := checkRecord(val); err != nil {
+					return err
+				}
+				if _, _, ok := readHeader(val); ok {
 					blocks++
 				}
 				return nil
@@ -111,142 +548,806 @@ func (s *Store) Count() (slots, blocks int, err error) {
 	return
 }
 
+// slotCounts are the counts of a store's slots, as of the time they were counted.
+type slotCounts struct {
+	slots, blocks int
+	at            time.Time
+}
+
+// CachedCount returns the number of scraped slots and blocks, as counted up to
+// slotCountsTTL ago. Unlike Count, it reads only the slots' keys, telling
+// empty slots apart by the size of their header-only records, so that it's
+// cheap enough for the public summaries. With prune_empty, the slots pruned as
+// empty are counted from the bitmaps.
+func (s *Store) CachedCount() (slots, blocks int, err error) {
+	if counts, ok := s.counts.Load().(*slotCounts); ok && time.Since(counts.at) < slotCountsTTL {
+		return counts.slots, counts.blocks, nil
+	}
+	at := time.Now()
+	err = s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = keySlot
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			slots++
+			if it.Item().ValueSize() != emptyRecordSize {
+				blocks++
+			}
+		}
+		pruned, err := s.prunedEmptySlots(txn, 0, math.MaxUint64)
+		slots += len(pruned)
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	s.counts.Store(&slotCounts{slots: slots, blocks: blocks, at: at})
+	return slots, blocks, nil
+}
+
+// StoreStats describes the size and contents of a Store.
+type StoreStats struct {
+	LSMSize  int64 `json:"lsm_size"`
+	VlogSize int64 `json:"vlog_size"`
+
+	// Slots is the number of scraped slots, of which Blocks had a block,
+	// Empty had none, and Dirty were invalidated by a reorg.
+	Slots  int `json:"slots"`
+	Blocks int `json:"blocks"`
+	Empty  int `json:"empty"`
+	Dirty  int `json:"dirty"`
+
+	// Indexes is the number of keys in each secondary index.
+	Indexes map[string]int `json:"indexes"`
+}
+
+// Stats returns the size and contents of the store.
+func (s *Store) Stats() (*StoreStats, error) {
+	stats := &StoreStats{}
+	stats.LSMSize, stats.VlogSize = s.db.Size()
+	var err error
+	stats.Slots, stats.Blocks, err = s.Count()
+	if err != nil {
+		return nil, err
+	}
+	stats.Empty = stats.Slots - stats.Blocks
+
+	indexes := map[string][]byte{
+		"block_root":     keyBlockRoot,
+		"execution_hash": keyExecutionHash,
+		"proposer":       keyProposer,
+	}
+	stats.Indexes = make(map[string]int, len(indexes))
+	err = s.db.View(func(txn *badger.Txn) error {
+		stats.Dirty = countPrefix(txn, keyDirty)
+		for name, prefix := range indexes {
+			stats.Indexes[name] = countPrefix(txn, prefix)
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// countPrefix returns the number of keys with the given prefix.
+func countPrefix(txn *badger.Txn, prefix []byte) (count int) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		count++
+	}
+	return
+}
+
 type BlockWithRoot struct {
 	BlockRoot phase0.Root
 	*spec.VersionedSignedBeaconBlock
+
+	// Blinded is set if the block was reconstructed from its blinded block,
+	// so that its execution payload has no transactions. See blinded.go.
+	Blinded bool
 }
 
-func (s *Store) Block(slot phase0.Slot) (*BlockWithRoot, error) {
-	block := &BlockWithRoot{VersionedSignedBeaconBlock: &spec.VersionedSignedBeaconBlock{}}
-	err := s.db.View(func(txn *badger.Txn) error {
+func (s *Store) Block(slot phase0.Slot) (block *BlockWithRoot, err error) {
+	err = s.db.View(func(txn *badger.Txn) error {
 		// 1) Read slot from key.
 		var slotBytes [8]byte
 		binary.BigEndian.PutUint64(slotBytes[:], uint64(slot))
 		item, err := txn.Get(append(keySlot, slotBytes[:]...))
+		if err == badger.ErrKeyNotFound {
+			if empty, err := s.prunedEmpty(txn, slot); err != nil || empty {
+				return err
+			}
+		}
 		if err != nil {
 			return err
 		}
 
-		// 2) Copy the value.
-		val, err := item.ValueCopy(nil)
-		if err != nil {
+		// 2) Decode the value.
+		return item.Value(func(val []byte) error {
+			block, err = decodeBlock(val)
 			return err
-		}
+		})
+	})
+	return
+}
 
-		// 2.1) Read version.
-		block.Version = spec.DataVersion(binary.BigEndian.Uint64(val[:8]))
-		if block.Version == spec.DataVersion(math.MaxInt) {
-			// No block for this slot.
-			block = nil
-			return nil
-		}
+// Blocks returns the scraped slots within the given range (inclusive),
+// using a single iterator. Empty slots have a nil block.
+func (s *Store) Blocks(from, to phase0.Slot) (map[phase0.Slot]*BlockWithRoot, error) {
+	blocks := make(map[phase0.Slot]*BlockWithRoot)
+	err := s.IterateBlocks(from, to, func(slot phase0.Slot, block *BlockWithRoot) error {
+		blocks[slot] = block
+		return nil
+	})
+	return blocks, err
+}
 
-		// 2.2) Read root.
-		copy(block.BlockRoot[:], val[8:40])
+// errStopIteration may be returned by the callbacks of IterateBlocks and
+// ForEachBlock to stop iterating early, without failing.
+var errStopIteration = errors.New("stop iteration")
 
-		// 2.3) Read block.
-		blockBytes, err := snappy.Decode(nil, val[40:])
+// IterateBlocks calls fn in order with each scraped slot within the given
+// range (inclusive), using a single iterator. Empty slots have a nil block.
+func (s *Store) IterateBlocks(from, to phase0.Slot, fn func(slot phase0.Slot, block *BlockWithRoot) error) error {
+	return s.iterateSlots(from, to, func(slot phase0.Slot, val []byte) error {
+		block, err := decodeBlock(val)
 		if err != nil {
 			return err
 		}
-		switch block.Version {
-		case spec.DataVersionPhase0:
-			block.Phase0 = &phase0.SignedBeaconBlock{}
-			if err := block.Phase0.UnmarshalSSZ(blockBytes); err != nil {
+		return fn(slot, block)
+	})
+}
+
+// IterateFilledAfter calls fn in order with each Filled slot after the given
+// one, up to limit slots, using a single iterator. Empty slots have a nil block.
+func (s *Store) IterateFilledAfter(after phase0.Slot, limit int, fn func(slot phase0.Slot, block *BlockWithRoot) error) error {
+	if after == math.MaxUint64 {
+		return nil
+	}
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: keySlot})
+		defer it.Close()
+		for it.Seek(slotKey(keySlot, after+1)); it.Valid() && limit > 0; it.Next() {
+			item := it.Item()
+			slot := phase0.Slot(binary.BigEndian.Uint64(item.Key()[len(keySlot):]))
+			if _, err := txn.Get(slotKey(keyDirty, slot)); err == nil {
+				continue
+			} else if err != badger.ErrKeyNotFound {
 				return err
 			}
-		case spec.DataVersionAltair:
-			block.Altair = &altair.SignedBeaconBlock{}
-			if err := block.Altair.UnmarshalSSZ(blockBytes); err != nil {
+			var block *BlockWithRoot
+			err := item.Value(func(val []byte) (err error) {
+				block, err = decodeBlock(val)
+				return err
+			})
+			if err != nil {
 				return err
 			}
-		case spec.DataVersionBellatrix:
-			block.Bellatrix = &bellatrix.SignedBeaconBlock{}
-			if err := block.Bellatrix.UnmarshalSSZ(blockBytes); err != nil {
+			if err := fn(slot, block); err != nil {
 				return err
 			}
+			limit--
 		}
 		return nil
 	})
-	return block, err
+	if errors.Is(err, errStopIteration) {
+		return nil
+	}
+	return err
 }
 
-func (s *Store) SetBlock(slot phase0.Slot, block *BlockWithRoot) error {
-	return s.db.Update(func(txn *badger.Txn) error {
-		var slotBytes [8]byte
-		binary.BigEndian.PutUint64(slotBytes[:], uint64(slot))
+// IterateBlocksSSZ calls fn in order with the SSZ-encoded signed block and
+// version of each scraped slot within the given range (inclusive), without
+// decoding them. Empty slots have nil bytes.
+func (s *Store) IterateBlocksSSZ(from, to phase0.Slot, fn func(slot phase0.Slot, blockBytes []byte, version spec.DataVersion) error) error {
+	return s.iterateSlots(from, to, func(slot phase0.Slot, val []byte) error {
+		if err := checkRecord(val); err != nil {
+			return err
+		}
+		version, codec, ok := readHeader(val)
+		if !ok {
+			return fn(slot, nil, 0)
+		}
+		blockBytes, err := codec.Decode(val[40:])
+		if err != nil {
+			return corruptRecordError{err}
+		}
+		return fn(slot, blockBytes, version)
+	})
+}
 
-		var versionBytes [8]byte
-		if block == nil {
-			binary.BigEndian.PutUint64(versionBytes[:], math.MaxInt)
-		} else {
-			binary.BigEndian.PutUint64(versionBytes[:], uint64(block.Version))
+// ForEachBlock calls fn in order with each block within the given range
+// (inclusive), skipping empty slots. If versions are given, only blocks of
+// those versions are decoded and passed to fn.
+func (s *Store) ForEachBlock(from, to phase0.Slot, versions []spec.DataVersion, fn func(slot phase0.Slot, block *BlockWithRoot) error) error {
+	return s.iterateSlots(from, to, func(slot phase0.Slot, val []byte) error {
+		if err := checkRecord(val); err != nil {
+			return err
+		}
+		version, _, ok := readHeader(val)
+		if !ok || !containsVersion(versions, version) {
+			return nil
+		}
+		block, err := decodeBlock(val)
+		if err != nil {
+			return err
 		}
+		return fn(slot, block)
+	})
+}
 
-		var root phase0.Root
-		if block != nil {
-			root = block.BlockRoot
+func containsVersion(versions []spec.DataVersion, version spec.DataVersion) bool {
+	if len(versions) == 0 {
+		return true
+	}
+	for _, v := range versions {
+		if v == version {
+			return true
 		}
+	}
+	return false
+}
+
+// iterateSlots calls fn in order with the stored value of each scraped slot
+// within the given range (inclusive). The value is only valid within fn.
+func (s *Store) iterateSlots(from, to phase0.Slot, fn func(slot phase0.Slot, val []byte) error) error {
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(slotKey(keySlot, from)); it.ValidForPrefix(keySlot); it.Next() {
+			item := it.Item()
+			slot := phase0.Slot(binary.BigEndian.Uint64(item.Key()[len(keySlot):]))
+			if slot > to {
+				break
+			}
+			err := item.Value(func(val []byte) error {
+				return fn(slot, val)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errStopIteration) {
+		return nil
+	}
+	return err
+}
+
+// decodeBlock decodes a stored value into a block, or nil for an empty slot.
+// Records which fail to decode are reported as a corruptRecordError, rather
+// than panicking or returning garbage.
+func decodeBlock(val []byte) (block *BlockWithRoot, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			block, err = nil, corruptRecordError{fmt.Errorf("panic: %v", r)}
+		}
+	}()
+	if err := checkRecord(val); err != nil {
+		return nil, err
+	}
+
+	// 1) Read version.
+	version, codec, ok := readHeader(val)
+	if !ok {
+		// No block for this slot.
+		return nil, nil
+	}
+
+	// 2) Read root.
+	block = &BlockWithRoot{Blinded: isBlindedRecord(val)}
+	copy(block.BlockRoot[:], val[8:40])
+
+	// 3) Read block.
+	blockBytes, err := codec.Decode(val[40:])
+	if err != nil {
+		return nil, corruptRecordError{err}
+	}
+	block.VersionedSignedBeaconBlock, err = unmarshalBlock(version, blockBytes)
+	if err != nil {
+		return nil, corruptRecordError{err}
+	}
+	return block, nil
+}
+
+// BlockHeader is the part of a stored record ahead of its compressed block.
+type BlockHeader struct {
+	Version spec.DataVersion
+	Root    phase0.Root
+	Blinded bool
+}
+
+// BlockHeader returns the version and root of the block at the given slot,
+// read from its record's header without decompressing or decoding the block.
+// ok is false if the slot has no block.
+func (s *Store) BlockHeader(slot phase0.Slot) (header BlockHeader, ok bool, err error) {
+	err = s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(slotKey(keySlot, slot))
+		if err == badger.ErrKeyNotFound {
+			if empty, err := s.prunedEmpty(txn, slot); err != nil || empty {
+				return err
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			if len(val) < 40 {
+				return corruptRecordError{errors.New("truncated root")}
+			}
+			if header.Version, _, ok = readHeader(val); ok {
+				copy(header.Root[:], val[8:40])
+				header.Blinded = isBlindedRecord(val)
+			}
+			return nil
+		})
+	})
+	return
+}
 
-		var blockBytes []byte
-		if block != nil {
+// BlockSSZ returns the SSZ-encoded signed block at the given slot and its version,
+// without decoding it. Returns nil bytes if the slot has no block.
+func (s *Store) BlockSSZ(slot phase0.Slot) (blockBytes []byte, version spec.DataVersion, err error) {
+	err = s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(slotKey(keySlot, slot))
+		if err == badger.ErrKeyNotFound {
+			if empty, err := s.prunedEmpty(txn, slot); err != nil || empty {
+				return err
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			if err := checkRecord(val); err != nil {
+				return err
+			}
 			var (
-				b   []byte
-				err error
+				codec Codec
+				ok    bool
 			)
-			switch block.Version {
-			case spec.DataVersionPhase0:
-				b, err = block.Phase0.MarshalSSZ()
-			case spec.DataVersionAltair:
-				b, err = block.Altair.MarshalSSZ()
-			case spec.DataVersionBellatrix:
-				b, err = block.Bellatrix.MarshalSSZ()
+			version, codec, ok = readHeader(val)
+			if !ok {
+				// No block for this slot.
+				return nil
+			}
+			blockBytes, err = codec.Decode(val[40:])
+			if err != nil {
+				return corruptRecordError{err}
+			}
+			return nil
+		})
+	})
+	return
+}
+
+func (s *Store) SetBlock(slot phase0.Slot, block *BlockWithRoot) error {
+	value, err := encodeBlock(block, s.codec)
+	if err != nil {
+		return err
+	}
+	defer s.evict(slot)
+	s.bitmapMu.Lock()
+	defer s.bitmapMu.Unlock()
+	err = s.db.Update(func(txn *badger.Txn) error {
+		key := slotKey(keySlot, slot)
+		expiresAt, err := s.expiresAt(txn, slot)
+		if err != nil {
+			return err
+		}
+		w := withExpiry(txn, expiresAt)
+		bitmaps := newBitmapWriter(txn, s.slotExpiry())
+		if err := bitmaps.set(slot, stateOf(value)); err != nil {
+			return err
+		}
+		if err := bitmaps.write(txn); err != nil {
+			return err
+		}
+		orphan, err := s.replacedBlock(txn, slot, block)
+		if err != nil {
+			return err
+		}
+		if orphan != nil {
+			if err := w.Set(orphanKey(slot, orphan), orphan); err != nil {
+				return err
+			}
+		}
+		prevIndexKeys, err := indexedKeys(txn, slot)
+		if err != nil {
+			return err
+		}
+		if err := writeIndexes(w, slot, prevIndexKeys, s.blockIndexKeys(slot, block, len(value))); err != nil {
+			return err
+		}
+		if err := txn.Delete(slotKey(keyDirty, slot)); err != nil {
+			return err
+		}
+		if block == nil && s.pruneEmpty {
+			return txn.Delete(key)
+		}
+		return w.Set(key, value)
+	})
+	if err != nil {
+		return err
+	}
+	s.broker.Publish(newBlockEvent(slot, block))
+	return nil
+}
+
+// SetBlocks sets many blocks in a single write batch, which is considerably
+// faster than calling SetBlock for each. The batch may be committed partially
+// on failure, but each slot is only marked as filled once its block is written.
+func (s *Store) SetBlocks(blocks map[phase0.Slot]*BlockWithRoot) error {
+	values := make(map[phase0.Slot][]byte, len(blocks))
+	for slot, block := range blocks {
+		value, err := encodeBlock(block, s.codec)
+		if err != nil {
+			return err
+		}
+		values[slot] = value
+	}
+	prevIndexKeys := make(map[phase0.Slot][][]byte, len(blocks))
+	orphans := make(map[phase0.Slot][]byte)
+	expiresAt := make(map[phase0.Slot]uint64, len(blocks))
+	var bitmaps *bitmapWriter
+	s.bitmapMu.Lock()
+	defer s.bitmapMu.Unlock()
+	err := s.db.View(func(txn *badger.Txn) error {
+		bitmaps = newBitmapWriter(txn, s.slotExpiry())
+		for slot, block := range blocks {
+			var err error
+			if expiresAt[slot], err = s.expiresAt(txn, slot); err != nil {
+				return err
+			}
+			if err := bitmaps.set(slot, stateOf(values[slot])); err != nil {
+				return err
 			}
+			orphan, err := s.replacedBlock(txn, slot, block)
 			if err != nil {
 				return err
 			}
-			blockBytes = snappy.Encode(nil, b)
+			if orphan != nil {
+				orphans[slot] = orphan
+			}
+			keys, err := indexedKeys(txn, slot)
+			if err != nil {
+				return err
+			}
+			prevIndexKeys[slot] = keys
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-		value := make([]byte, 0, len(versionBytes)+len(root)+len(blockBytes))
-		value = append(value, versionBytes[:]...)
-		value = append(value, root[:]...)
-		value = append(value, blockBytes[:]...)
+	defer func() {
+		for slot := range blocks {
+			s.evict(slot)
+		}
+	}()
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+	for slot, orphan := range orphans {
+		if err := withExpiry(wb, expiresAt[slot]).Set(orphanKey(slot, orphan), orphan); err != nil {
+			return err
+		}
+	}
+	for slot, value := range values {
+		w := withExpiry(wb, expiresAt[slot])
+		// Write the block before clearing the dirty marker, so that a partially
+		// committed batch never leaves a stale block marked as filled.
+		if blocks[slot] == nil && s.pruneEmpty {
+			if err := wb.Delete(slotKey(keySlot, slot)); err != nil {
+				return err
+			}
+		} else if err := w.Set(slotKey(keySlot, slot), value); err != nil {
+			return err
+		}
+		if err := writeIndexes(w, slot, prevIndexKeys[slot], s.blockIndexKeys(slot, blocks[slot], len(value))); err != nil {
+			return err
+		}
+		if err := wb.Delete(slotKey(keyDirty, slot)); err != nil {
+			return err
+		}
+	}
+	if err := bitmaps.write(wb); err != nil {
+		return err
+	}
+	if err := wb.Flush(); err != nil {
+		return err
+	}
+	events := make([]BlockEvent, 0, len(blocks))
+	for slot, block := range blocks {
+		events = append(events, newBlockEvent(slot, block))
+	}
+	s.broker.Publish(events...)
+	return nil
+}
 
-		return txn.Set(
-			append(keySlot, slotBytes[:]...),
-			value,
-		)
+// replacedBlock logs if the given block replaces a different stored block
+// (such as after a reorg), and returns the replaced block's stored value if
+// it should be kept as orphaned.
+func (s *Store) replacedBlock(txn *badger.Txn, slot phase0.Slot, block *BlockWithRoot) (orphan []byte, err error) {
+	var root phase0.Root
+	if block != nil {
+		root = block.BlockRoot
+	}
+	item, err := txn.Get(slotKey(keySlot, slot))
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = item.Value(func(val []byte) error {
+		if len(val) < 40 {
+			// A corrupt record, being repaired; see Verify.
+			return nil
+		}
+		var prevRoot phase0.Root
+		copy(prevRoot[:], val[8:40])
+		if prevRoot == root {
+			return nil
+		}
+		componentLogger("store", s.network).Info().Uint64("slot", uint64(slot)).Str("prev_root", fmt.Sprintf("%#x", prevRoot)).Str("root", fmt.Sprintf("%#x", root)).Msg("block root changed")
+		if _, _, ok := readHeader(val); ok && s.keepOrphans {
+			orphan = append([]byte(nil), val...)
+		}
+		return nil
 	})
+	return orphan, err
 }
 
-// Purge removes all slots within the given range (inclusive).
-func (s *Store) Purge(from, to phase0.Slot) (deleted int, err error) {
-	err = s.db.Update(func(txn *badger.Txn) error {
-		var fromBytes [8]byte
-		binary.BigEndian.PutUint64(fromBytes[:], uint64(from))
+// encodeBlock encodes a block (or nil for an empty slot) into a stored value,
+// compressed with the given codec.
+func encodeBlock(block *BlockWithRoot, codec Codec) ([]byte, error) {
+	// Refuse unknown forks up front, rather than writing a header for them.
+	if block != nil {
+		if err := checkFork(block.Version); err != nil {
+			return nil, err
+		}
+	}
 
-		it := txn.NewIterator(badger.DefaultIteratorOptions)
-		defer it.Close()
+	var versionBytes [recordHeaderSize]byte
+	if block == nil {
+		binary.BigEndian.PutUint64(versionBytes[:], math.MaxInt)
+	} else {
+		header := uint64(codec)<<56 | forkNumber(block.Version)
+		if block.Blinded {
+			header |= recordBlinded
+		}
+		binary.BigEndian.PutUint64(versionBytes[:], header)
+	}
+
+	var root phase0.Root
+	if block != nil {
+		root = block.BlockRoot
+	}
+
+	var blockBytes []byte
+	if block != nil {
+		b, err := marshalBlock(block.VersionedSignedBeaconBlock)
+		if err != nil {
+			return nil, err
+		}
+		blockBytes, err = codec.Encode(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	value := make([]byte, 0, len(versionBytes)+len(root)+len(blockBytes))
+	value = append(value, versionBytes[:]...)
+	value = append(value, root[:]...)
+	value = append(value, blockBytes[:]...)
+	return value, nil
+}
+
+// recordBlinded is set in the header of blocks reconstructed from their
+// blinded blocks, below the codec and above the version.
+const recordBlinded = 1 << 48
+
+// readHeader reads the version and codec of a stored value.
+// ok is false if the slot has no block.
+func readHeader(val []byte) (version spec.DataVersion, codec Codec, ok bool) {
+	header := binary.BigEndian.Uint64(val[:recordHeaderSize])
+	if header == math.MaxInt {
+		return 0, 0, false
+	}
+	return forkOfNumber(header & (recordBlinded - 1)), Codec(header >> 56), true
+}
+
+// checkRecord returns a corruptRecordError if the stored value is too short
+// for its header or, unless the slot is empty, for its root, so that it can be
+// read without slicing out of range.
+func checkRecord(val []byte) error {
+	if len(val) < recordHeaderSize {
+		return corruptRecordError{errors.New("truncated header")}
+	}
+	if _, _, ok := readHeader(val); ok && len(val) < recordHeaderSize+recordRootSize {
+		return corruptRecordError{errors.New("truncated root")}
+	}
+	return nil
+}
+
+// isBlindedRecord returns whether the stored value is of a block
+// reconstructed from its blinded block.
+func isBlindedRecord(val []byte) bool {
+	header := binary.BigEndian.Uint64(val[:recordHeaderSize])
+	return header != math.MaxInt && header&recordBlinded != 0
+}
+
+// MissingSlots returns the slots within the given range (inclusive) which were
+// scraped but had no block (empty), and the slots which weren't scraped at all.
+func (s *Store) MissingSlots(from, to phase0.Slot) (empty, unscraped []phase0.Slot, err error) {
+	empty, unscraped = []phase0.Slot{}, []phase0.Slot{}
+	states, err := s.SlotStates(from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, state := range states {
+		switch state {
+		case slotEmpty:
+			empty = append(empty, from+phase0.Slot(i))
+		case slotUnscraped:
+			unscraped = append(unscraped, from+phase0.Slot(i))
+		}
+	}
+	return empty, unscraped, nil
+}
+
+// How many slots Purge deletes in each transaction, so that purging a long
+// range doesn't exceed badger's transaction limits.
+const purgeBatchSlots = 1024
+
+// Purge removes all slots within the given range (inclusive). It's used by
+// purgeOutdated to enforce the retention window, so slots purged after a
+// config change are scraped again if they're brought back into range. Slots
+// are deleted in batches of purgeBatchSlots, each committed on its own, so
+// an error may leave the range partly purged.
+func (s *Store) Purge(from, to phase0.Slot) (deleted int, err error) {
+	s.bitmapMu.Lock()
+	defer s.bitmapMu.Unlock()
+	for {
+		n, last, err := s.purgeBatch(from, to)
+		deleted += n
+		if err != nil || last == to {
+			return deleted, err
+		}
+		from = last + 1
+	}
+}
 
-		fromKey := append(keySlot, fromBytes[:]...)
-		for it.Seek(fromKey); it.ValidForPrefix(keySlot); it.Next() {
-			key := it.Item().KeyCopy(nil)
-			slot := phase0.Slot(binary.BigEndian.Uint64(key[len(keySlot):]))
+// purgeBatch removes up to purgeBatchSlots slots from the given range
+// (inclusive) in one transaction, from its start up to last.
+func (s *Store) purgeBatch(from, to phase0.Slot) (deleted int, last phase0.Slot, err error) {
+	err = s.db.Update(func(txn *badger.Txn) error {
+		// Find the batch's slots, and so where it ends.
+		last = to
+		var slots []phase0.Slot
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = keySlot
+		it := txn.NewIterator(opts)
+		for it.Seek(slotKey(keySlot, from)); it.Valid(); it.Next() {
+			slot := phase0.Slot(binary.BigEndian.Uint64(it.Item().Key()[len(keySlot):]))
 			if slot > to {
 				break
 			}
-			if err := txn.Delete(key); err != nil {
+			slots = append(slots, slot)
+			if len(slots) == purgeBatchSlots {
+				last = slot
+				break
+			}
+		}
+		it.Close()
+		pruned, err := s.prunedEmptySlots(txn, from, last)
+		if err != nil {
+			return err
+		}
+		if len(pruned) > purgeBatchSlots {
+			last = pruned[purgeBatchSlots-1]
+			pruned = pruned[:purgeBatchSlots]
+			for len(slots) > 0 && slots[len(slots)-1] > last {
+				slots = slots[:len(slots)-1]
+			}
+		}
+
+		bitmaps := newBitmapWriter(txn, s.slotExpiry())
+		for _, slot := range slots {
+			if pinned, err := isPinned(txn, slot); err != nil {
+				return err
+			} else if pinned {
+				continue
+			}
+			if err := txn.Delete(slotKey(keySlot, slot)); err != nil {
 				return err
 			}
+			if err := txn.Delete(slotKey(keyDirty, slot)); err != nil {
+				return err
+			}
+			prevIndexKeys, err := indexedKeys(txn, slot)
+			if err != nil {
+				return err
+			}
+			if err := writeIndexes(txn, slot, prevIndexKeys, nil); err != nil {
+				return err
+			}
+			if err := bitmaps.set(slot, slotUnscraped); err != nil {
+				return err
+			}
+			s.evict(slot)
 			deleted++
 		}
-		return nil
+		for _, slot := range pruned {
+			if pinned, err := isPinned(txn, slot); err != nil {
+				return err
+			} else if pinned {
+				continue
+			}
+			if err := txn.Delete(slotKey(keyDirty, slot)); err != nil {
+				return err
+			}
+			if err := bitmaps.set(slot, slotUnscraped); err != nil {
+				return err
+			}
+			deleted++
+		}
+		if err := bitmaps.write(txn); err != nil {
+			return err
+		}
+		if err := purgeAnnotations(txn, from, last); err != nil {
+			return err
+		}
+		return purgeOrphans(txn, from, last)
 	})
-	return
+	if err != nil {
+		return 0, 0, err
+	}
+	return deleted, last, nil
 }
 
+// evict removes the slot from the caches.
+func (s *Store) evict(slot phase0.Slot) {
+	s.cache.Remove(s.network, slot)
+	s.summaryCache.Remove(s.network, slot)
+	s.participationCache.Remove(s.network, slot)
+}
+
+// goTask runs fn in the background with a context which is done when the
+// store is closed. Close waits for fn to return before closing the database,
+// so fn may keep using the store until then.
+func (s *Store) goTask(fn func(ctx context.Context)) {
+	s.tasks.Add(1)
+	go func() {
+		defer s.tasks.Done()
+		fn(s.ctx)
+	}()
+}
+
+// Done returns a channel which is closed when the store is closed.
+func (s *Store) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// Close stops the store's tasks, waiting for them to return, and then closes
+// its database. It may be called more than once, and on a store which wasn't
+// opened by OpenStore (and so has no tasks), such as &Store{db: db}.
 func (s *Store) Close() error {
-	s.cancel()
-	return s.db.Close()
+	s.closeOnce.Do(func() {
+		if s.cancel != nil {
+			s.cancel()
+		}
+		s.tasks.Wait()
+		s.closeErr = s.db.Close()
+	})
+	return s.closeErr
 }
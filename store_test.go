@@ -1,26 +1,29 @@
 package main
 
 import (
+	"context"
+	"encoding/hex"
+	"math"
 	"math/rand"
 	"testing"
+	"time"
 
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/altair"
+	"github.com/attestantio/go-eth2-client/spec/bellatrix"
 	"github.com/attestantio/go-eth2-client/spec/phase0"
 	"github.com/dgraph-io/badger/v3"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
 )
 
 func TestPurge(t *testing.T) {
-	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true))
-	require.NoError(t, err)
-
-	store := &Store{db: db}
-	defer store.Close()
+	store := newTestStore(t)
 
 	// Set 5 slots.
 	const filledSlots = 5
 	for _, i := range rand.Perm(filledSlots) {
-		err = store.SetBlock(phase0.Slot(i), nil)
-		require.NoError(t, err)
+		require.NoError(t, store.SetBlock(phase0.Slot(i), nil))
 	}
 
 	// Purge 3 slots.
@@ -38,3 +41,823 @@ func TestPurge(t *testing.T) {
 		}
 	}
 }
+
+func TestPurgeBatches(t *testing.T) {
+	store := newTestStore(t)
+
+	// Purge more slots than fit in one batch, with some pinned.
+	const filledSlots = 2*purgeBatchSlots + 10
+	blocks := make(map[phase0.Slot]*BlockWithRoot, filledSlots)
+	for slot := phase0.Slot(0); slot < filledSlots; slot++ {
+		blocks[slot] = nil
+	}
+	require.NoError(t, store.SetBlocks(blocks))
+	require.NoError(t, store.Pin(purgeBatchSlots))
+	deleted, err := store.Purge(0, math.MaxUint64)
+	require.NoError(t, err)
+	require.Equal(t, filledSlots-1, deleted)
+
+	slots, _, err := store.Count()
+	require.NoError(t, err)
+	require.Equal(t, 1, slots)
+}
+
+func TestPurgeOutdated(t *testing.T) {
+	store := newTestStore(t)
+	for slot := phase0.Slot(85); slot < 95; slot++ {
+		require.NoError(t, store.SetBlock(slot, testBlock(slot)))
+	}
+
+	// The current slot is 100, so only slots from 90 are retained.
+	networkSpec := &NetworkSpec{
+		GenesisTime:    time.Now().Add(-100*12*time.Second - 6*time.Second),
+		SecondsPerSlot: 12,
+		SlotsPerEpoch:  32,
+	}
+	network := NetworkConfig{ScrapeSlots: 10, RetentionSlots: 10}
+	deleted, err := purgeOutdated(store, network, networkSpec)
+	require.NoError(t, err)
+	require.Equal(t, 5, deleted)
+
+	empty, unscraped, err := store.MissingSlots(85, 94)
+	require.NoError(t, err)
+	require.Empty(t, empty)
+	require.Equal(t, []phase0.Slot{85, 86, 87, 88, 89}, unscraped)
+
+	// Nothing is purged while the chain is younger than the retention window.
+	network.RetentionSlots = 1000
+	deleted, err = purgeOutdated(store, network, networkSpec)
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+}
+
+func TestMissingSlots(t *testing.T) {
+	store := newTestStore(t)
+
+	// Slots 1 and 4 have blocks, 2 and 5 are empty, 0 and 3 aren't scraped.
+	for _, slot := range []phase0.Slot{1, 4} {
+		err := store.SetBlock(slot, testBlock(slot))
+		require.NoError(t, err)
+	}
+	for _, slot := range []phase0.Slot{2, 5} {
+		err := store.SetBlock(slot, nil)
+		require.NoError(t, err)
+	}
+
+	empty, unscraped, err := store.MissingSlots(0, 6)
+	require.NoError(t, err)
+	require.Equal(t, []phase0.Slot{2, 5}, empty)
+	require.Equal(t, []phase0.Slot{0, 3, 6}, unscraped)
+
+	empty, unscraped, err = store.MissingSlots(3, 4)
+	require.NoError(t, err)
+	require.Empty(t, empty)
+	require.Equal(t, []phase0.Slot{3}, unscraped)
+}
+
+func TestFirstUnfilledSlot(t *testing.T) {
+	store := newTestStore(t)
+
+	// Slots 2 to 6 and 8 are filled, but 5 is invalidated.
+	for slot := phase0.Slot(2); slot <= 8; slot++ {
+		if slot != 7 {
+			require.NoError(t, store.SetBlock(slot, nil))
+		}
+	}
+	_, err := store.Invalidate(5, 5)
+	require.NoError(t, err)
+
+	for from, expected := range map[phase0.Slot]phase0.Slot{0: 0, 2: 5, 4: 5, 5: 5, 6: 7, 8: 9} {
+		next, err := store.FirstUnfilledSlot(from)
+		require.NoError(t, err)
+		require.Equal(t, expected, next, "from %d", from)
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	store := newTestStore(t)
+
+	// Slots 1 and 4 have blocks, 2 is empty, 3 isn't scraped,
+	// and 0 and 6 are outside the range.
+	for _, slot := range []phase0.Slot{0, 1, 4, 6} {
+		err := store.SetBlock(slot, testBlock(slot))
+		require.NoError(t, err)
+	}
+	err := store.SetBlock(2, nil)
+	require.NoError(t, err)
+
+	blocks, err := store.Blocks(1, 5)
+	require.NoError(t, err)
+	require.Len(t, blocks, 3)
+	require.Nil(t, blocks[2])
+	for _, slot := range []phase0.Slot{1, 4} {
+		require.NotNil(t, blocks[slot])
+		require.Equal(t, slot, blocks[slot].Phase0.Message.Slot)
+	}
+}
+
+func TestForEachBlock(t *testing.T) {
+	store := newTestStore(t)
+
+	// Slots 1 and 2 have phase0 blocks, 3 has a bellatrix block and 4 is empty.
+	for _, slot := range []phase0.Slot{1, 2} {
+		require.NoError(t, store.SetBlock(slot, testBlock(slot)))
+	}
+	require.NoError(t, store.SetBlock(3, testBellatrixBlock(3, phase0.Hash32{1})))
+	require.NoError(t, store.SetBlock(4, nil))
+
+	collect := func(versions []spec.DataVersion, stopAt phase0.Slot) []phase0.Slot {
+		slots := []phase0.Slot{}
+		err := store.ForEachBlock(0, 10, versions, func(slot phase0.Slot, block *BlockWithRoot) error {
+			require.NotNil(t, block)
+			slots = append(slots, slot)
+			if slot == stopAt {
+				return errStopIteration
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		return slots
+	}
+	require.Equal(t, []phase0.Slot{1, 2, 3}, collect(nil, 0))
+	require.Equal(t, []phase0.Slot{3}, collect([]spec.DataVersion{spec.DataVersionBellatrix}, 0))
+	require.Equal(t, []phase0.Slot{1, 2}, collect([]spec.DataVersion{spec.DataVersionPhase0}, 0))
+	require.Equal(t, []phase0.Slot{1, 2}, collect(nil, 2))
+}
+
+func TestSpec(t *testing.T) {
+	store := newTestStore(t)
+
+	networkSpec, err := store.Spec()
+	require.NoError(t, err)
+	require.Nil(t, networkSpec)
+
+	want := &NetworkSpec{
+		ConfigName:     "mainnet",
+		GenesisTime:    time.Unix(1606824023, 0).UTC(),
+		SecondsPerSlot: 12,
+		SlotsPerEpoch:  32,
+	}
+	require.NoError(t, store.SetSpec(want))
+
+	// The spec survives purging all slots.
+	_, err = store.Purge(0, math.MaxUint64)
+	require.NoError(t, err)
+
+	networkSpec, err = store.Spec()
+	require.NoError(t, err)
+	require.Equal(t, want, networkSpec)
+	require.Equal(t, 12*time.Second, networkSpec.SlotDuration())
+}
+
+func TestLowestFilledSlot(t *testing.T) {
+	store := newTestStore(t)
+
+	_, ok, err := store.LowestFilledSlot()
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, store.SetBlock(3, testBlock(3)))
+	require.NoError(t, store.SetBlock(5, nil))
+
+	slot, ok, err := store.LowestFilledSlot()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, phase0.Slot(3), slot)
+
+	// Invalidated slots aren't filled.
+	_, err = store.Invalidate(3, 3)
+	require.NoError(t, err)
+	slot, ok, err = store.LowestFilledSlot()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, phase0.Slot(5), slot)
+}
+
+func TestHighestFilledSlot(t *testing.T) {
+	store := newTestStore(t)
+
+	_, ok, err := store.HighestFilledSlot()
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, store.SetBlock(3, testBlock(3)))
+	require.NoError(t, store.SetBlock(5, nil))
+	require.NoError(t, store.SetBlock(7, testBlock(7)))
+
+	slot, ok, err := store.HighestFilledSlot()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, phase0.Slot(7), slot)
+
+	// Invalidated slots aren't filled.
+	_, err = store.Invalidate(6, 7)
+	require.NoError(t, err)
+	slot, ok, err = store.HighestFilledSlot()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, phase0.Slot(5), slot)
+}
+
+func TestStats(t *testing.T) {
+	store := newTestStore(t)
+
+	block := testBellatrixBlock(1, phase0.Hash32{1})
+	block.BlockRoot = phase0.Root{1}
+	require.NoError(t, store.SetBlock(1, block))
+	require.NoError(t, store.SetBlock(2, testBlock(2)))
+	require.NoError(t, store.SetBlock(3, nil))
+	_, err := store.Invalidate(2, 2)
+	require.NoError(t, err)
+
+	stats, err := store.Stats()
+	require.NoError(t, err)
+	require.Equal(t, 3, stats.Slots)
+	require.Equal(t, 2, stats.Blocks)
+	require.Equal(t, 1, stats.Empty)
+	require.Equal(t, 1, stats.Dirty)
+	require.Equal(t, map[string]int{"block_root": 1, "execution_hash": 1, "proposer": 2}, stats.Indexes)
+}
+
+func TestLatestBlock(t *testing.T) {
+	store := newTestStore(t)
+
+	_, _, err := store.LatestBlock()
+	require.ErrorIs(t, err, badger.ErrKeyNotFound)
+
+	// Slot 5 is empty and 6 is invalidated, so the latest block is at 4.
+	require.NoError(t, store.SetBlock(3, testBlock(3)))
+	require.NoError(t, store.SetBlock(4, testBlock(4)))
+	require.NoError(t, store.SetBlock(5, nil))
+	require.NoError(t, store.SetBlock(6, testBlock(6)))
+	_, err = store.Invalidate(6, 6)
+	require.NoError(t, err)
+
+	slot, block, err := store.LatestBlock()
+	require.NoError(t, err)
+	require.Equal(t, phase0.Slot(4), slot)
+	require.Equal(t, phase0.Slot(4), block.Phase0.Message.Slot)
+}
+
+func TestFinalized(t *testing.T) {
+	store := newTestStore(t)
+
+	checkpoint, err := store.Finalized()
+	require.NoError(t, err)
+	require.Nil(t, checkpoint)
+
+	require.NoError(t, store.SetFinalized(&phase0.Checkpoint{Epoch: 10, Root: phase0.Root{1}}))
+	require.NoError(t, store.SetFinalized(&phase0.Checkpoint{Epoch: 11, Root: phase0.Root{2}}))
+
+	// An older checkpoint doesn't replace a newer one.
+	require.NoError(t, store.SetFinalized(&phase0.Checkpoint{Epoch: 9, Root: phase0.Root{3}}))
+
+	checkpoint, err = store.Finalized()
+	require.NoError(t, err)
+	require.Equal(t, &phase0.Checkpoint{Epoch: 11, Root: phase0.Root{2}}, checkpoint)
+
+	// It's read back from disk when reopened.
+	reopened := &Store{db: store.db}
+	checkpoint, err = reopened.Finalized()
+	require.NoError(t, err)
+	require.Equal(t, &phase0.Checkpoint{Epoch: 11, Root: phase0.Root{2}}, checkpoint)
+
+	// The finalized slot is the first of the epoch.
+	slot, ok, err := store.FinalizedSlot()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, phase0.Slot(11*defaultSlotsPerEpoch), slot)
+}
+
+func TestHeadSlot(t *testing.T) {
+	store := newTestStore(t)
+
+	_, ok, err := store.HeadSlot()
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, store.SetHeadSlot(10))
+	// The head may go back after a reorg.
+	require.NoError(t, store.SetHeadSlot(9))
+
+	// It's read back from disk when reopened.
+	reopened := &Store{db: store.db}
+	slot, ok, err := reopened.HeadSlot()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, phase0.Slot(9), slot)
+}
+
+func TestBlockHeader(t *testing.T) {
+	store := newTestStore(t)
+	block := testBellatrixBlock(1, phase0.Hash32{1})
+	block.BlockRoot = phase0.Root{1, 2, 3}
+	require.NoError(t, store.SetBlock(1, block))
+	require.NoError(t, store.SetBlock(2, nil))
+
+	header, ok, err := store.BlockHeader(1)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, BlockHeader{Version: spec.DataVersionBellatrix, Root: block.BlockRoot}, header)
+
+	_, ok, err = store.BlockHeader(2)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, _, err = store.BlockHeader(3)
+	require.ErrorIs(t, err, badger.ErrKeyNotFound)
+}
+
+func TestOrphanedBlocks(t *testing.T) {
+	store := newTestStore(t)
+
+	block := func(root byte) *BlockWithRoot {
+		block := testBlock(1)
+		block.BlockRoot = phase0.Root{root}
+		return block
+	}
+	require.NoError(t, store.SetBlock(1, block(1)))
+
+	// Replaced blocks aren't kept unless enabled.
+	require.NoError(t, store.SetBlock(1, block(2)))
+	orphans, err := store.OrphanedBlocks(1)
+	require.NoError(t, err)
+	require.Empty(t, orphans)
+
+	store.keepOrphans = true
+	require.NoError(t, store.SetBlock(1, block(2)))
+	require.NoError(t, store.SetBlock(1, block(3)))
+	require.NoError(t, store.SetBlocks(map[phase0.Slot]*BlockWithRoot{1: nil}))
+	require.NoError(t, store.SetBlocks(map[phase0.Slot]*BlockWithRoot{1: block(4)}))
+	orphans, err = store.OrphanedBlocks(1)
+	require.NoError(t, err)
+	require.Len(t, orphans, 2)
+	require.Equal(t, phase0.Root{2}, orphans[0].BlockRoot)
+	require.Equal(t, phase0.Root{3}, orphans[1].BlockRoot)
+
+	// Orphans are purged along with their slot.
+	_, err = store.Purge(0, 1)
+	require.NoError(t, err)
+	orphans, err = store.OrphanedBlocks(1)
+	require.NoError(t, err)
+	require.Empty(t, orphans)
+}
+
+func TestInvalidate(t *testing.T) {
+	store := newTestStore(t)
+
+	for slot := phase0.Slot(0); slot < 3; slot++ {
+		err := store.SetBlock(slot, testBlock(slot))
+		require.NoError(t, err)
+	}
+
+	// Invalidate slots 1-4, of which only 1 and 2 were scraped.
+	invalidated, err := store.Invalidate(1, 4)
+	require.NoError(t, err)
+	require.Equal(t, []phase0.Slot{1, 2}, invalidated)
+
+	for slot := phase0.Slot(0); slot < 3; slot++ {
+		filled, err := store.Filled(slot)
+		require.NoError(t, err)
+		require.Equal(t, slot == 0, filled)
+
+		// Invalidated blocks remain readable.
+		block, err := store.Block(slot)
+		require.NoError(t, err)
+		require.Equal(t, slot, block.Phase0.Message.Slot)
+	}
+
+	// Setting the block again marks it as filled.
+	err = store.SetBlock(1, nil)
+	require.NoError(t, err)
+	filled, err := store.Filled(1)
+	require.NoError(t, err)
+	require.True(t, filled)
+}
+
+func TestSetBlockUnsupportedFork(t *testing.T) {
+	store := newTestStore(t)
+
+	block := testBlock(1)
+	block.Version = spec.DataVersion(99)
+	err := store.SetBlock(1, block)
+	require.EqualError(t, err, "unsupported fork version 99")
+	err = store.SetBlocks(map[phase0.Slot]*BlockWithRoot{1: block})
+	require.EqualError(t, err, "unsupported fork version 99")
+
+	// Nothing should have been written.
+	filled, err := store.Filled(1)
+	require.NoError(t, err)
+	require.False(t, filled)
+}
+
+func TestSetBlocks(t *testing.T) {
+	store := newTestStore(t)
+
+	// Invalidate a previously set slot, which SetBlocks should mark as filled again.
+	err := store.SetBlock(1, nil)
+	require.NoError(t, err)
+	_, err = store.Invalidate(1, 1)
+	require.NoError(t, err)
+
+	blocks := map[phase0.Slot]*BlockWithRoot{
+		0: testBlock(0),
+		1: testBlock(1),
+		2: nil,
+	}
+	err = store.SetBlocks(blocks)
+	require.NoError(t, err)
+
+	for slot, expected := range blocks {
+		filled, err := store.Filled(slot)
+		require.NoError(t, err)
+		require.True(t, filled)
+
+		block, err := store.Block(slot)
+		require.NoError(t, err)
+		if expected == nil {
+			require.Nil(t, block)
+		} else {
+			require.Equal(t, slot, block.Phase0.Message.Slot)
+		}
+	}
+}
+
+func TestBlockSSZ(t *testing.T) {
+	store := newTestStore(t)
+
+	block := testBlock(1)
+	require.NoError(t, store.SetBlock(1, block))
+	require.NoError(t, store.SetBlock(2, nil))
+
+	blockBytes, version, err := store.BlockSSZ(1)
+	require.NoError(t, err)
+	require.Equal(t, spec.DataVersionPhase0, version)
+	expected, err := block.Phase0.MarshalSSZ()
+	require.NoError(t, err)
+	require.Equal(t, expected, blockBytes)
+
+	blockBytes, _, err = store.BlockSSZ(2)
+	require.NoError(t, err)
+	require.Nil(t, blockBytes)
+
+	_, _, err = store.BlockSSZ(3)
+	require.ErrorIs(t, err, badger.ErrKeyNotFound)
+}
+
+func TestCodecs(t *testing.T) {
+	store := newTestStore(t)
+
+	// Switching codecs leaves blocks written with the previous codec readable.
+	require.NoError(t, store.SetBlock(1, testBlock(1)))
+	store.codec = CodecZstd
+	require.NoError(t, store.SetBlock(2, testBlock(2)))
+	require.NoError(t, store.SetBlock(3, nil))
+
+	for slot := phase0.Slot(1); slot <= 2; slot++ {
+		block, err := store.Block(slot)
+		require.NoError(t, err)
+		require.Equal(t, spec.DataVersionPhase0, block.Version)
+		require.Equal(t, slot, block.Phase0.Message.Slot)
+
+		blockBytes, version, err := store.BlockSSZ(slot)
+		require.NoError(t, err)
+		require.Equal(t, spec.DataVersionPhase0, version)
+		expected, err := testBlock(slot).Phase0.MarshalSSZ()
+		require.NoError(t, err)
+		require.Equal(t, expected, blockBytes)
+	}
+	block, err := store.Block(3)
+	require.NoError(t, err)
+	require.Nil(t, block)
+
+	slots, blocks, err := store.Count()
+	require.NoError(t, err)
+	require.Equal(t, 3, slots)
+	require.Equal(t, 2, blocks)
+
+	// The cached counts agree, and stay cached as slots are written.
+	slots, blocks, err = store.CachedCount()
+	require.NoError(t, err)
+	require.Equal(t, 3, slots)
+	require.Equal(t, 2, blocks)
+	require.NoError(t, store.SetBlock(4, nil))
+	slots, blocks, err = store.CachedCount()
+	require.NoError(t, err)
+	require.Equal(t, 3, slots)
+	require.Equal(t, 2, blocks)
+}
+
+func TestCachedCountEmptySlots(t *testing.T) {
+	store := newTestStore(t)
+	val, err := encodeBlock(nil, store.codec)
+	require.NoError(t, err)
+	require.Len(t, val, emptyRecordSize)
+
+	require.NoError(t, store.SetBlock(1, nil))
+	require.NoError(t, store.SetBlock(2, testBlock(2)))
+	require.NoError(t, store.SetBlock(3, nil))
+	slots, blocks, err := store.CachedCount()
+	require.NoError(t, err)
+	require.Equal(t, 3, slots)
+	require.Equal(t, 1, blocks)
+}
+
+func TestBlockRoot(t *testing.T) {
+	store := newTestStore(t)
+
+	// The mainnet genesis block.
+	block := testBlock(0)
+	stateRoot, err := hex.DecodeString("7e76880eb67bbdc86250aa578958e9d0675e64e714337855204fb5abaaf82c2b")
+	require.NoError(t, err)
+	copy(block.Phase0.Message.StateRoot[:], stateRoot)
+	block.BlockRoot, err = block.Root()
+	require.NoError(t, err)
+	require.Equal(t, "4d611d5b93fdab69013a7f0a2f961caca0c853f87cfe9595fe50038163079360", hex.EncodeToString(block.BlockRoot[:]))
+
+	require.NoError(t, store.SetBlock(0, block))
+	stored, err := store.Block(0)
+	require.NoError(t, err)
+	require.Equal(t, block.BlockRoot, stored.BlockRoot)
+
+	slot, stored, err := store.BlockByRoot(block.BlockRoot)
+	require.NoError(t, err)
+	require.Equal(t, phase0.Slot(0), slot)
+	require.Equal(t, block.BlockRoot, stored.BlockRoot)
+
+	// Overwriting the slot removes its previous root from the index.
+	other := testBlock(0)
+	other.BlockRoot = phase0.Root{1}
+	require.NoError(t, store.SetBlock(0, other))
+	_, _, err = store.BlockByRoot(block.BlockRoot)
+	require.ErrorIs(t, err, badger.ErrKeyNotFound)
+	_, _, err = store.BlockByRoot(other.BlockRoot)
+	require.NoError(t, err)
+}
+
+func TestUnsupportedVersion(t *testing.T) {
+	store := newTestStore(t)
+
+	// Forks the client library doesn't know are refused rather than stored empty.
+	block := testBlock(1)
+	block.Version = spec.DataVersionElectra + 1
+	require.Error(t, store.SetBlock(1, block))
+	_, err := store.Block(1)
+	require.ErrorIs(t, err, badger.ErrKeyNotFound)
+}
+
+func TestBlockByExecutionHash(t *testing.T) {
+	store := newTestStore(t)
+
+	hash := phase0.Hash32{1}
+	require.NoError(t, store.SetBlock(5, testBellatrixBlock(5, hash)))
+
+	slot, block, err := store.BlockByExecutionHash(hash[:])
+	require.NoError(t, err)
+	require.Equal(t, phase0.Slot(5), slot)
+	require.Equal(t, hash, block.Bellatrix.Message.Body.ExecutionPayload.BlockHash)
+
+	// Overwriting the slot (such as in a reorg) replaces the index entry.
+	otherHash := phase0.Hash32{2}
+	require.NoError(t, store.SetBlocks(map[phase0.Slot]*BlockWithRoot{5: testBellatrixBlock(5, otherHash)}))
+	_, _, err = store.BlockByExecutionHash(hash[:])
+	require.ErrorIs(t, err, badger.ErrKeyNotFound)
+	slot, _, err = store.BlockByExecutionHash(otherHash[:])
+	require.NoError(t, err)
+	require.Equal(t, phase0.Slot(5), slot)
+
+	// Purging the slot removes the index entry.
+	_, err = store.Purge(5, 5)
+	require.NoError(t, err)
+	_, _, err = store.BlockByExecutionHash(otherHash[:])
+	require.ErrorIs(t, err, badger.ErrKeyNotFound)
+}
+
+func TestProposerSlots(t *testing.T) {
+	store := newTestStore(t)
+
+	proposed := func(slot phase0.Slot, index phase0.ValidatorIndex) *BlockWithRoot {
+		block := testBlock(slot)
+		block.Phase0.Message.ProposerIndex = index
+		return block
+	}
+	require.NoError(t, store.SetBlock(1, proposed(1, 7)))
+	require.NoError(t, store.SetBlock(2, proposed(2, 8)))
+	require.NoError(t, store.SetBlocks(map[phase0.Slot]*BlockWithRoot{
+		3: nil,
+		4: proposed(4, 7),
+		5: proposed(5, 7),
+	}))
+
+	slots, err := store.ProposerSlots(7, 0, math.MaxUint64)
+	require.NoError(t, err)
+	require.Equal(t, []phase0.Slot{1, 4, 5}, slots)
+	slots, err = store.ProposerSlots(7, 2, 4)
+	require.NoError(t, err)
+	require.Equal(t, []phase0.Slot{4}, slots)
+
+	// Overwriting or purging a slot removes it from the index.
+	require.NoError(t, store.SetBlock(4, proposed(4, 8)))
+	_, err = store.Purge(5, 5)
+	require.NoError(t, err)
+	slots, err = store.ProposerSlots(7, 0, math.MaxUint64)
+	require.NoError(t, err)
+	require.Equal(t, []phase0.Slot{1}, slots)
+	slots, err = store.ProposerSlots(8, 0, math.MaxUint64)
+	require.NoError(t, err)
+	require.Equal(t, []phase0.Slot{2, 4}, slots)
+}
+
+func BenchmarkSetBlock(b *testing.B) {
+	store := newTestStore(b)
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < scrapeBatchSize; j++ {
+			slot := phase0.Slot(i*scrapeBatchSize + j)
+			err := store.SetBlock(slot, testBlock(slot))
+			require.NoError(b, err)
+		}
+	}
+}
+
+func BenchmarkSetBlocks(b *testing.B) {
+	store := newTestStore(b)
+	for i := 0; i < b.N; i++ {
+		blocks := make(map[phase0.Slot]*BlockWithRoot, scrapeBatchSize)
+		for j := 0; j < scrapeBatchSize; j++ {
+			slot := phase0.Slot(i*scrapeBatchSize + j)
+			blocks[slot] = testBlock(slot)
+		}
+		err := store.SetBlocks(blocks)
+		require.NoError(b, err)
+	}
+}
+
+// BenchmarkStartup compares skipping the stored slots at scrape startup by
+// checking each against jumping to the first unfilled one.
+func BenchmarkStartup(b *testing.B) {
+	const slots = 10000
+	store := newTestStore(b)
+	for i := phase0.Slot(0); i < slots; i += scrapeBatchSize {
+		blocks := make(map[phase0.Slot]*BlockWithRoot, scrapeBatchSize)
+		for slot := i; slot < i+scrapeBatchSize; slot++ {
+			blocks[slot] = nil
+		}
+		require.NoError(b, store.SetBlocks(blocks))
+	}
+	b.Run("Filled", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			slot := phase0.Slot(0)
+			for ; ; slot++ {
+				filled, err := store.Filled(slot)
+				require.NoError(b, err)
+				if !filled {
+					break
+				}
+			}
+			require.GreaterOrEqual(b, slot, phase0.Slot(slots))
+		}
+	})
+	b.Run("FirstUnfilledSlot", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			slot, err := store.FirstUnfilledSlot(0)
+			require.NoError(b, err)
+			require.GreaterOrEqual(b, slot, phase0.Slot(slots))
+		}
+	})
+}
+
+// BenchmarkCodecs reports the stored size and read latency of a block
+// with transactions under each codec.
+func BenchmarkCodecs(b *testing.B) {
+	block := testBellatrixBlock(1, phase0.Hash32{1})
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		// Transactions are mostly calldata, which is part random and part zeros.
+		tx := make([]byte, 512)
+		r.Read(tx[:128])
+		block.Bellatrix.Message.Body.ExecutionPayload.Transactions = append(
+			block.Bellatrix.Message.Body.ExecutionPayload.Transactions, tx,
+		)
+	}
+	for _, codec := range []Codec{CodecSnappy, CodecZstd} {
+		b.Run(codec.String(), func(b *testing.B) {
+			store := newTestStore(b)
+			store.codec = codec
+			require.NoError(b, store.SetBlock(1, block))
+			value, err := encodeBlock(block, codec)
+			require.NoError(b, err)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := store.Block(1)
+				require.NoError(b, err)
+			}
+			b.ReportMetric(float64(len(value)), "bytes/block")
+		})
+	}
+}
+
+func newTestStore(t testing.TB) *Store {
+	store, err := OpenStoreInMemory("test")
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func testBellatrixBlock(slot phase0.Slot, executionBlockHash phase0.Hash32) *BlockWithRoot {
+	return &BlockWithRoot{
+		VersionedSignedBeaconBlock: &spec.VersionedSignedBeaconBlock{
+			Version: spec.DataVersionBellatrix,
+			Bellatrix: &bellatrix.SignedBeaconBlock{
+				Message: &bellatrix.BeaconBlock{
+					Slot: slot,
+					Body: &bellatrix.BeaconBlockBody{
+						ETH1Data: &phase0.ETH1Data{BlockHash: make([]byte, 32)},
+						SyncAggregate: &altair.SyncAggregate{
+							SyncCommitteeBits: make([]byte, 64),
+						},
+						ExecutionPayload: &bellatrix.ExecutionPayload{
+							BlockHash: executionBlockHash,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func testBlock(slot phase0.Slot) *BlockWithRoot {
+	return &BlockWithRoot{
+		VersionedSignedBeaconBlock: &spec.VersionedSignedBeaconBlock{
+			Version: spec.DataVersionPhase0,
+			Phase0: &phase0.SignedBeaconBlock{
+				Message: &phase0.BeaconBlock{
+					Slot: slot,
+					Body: &phase0.BeaconBlockBody{
+						ETH1Data: &phase0.ETH1Data{BlockHash: make([]byte, 32)},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestCloseStopsTasks(t *testing.T) {
+	// Badger's goroutines, like the store's, stop when it's closed.
+	ignore := goleak.IgnoreCurrent()
+	store, err := OpenStore(t.TempDir(), "close")
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	var stopped bool
+	store.goTask(func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		// Close waits for tasks, which may still use the store.
+		time.Sleep(10 * time.Millisecond)
+		_, err := store.Filled(1)
+		stopped = err == nil
+	})
+	<-started
+
+	require.NoError(t, store.Close())
+	require.True(t, stopped)
+	select {
+	case <-store.Done():
+	default:
+		t.Fatal("store isn't done")
+	}
+	require.NoError(t, store.Close())
+	goleak.VerifyNone(t, ignore)
+}
+
+func TestOpenStoreInMemory(t *testing.T) {
+	store, err := OpenStoreInMemory("memory")
+	require.NoError(t, err)
+	require.NoError(t, store.SetBlock(1, testBlock(1)))
+	block, err := store.Block(1)
+	require.NoError(t, err)
+	require.Equal(t, phase0.Slot(1), block.Phase0.Message.Slot)
+
+	// There's no value log to collect.
+	_, err = store.RunGC(gcDiscardRatio)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Close())
+	select {
+	case <-store.Done():
+	default:
+		t.Fatal("store isn't done")
+	}
+}
+
+func TestCloseUnopenedStore(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	store := &Store{db: db}
+	require.NotPanics(t, func() {
+		require.NoError(t, store.Close())
+	})
+	require.True(t, db.IsClosed())
+	require.NoError(t, store.Close())
+}
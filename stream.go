@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo"
+)
+
+// How often to send a comment to idle streams, so that proxies keep them open.
+const streamKeepAlive = 15 * time.Second
+
+// streamHandler streams the network's newly stored slots as Server-Sent Events.
+// The stream ends if the client falls too far behind, and it should reconnect.
+func streamHandler(c echo.Context) error {
+	filter, err := parseEventFilter(c)
+	if err != nil {
+		return err
+	}
+	store, err := getStore(c.Param("network"))
+	if err != nil {
+		return err
+	}
+	sub := store.broker.Subscribe()
+	defer store.broker.Unsubscribe(sub)
+
+	c.Response().Header().Set(echo.HeaderContentType, "text/event-stream")
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	c.Response().WriteHeader(http.StatusOK)
+	c.Response().Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			if !filter.matches(event) {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(c.Response(), "event: block\ndata: %s\n\n", data); err != nil {
+				return nil
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(c.Response(), ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+		case <-c.Request().Context().Done():
+			return nil
+		}
+		c.Response().Flush()
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// blockSummary is a compact projection of a block, for dashboards.
+type blockSummary struct {
+	Slot               phase0.Slot           `json:"slot"`
+	ProposerIndex      phase0.ValidatorIndex `json:"proposer_index"`
+	Root               string                `json:"root"`
+	ParentRoot         string                `json:"parent_root"`
+	Graffiti           string                `json:"graffiti"`
+	AttestationsCount  int                   `json:"attestations_count"`
+	DepositsCount      int                   `json:"deposits_count"`
+	ExecutionBlockHash string                `json:"execution_block_hash,omitempty"`
+}
+
+// SummaryCache is a SlotCache of block summaries.
+type SummaryCache = SlotCache[*blockSummary]
+
+// NewSummaryCache returns a cache holding up to size summaries, or nil if size is zero.
+func NewSummaryCache(size int) *SummaryCache {
+	return NewSlotCache[*blockSummary]("summary", size)
+}
+
+// newBlockSummary returns the summary of the given block.
+func newBlockSummary(block *BlockWithRoot) (*blockSummary, error) {
+	fields, err := messageFields(block.VersionedSignedBeaconBlock)
+	if err != nil {
+		return nil, err
+	}
+	summary := &blockSummary{
+		Slot:              fields.Slot,
+		ProposerIndex:     fields.ProposerIndex,
+		Root:              "0x" + hex.EncodeToString(block.BlockRoot[:]),
+		ParentRoot:        "0x" + hex.EncodeToString(fields.ParentRoot[:]),
+		Graffiti:          formatGraffiti(fields.Graffiti[:]),
+		AttestationsCount: len(fields.Attestations),
+		DepositsCount:     len(fields.Deposits),
+	}
+	if payload := fields.ExecutionPayload; payload != nil && payload.BlockHash != (phase0.Hash32{}) {
+		summary.ExecutionBlockHash = "0x" + hex.EncodeToString(payload.BlockHash[:])
+	}
+	return summary, nil
+}
+
+// formatGraffiti returns the graffiti as text if it's printable UTF-8
+// (ignoring trailing zero padding), or as hex otherwise.
+func formatGraffiti(graffiti []byte) string {
+	text := bytes.TrimRight(graffiti, "\x00")
+	if utf8.Valid(text) && bytes.IndexFunc(text, func(r rune) bool { return !unicode.IsPrint(r) }) == -1 {
+		return string(text)
+	}
+	return "0x" + hex.EncodeToString(graffiti)
+}
+
+// loadSummary returns the summary of the block at the given slot from the
+// summary cache, or otherwise from the decoded block. It's nil for empty slots.
+func loadSummary(store *Store, slot phase0.Slot) (*blockSummary, error) {
+	if summary, ok := summaryCache.Get(store.network, slot); ok {
+		return summary, nil
+	}
+	block, err := loadBlock(store, slot)
+	if err != nil {
+		return nil, err
+	}
+	var summary *blockSummary
+	if block != nil {
+		summary, err = newBlockSummary(block)
+		if err != nil {
+			return nil, err
+		}
+	}
+	summaryCache.Add(store.network, slot, summary)
+	return summary, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockSummary(t *testing.T) {
+	block := testBellatrixBlock(5, phase0.Hash32{0xab})
+	block.BlockRoot = phase0.Root{1}
+	message := block.Bellatrix.Message
+	message.ProposerIndex = 42
+	message.ParentRoot = phase0.Root{2}
+	copy(message.Body.Graffiti[:], "Lighthouse/v3.1.0")
+	message.Body.Attestations = make([]*phase0.Attestation, 3)
+
+	summary, err := newBlockSummary(block)
+	require.NoError(t, err)
+	require.Equal(t, &blockSummary{
+		Slot:               5,
+		ProposerIndex:      42,
+		Root:               "0x0100000000000000000000000000000000000000000000000000000000000000",
+		ParentRoot:         "0x0200000000000000000000000000000000000000000000000000000000000000",
+		Graffiti:           "Lighthouse/v3.1.0",
+		AttestationsCount:  3,
+		ExecutionBlockHash: "0xab00000000000000000000000000000000000000000000000000000000000000",
+	}, summary)
+
+	// Pre-merge blocks have no execution block hash.
+	summary, err = newBlockSummary(testBlock(6))
+	require.NoError(t, err)
+	require.Equal(t, phase0.Slot(6), summary.Slot)
+	require.Empty(t, summary.ExecutionBlockHash)
+}
+
+func TestFormatGraffiti(t *testing.T) {
+	var graffiti [32]byte
+	require.Equal(t, "", formatGraffiti(graffiti[:]))
+
+	copy(graffiti[:], "hello 🦄")
+	require.Equal(t, "hello 🦄", formatGraffiti(graffiti[:]))
+
+	// Unprintable graffiti is hex-encoded in full.
+	graffiti[0] = 0xff
+	require.Equal(t, "0xff656c6c6f20f09fa68400000000000000000000000000000000000000000000", formatGraffiti(graffiti[:]))
+}
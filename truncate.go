@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo"
+)
+
+// With -max-response-bytes, a block whose JSON response would be larger is
+// served with fewer attestations, dropping them from the end of the block,
+// where proposers pack the least profitable ones, until it fits (or until
+// none are left). The response then has the X-Truncated header, and its
+// "attestations" page tells how many were kept out of how many. Clients
+// which want the whole block regardless pass full=true.
+
+const headerTruncated = "X-Truncated"
+
+// encodeBlockCapped encodes the block's JSON response, trimmed according to
+// opts, and with fewer attestations if it would be larger than maxBytes.
+// truncated is set if attestations were dropped to make it smaller.
+func encodeBlockCapped(block *BlockWithRoot, opts blockOptions, maxBytes int) (body []byte, truncated bool, err error) {
+	encode := func(opts blockOptions) ([]byte, error) {
+		resp, err := blockResponseFields(newBlockResponse(block, opts), opts)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(resp)
+	}
+	body, err = encode(opts)
+	if err != nil || maxBytes <= 0 || opts.full || len(body) <= maxBytes {
+		return body, false, err
+	}
+	fields, err := messageFields(block.VersionedSignedBeaconBlock)
+	if err != nil {
+		return body, false, nil
+	}
+	count := len(pageAttestations(opts, fields.Attestations))
+	if count == 0 {
+		return body, false, nil
+	}
+
+	// Find the most attestations which fit, or none if even that doesn't.
+	trimmed := opts
+	trimmed.paginate = true
+	fits := func(limit int) ([]byte, bool, error) {
+		trimmed.attestationsLimit = limit
+		body, err := encode(trimmed)
+		return body, err == nil && len(body) <= maxBytes, err
+	}
+	low, high := 0, count-1
+	for low < high {
+		mid := (low + high + 1) / 2
+		_, ok, err := fits(mid)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	smaller, _, err := fits(low)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(smaller) >= len(body) {
+		// The attestations weren't selected, so dropping them doesn't help.
+		return body, false, nil
+	}
+	return smaller, true, nil
+}
+
+// writeBlockCapped writes the block as a JSON response, like writeBlock, but
+// with fewer attestations if it would be larger than -max-response-bytes.
+func writeBlockCapped(c echo.Context, block *BlockWithRoot, opts blockOptions) error {
+	body, truncated, err := encodeBlockCapped(block, opts, *maxResponseBytes)
+	if err != nil {
+		return err
+	}
+	if truncated {
+		c.Response().Header().Set(headerTruncated, "attestations")
+	}
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c.Response().WriteHeader(http.StatusOK)
+	_, err = c.Response().Write(append(body, '\n'))
+	return err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeBlockCapped(t *testing.T) {
+	block := testBlock(30)
+	for i := 0; i < 20; i++ {
+		block.Phase0.Message.Body.Attestations = append(block.Phase0.Message.Body.Attestations, &phase0.Attestation{
+			AggregationBits: []byte{0xff, 0x01},
+			Data:            &phase0.AttestationData{Slot: phase0.Slot(i), Source: &phase0.Checkpoint{}, Target: &phase0.Checkpoint{}},
+		})
+	}
+	opts := blockOptions{attestationsLimit: -1}
+	page := func(body []byte) attestationsPage {
+		var resp struct {
+			Attestations attestationsPage `json:"attestations"`
+			Data         struct {
+				Message struct {
+					Body struct {
+						Attestations []interface{} `json:"attestations"`
+					} `json:"body"`
+				} `json:"message"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(body, &resp))
+		require.Len(t, resp.Data.Message.Body.Attestations, resp.Attestations.Count)
+		return resp.Attestations
+	}
+
+	full, truncated, err := encodeBlockCapped(block, opts, 0)
+	require.NoError(t, err)
+	require.False(t, truncated)
+
+	// The most attestations which fit are kept.
+	fiveOpts := opts
+	fiveOpts.paginate, fiveOpts.attestationsLimit = true, 5
+	five, _, err := encodeBlockCapped(block, fiveOpts, 0)
+	require.NoError(t, err)
+	body, truncated, err := encodeBlockCapped(block, opts, len(five)+1)
+	require.NoError(t, err)
+	require.True(t, truncated)
+	require.Equal(t, five, body)
+	require.Equal(t, attestationsPage{Offset: 0, Count: 5, Total: 20}, page(body))
+
+	// Or none, if even that doesn't fit.
+	body, truncated, err = encodeBlockCapped(block, opts, 10)
+	require.NoError(t, err)
+	require.True(t, truncated)
+	require.Equal(t, attestationsPage{Offset: 0, Count: 0, Total: 20}, page(body))
+
+	// Blocks which fit, and full=true, are left alone.
+	body, truncated, err = encodeBlockCapped(block, opts, len(full))
+	require.NoError(t, err)
+	require.False(t, truncated)
+	require.Equal(t, full, body)
+	fullOpts := opts
+	fullOpts.full = true
+	body, truncated, err = encodeBlockCapped(block, fullOpts, 10)
+	require.NoError(t, err)
+	require.False(t, truncated)
+	require.Equal(t, full, body)
+
+	// Dropping attestations which weren't selected doesn't help.
+	rootOpts := opts
+	rootOpts.fields, err = parseFields("root")
+	require.NoError(t, err)
+	_, truncated, err = encodeBlockCapped(block, rootOpts, 10)
+	require.NoError(t, err)
+	require.False(t, truncated)
+
+	// The response says it was truncated.
+	prevMaxResponseBytes := *maxResponseBytes
+	*maxResponseBytes = len(five) + 1
+	t.Cleanup(func() { *maxResponseBytes = prevMaxResponseBytes })
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	require.NoError(t, writeBlock(c, block, opts))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "attestations", rec.Header().Get(headerTruncated))
+	require.Equal(t, 5, page(rec.Body.Bytes()).Count)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/attestantio/go-eth2-client/auto"
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/pkg/errors"
+)
+
+const (
+	// How many recent blocks -validate checks per network.
+	validateBlocks = 4
+
+	// How many slots back from the head -validate looks for them.
+	validateMaxSlots = 64
+)
+
+// runValidate checks that each network's node is reachable, has a sane spec,
+// and serves recent blocks which survive being stored, without writing
+// anything to disk. It returns an error if any network fails.
+func runValidate(ctx context.Context, config *Config) error {
+	failed := 0
+	for _, network := range config.Networks {
+		if err := validateNetwork(ctx, network); err != nil {
+			componentLogger("validate", network.Name).Error().Err(err).Msg("validation failed")
+			failed++
+			continue
+		}
+		componentLogger("validate", network.Name).Info().Msg("validation passed")
+	}
+	if failed > 0 {
+		return errors.Errorf("%d of %d networks failed validation", failed, len(config.Networks))
+	}
+	return nil
+}
+
+func validateNetwork(ctx context.Context, network NetworkConfig) error {
+	svc, err := auto.New(ctx,
+		auto.WithAddress(network.NodeURL),
+		auto.WithLogLevel(clientLevel),
+		auto.WithTimeout(*nodeTimeout),
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to node")
+	}
+	networkSpec, err := fetchSpec(ctx, svc)
+	if err != nil {
+		return err
+	}
+	log := componentLogger("validate", network.Name)
+	log.Info().Time("genesis_time", networkSpec.GenesisTime).Uint64("slots_per_epoch", networkSpec.SlotsPerEpoch).Dur("slot_duration", networkSpec.SlotDuration()).Msg("fetched spec")
+
+	headSlot, err := fetchHeadSlot(ctx, svc)
+	if err != nil {
+		return err
+	}
+	checked := 0
+	for slot := headSlot; checked < validateBlocks && headSlot-slot < validateMaxSlots; slot-- {
+		block, err := getBlock(ctx, svc, slot)
+		if err != nil && !isBlockNotFound(err) {
+			return errors.Wrapf(err, "failed to fetch block at slot %d", slot)
+		}
+		if block != nil {
+			if err := validateBlock(block); err != nil {
+				return errors.Wrapf(err, "block at slot %d", slot)
+			}
+			log.Info().Uint64("slot", uint64(slot)).Str("version", block.Version.String()).Msg("block round-tripped")
+			checked++
+		}
+		if slot == 0 {
+			break
+		}
+	}
+	if checked == 0 {
+		return errors.Errorf("no blocks within %d slots of head slot %d", validateMaxSlots, headSlot)
+	}
+	return nil
+}
+
+// validateBlock round-trips a block through the stored encoding, checking
+// that its fork is supported and that it decodes to the same root.
+func validateBlock(block *spec.VersionedSignedBeaconBlock) error {
+	original, err := marshalBlock(block)
+	if err != nil {
+		return err
+	}
+	root, err := block.Root()
+	if err != nil {
+		return errors.Wrap(err, "failed to get root")
+	}
+	val, err := encodeBlock(&BlockWithRoot{VersionedSignedBeaconBlock: block, BlockRoot: root}, codec)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode")
+	}
+	decoded, err := decodeBlock(val)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode")
+	}
+	decodedRoot, err := decoded.Root()
+	if err != nil {
+		return errors.Wrap(err, "failed to get decoded root")
+	}
+	if decoded.Version != block.Version || decoded.BlockRoot != root || decodedRoot != root {
+		return errors.Errorf("decoded %s block with root %#x differs from original %s block with root %#x", decoded.Version, decodedRoot, block.Version, root)
+	}
+	roundTripped, err := marshalBlock(decoded.VersionedSignedBeaconBlock)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(original, roundTripped) {
+		return errors.New("decoded block's SSZ differs from original")
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateBlock(t *testing.T) {
+	for _, block := range testForkBlocks() {
+		require.NoError(t, validateBlock(block), block.Version.String())
+	}
+
+	unsupported := *testBlock(1).VersionedSignedBeaconBlock
+	unsupported.Version = spec.DataVersion(99)
+	require.ErrorContains(t, validateBlock(&unsupported), "unsupported fork version 99")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/labstack/echo"
+)
+
+// corruptRecordError is returned for stored records which fail to decode,
+// such as partially written ones.
+type corruptRecordError struct {
+	err error
+}
+
+func (e corruptRecordError) Error() string {
+	return "corrupt block record: " + e.err.Error()
+}
+
+func (e corruptRecordError) Unwrap() error {
+	return e.err
+}
+
+// corruptSlot is a slot whose record failed verification.
+type corruptSlot struct {
+	Slot  phase0.Slot `json:"slot"`
+	Error string      `json:"error"`
+}
+
+// Verify decodes every scraped slot within the given range (inclusive), and
+// returns those whose records are corrupt or hold a block of another slot,
+// along with how many slots were checked.
+func (s *Store) Verify(from, to phase0.Slot) (corrupt []corruptSlot, checked int, err error) {
+	corrupt = []corruptSlot{}
+	err = s.iterateSlots(from, to, func(slot phase0.Slot, val []byte) error {
+		checked++
+		if err := verifyRecord(slot, val); err != nil {
+			corrupt = append(corrupt, corruptSlot{Slot: slot, Error: err.Error()})
+		}
+		return nil
+	})
+	return corrupt, checked, err
+}
+
+// verifyRecord checks that the slot's record decodes into a block of that
+// slot (or none).
+func verifyRecord(slot phase0.Slot, val []byte) error {
+	block, err := decodeBlock(val)
+	if err != nil || block == nil {
+		return err
+	}
+	fields, err := messageFields(block.VersionedSignedBeaconBlock)
+	if err != nil {
+		return err
+	}
+	if fields.Slot != slot {
+		return fmt.Errorf("block is of slot %d", fields.Slot)
+	}
+	return nil
+}
+
+// verifyHandler verifies the records within a range of slots, and with the
+// repair param, invalidates the corrupt ones so that they're scraped again.
+func verifyHandler(c echo.Context) error {
+	from, to, err := parseSlotRange(c, *maxScanSlots)
+	if err != nil {
+		return err
+	}
+	repair, _ := strconv.ParseBool(c.QueryParam("repair"))
+	store, err := getStore(c.Param("network"))
+	if err != nil {
+		return err
+	}
+	corrupt, checked, err := store.Verify(from, to)
+	if err != nil {
+		return err
+	}
+	if repair {
+		for _, slot := range corrupt {
+			if _, err := store.Invalidate(slot.Slot, slot.Slot); err != nil {
+				return err
+			}
+		}
+	}
+	if len(corrupt) > 0 {
+		componentLogger("store", store.network).Warn().Int("corrupt", len(corrupt)).Bool("repair", repair).Msg("found corrupt slots")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"checked":  checked,
+		"corrupt":  corrupt,
+		"repaired": repair,
+	})
+}
+
+// repairHandler verifies the records within a range of slots, and re-fetches
+// the corrupt ones (including those of unsupported forks) from the node,
+// rewriting them with the current code.
+func repairHandler(c echo.Context) error {
+	network := c.Param("network")
+	from, to, err := parseSlotRange(c, *maxScanSlots)
+	if err != nil {
+		return err
+	}
+	store, err := getStore(network)
+	if err != nil {
+		return err
+	}
+	if _, ok := nodes.Get(network); !ok {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "not connected to the network's node")
+	}
+	corrupt, checked, err := store.Verify(from, to)
+	if err != nil {
+		return err
+	}
+
+	repaired, failed := 0, []corruptSlot{}
+	for _, slot := range corrupt {
+		if _, err := refetchSlot(c.Request().Context(), store, network, slot.Slot, false); err != nil {
+			failed = append(failed, corruptSlot{Slot: slot.Slot, Error: err.Error()})
+			continue
+		}
+		repaired++
+	}
+	if len(corrupt) > 0 {
+		componentLogger("store", network).Info().Int("repaired", repaired).Int("failed", len(failed)).Msg("repaired corrupt slots")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"checked":  checked,
+		"repaired": repaired,
+		"failed":   failed,
+	})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	const network = "verify"
+	store := newTestStore(t)
+	stores.Set(network, store)
+	t.Cleanup(func() { stores.Del(network) })
+
+	// Slots 1 and 2 are fine, 3 holds slot 4's block, and 5 to 8 are corrupt.
+	require.NoError(t, store.SetBlock(1, testBlock(1)))
+	require.NoError(t, store.SetBlock(2, nil))
+	require.NoError(t, store.SetBlock(3, testBlock(4)))
+	header := func(version spec.DataVersion, codec Codec) []byte {
+		val := make([]byte, 40)
+		binary.BigEndian.PutUint64(val, uint64(codec)<<56|forkNumber(version))
+		return val
+	}
+	records := map[phase0.Slot][]byte{
+		5: {1, 2, 3},
+		6: header(spec.DataVersionPhase0, CodecSnappy)[:20],
+		7: append(header(spec.DataVersionPhase0, CodecSnappy), "not snappy"...),
+		8: append(header(spec.DataVersionAltair, CodecSnappy), 0),
+	}
+	err := store.db.Update(func(txn *badger.Txn) error {
+		for slot, val := range records {
+			if err := txn.Set(slotKey(keySlot, slot), val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	// Corrupt records fail to decode rather than panic.
+	for slot := range records {
+		_, err := store.Block(slot)
+		require.ErrorAs(t, err, &corruptRecordError{}, slot)
+	}
+	for _, slot := range []phase0.Slot{5, 6, 7} {
+		_, _, err := store.BlockSSZ(slot)
+		require.ErrorAs(t, err, &corruptRecordError{}, slot)
+	}
+	_, _, err = store.Count()
+	require.ErrorAs(t, err, &corruptRecordError{})
+
+	corrupt, checked, err := store.Verify(0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 7, checked)
+	var slots []phase0.Slot
+	for _, c := range corrupt {
+		slots = append(slots, c.Slot)
+		require.NotEmpty(t, c.Error)
+	}
+	require.Equal(t, []phase0.Slot{3, 5, 6, 7, 8}, slots)
+
+	// Repairing invalidates them, so that they're scraped again.
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodPost, "/?from=0&to=10&repair=true", nil), rec)
+	c.SetParamNames("network")
+	c.SetParamValues(network)
+	require.NoError(t, verifyHandler(c))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp struct {
+		Checked int           `json:"checked"`
+		Corrupt []corruptSlot `json:"corrupt"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, 7, resp.Checked)
+	require.Len(t, resp.Corrupt, 5)
+	for slot := phase0.Slot(1); slot <= 8; slot++ {
+		filled, err := store.Filled(slot)
+		require.NoError(t, err)
+		require.Equal(t, slot <= 2, filled, slot)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	const network = "repair"
+	store := newTestStore(t)
+	stores.Set(network, store)
+	networks.Set(network, NetworkConfig{Name: network, RetentionSlots: 10})
+	nodes.Set(network, &fakeNode{blocks: map[string]*spec.VersionedSignedBeaconBlock{
+		"3": testBlock(3).VersionedSignedBeaconBlock,
+	}})
+	t.Cleanup(func() {
+		stores.Del(network)
+		networks.Del(network)
+		nodes.Del(network)
+	})
+	require.NoError(t, store.SetSpec(&NetworkSpec{
+		GenesisTime:    time.Now().Add(-100 * 12 * time.Second),
+		SecondsPerSlot: 12,
+		SlotsPerEpoch:  32,
+	}))
+	require.NoError(t, store.SetHeadSlot(100))
+
+	// Slot 3 is garbage, 4 is of an unknown fork (and empty at the node),
+	// and 150 is after the node's head, so it can't be repaired.
+	require.NoError(t, store.SetBlock(2, testBlock(2)))
+	unknownFork := make([]byte, 41)
+	binary.BigEndian.PutUint64(unknownFork, 99)
+	err := store.db.Update(func(txn *badger.Txn) error {
+		for slot, val := range map[phase0.Slot][]byte{3: {1, 2, 3}, 4: unknownFork, 150: {1}} {
+			if err := txn.Set(slotKey(keySlot, slot), val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodPost, "/?from=0&to=200", nil), rec)
+	c.SetParamNames("network")
+	c.SetParamValues(network)
+	require.NoError(t, repairHandler(c))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp struct {
+		Checked  int           `json:"checked"`
+		Repaired int           `json:"repaired"`
+		Failed   []corruptSlot `json:"failed"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, 4, resp.Checked)
+	require.Equal(t, 2, resp.Repaired)
+	require.Len(t, resp.Failed, 1)
+	require.Equal(t, phase0.Slot(150), resp.Failed[0].Slot)
+
+	block, err := store.Block(3)
+	require.NoError(t, err)
+	require.Equal(t, phase0.Slot(3), block.Phase0.Message.Slot)
+	block, err = store.Block(4)
+	require.NoError(t, err)
+	require.Nil(t, block)
+
+	// Repaired slots from before the retention window aren't pinned.
+	pins, err := store.Pins()
+	require.NoError(t, err)
+	require.Empty(t, pins)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// serverPaths are the routes which aren't specific to a network, and so are
+// served as they are on networks' hosts too.
+var serverPaths = map[string]bool{
+	"/metrics":  true,
+	"/healthz":  true,
+	"/readyz":   true,
+	"/networks": true,
+	"/status":   true,
+}
+
+// networkOfHost returns the network whose configured host is the given one,
+// ignoring its port.
+func networkOfHost(host string) (name string, ok bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	networks.Range(func(_ string, network NetworkConfig) bool {
+		if network.Host != "" && strings.EqualFold(network.Host, host) {
+			name, ok = network.Name, true
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// hostMiddleware routes the requests for a network's host to the network's
+// routes, by prefixing their path with its name, so that mainnet.example.com/123
+// is served as /mainnet/123. Paths which already start with the network, and
+// the server's own routes, are left as they are.
+func hostMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		network, ok := networkOfHost(req.Host)
+		if !ok {
+			return next(c)
+		}
+		path, prefix := req.URL.Path, "/"+network
+		if serverPaths[path] || path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return next(c)
+		}
+		req.URL.Path = prefix + path
+		if req.URL.RawPath != "" {
+			req.URL.RawPath = prefix + req.URL.RawPath
+		}
+		return next(c)
+	}
+}
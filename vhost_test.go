@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostMiddleware(t *testing.T) {
+	networks.Set("vhost", NetworkConfig{Name: "vhost", Host: "Vhost.example.com"})
+	t.Cleanup(func() { networks.Del("vhost") })
+
+	e := echo.New()
+	e.Pre(hostMiddleware)
+	e.Pre(middleware.RemoveTrailingSlash())
+	e.GET("/healthz", func(c echo.Context) error {
+		return c.String(http.StatusOK, "healthz")
+	})
+	e.GET("/status", func(c echo.Context) error {
+		return c.String(http.StatusOK, "status")
+	})
+	e.GET("/:network", func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Param("network"))
+	})
+	e.GET("/:network/:slot", func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Param("network")+" "+c.Param("slot"))
+	})
+
+	for _, tc := range []struct {
+		host, path, expected string
+	}{
+		{"vhost.example.com", "/123", "vhost 123"},
+		{"vhost.example.com:8080", "/123", "vhost 123"},
+		{"vhost.example.com", "/vhost/123", "vhost 123"},
+		{"vhost.example.com", "/", "vhost"},
+		{"vhost.example.com", "/healthz", "healthz"},
+		{"vhost.example.com", "/status", "status"},
+		{"localhost:8080", "/vhost/123", "vhost 123"},
+		{"localhost:8080", "/123", "123"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Host = tc.host
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, tc)
+		require.Equal(t, tc.expected, rec.Body.String(), tc)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/cornelk/hashmap"
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+)
+
+// DELETE /:network/data wipes a network's store, so that it's scraped afresh
+// without touching the other networks or deleting the database from under
+// the running server. The network's tasks (such as scraping) are stopped
+// during the wipe, and started again after it.
+
+// noHeadSlot is cached as the head slot of a wiped store, which has none.
+const noHeadSlot = phase0.Slot(math.MaxUint64)
+
+// wipeRequests holds the channel of each running network through which its
+// wipes are requested, see runNetwork. Each request receives the error of
+// its wipe.
+var wipeRequests = hashmap.New[string, chan chan error]()
+
+// Wipe drops every key of the store, and forgets what it cached of them.
+// Its tasks must be stopped first, or they may write to it as it's wiped.
+func (s *Store) Wipe() error {
+	s.reindexMu.Lock()
+	defer s.reindexMu.Unlock()
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+	s.bitmapMu.Lock()
+	defer s.bitmapMu.Unlock()
+
+	if err := s.db.DropAll(); err != nil {
+		return err
+	}
+	s.finalized.Store((*phase0.Checkpoint)(nil))
+	s.head.Store(noHeadSlot)
+	// Counted long ago, so that they're counted afresh.
+	s.counts.Store(&slotCounts{})
+	s.cache.RemoveNetwork(s.network)
+	s.summaryCache.RemoveNetwork(s.network)
+	s.participationCache.RemoveNetwork(s.network)
+	return nil
+}
+
+// wipeHandler wipes the network's store, stopping its scraping meanwhile.
+func wipeHandler(c echo.Context) error {
+	network := c.Param("network")
+	if _, err := getStore(network); err != nil {
+		return err
+	}
+	wipe, ok := wipeRequests.Get(network)
+	if !ok {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "network not running")
+	}
+	start := time.Now()
+	done := make(chan error, 1)
+	select {
+	case wipe <- done:
+	case <-c.Request().Context().Done():
+		return c.Request().Context().Err()
+	}
+	// Once requested, the wipe runs to completion, so it's waited for.
+	if err := <-done; err != nil {
+		componentLogger("store", network).Error().Err(err).Msg("failed to wipe store")
+		return errors.Wrap(err, "failed to wipe store")
+	}
+	duration := time.Since(start)
+	componentLogger("store", network).Warn().Dur("duration", duration).Msg("wiped store")
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"duration_seconds": duration.Seconds(),
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWipe(t *testing.T) {
+	store := newTestStore(t)
+	store.cache = NewBlockCache(10)
+	require.NoError(t, store.SetBlocks(map[phase0.Slot]*BlockWithRoot{
+		1: testBlock(1),
+		2: nil,
+	}))
+	_, err := loadBlock(store, 1)
+	require.NoError(t, err)
+	slots, blocks, err := store.CachedCount()
+	require.NoError(t, err)
+	require.Equal(t, 2, slots)
+	require.Equal(t, 1, blocks)
+	require.NoError(t, store.SetHeadSlot(10))
+	require.NoError(t, store.SetFinalized(&phase0.Checkpoint{Epoch: 5}))
+	_, ok, err := store.AdvanceCheckpoint(1)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	require.NoError(t, store.Wipe())
+	_, err = store.Block(1)
+	require.ErrorIs(t, err, badger.ErrKeyNotFound)
+	_, ok = store.cache.Get(store.network, 1)
+	require.False(t, ok)
+	slots, blocks, err = store.CachedCount()
+	require.NoError(t, err)
+	require.Zero(t, slots)
+	require.Zero(t, blocks)
+	filled, err := store.Filled(2)
+	require.NoError(t, err)
+	require.False(t, filled)
+	_, ok, err = store.HeadSlot()
+	require.NoError(t, err)
+	require.False(t, ok)
+	finalized, err := store.Finalized()
+	require.NoError(t, err)
+	require.Nil(t, finalized)
+	_, ok, err = store.Checkpoint()
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// It's scraped afresh, from an earlier finalized checkpoint than before.
+	require.NoError(t, store.SetHeadSlot(8))
+	require.NoError(t, store.SetFinalized(&phase0.Checkpoint{Epoch: 3}))
+	slot, ok, err := store.HeadSlot()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, phase0.Slot(8), slot)
+	finalized, err = store.Finalized()
+	require.NoError(t, err)
+	require.Equal(t, phase0.Epoch(3), finalized.Epoch)
+}
+
+func TestWipeHandler(t *testing.T) {
+	prevDataDir := *dataDir
+	*dataDir = t.TempDir()
+	t.Cleanup(func() { *dataDir = prevDataDir })
+
+	e := echo.New()
+	wipe := func(network string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodDelete, "/"+network+"/data", nil), rec)
+		c.SetParamNames("network")
+		c.SetParamValues(network)
+		if err := wipeHandler(c); err != nil {
+			e.HTTPErrorHandler(err, c)
+		}
+		return rec
+	}
+	require.Equal(t, http.StatusNotFound, wipe("wipe").Code)
+
+	// The node is unreachable, so the network just keeps retrying to scrape.
+	network := NetworkConfig{Name: "wipe", NodeURL: "http://127.0.0.1:1"}
+	runners := networkRunners{}
+	runners.apply(context.Background(), &Config{Networks: []NetworkConfig{network}})
+	t.Cleanup(runners.stopAll)
+	require.Eventually(t, func() bool {
+		_, ok := wipeRequests.Get(network.Name)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+	store, _ := stores.Get(network.Name)
+	require.NoError(t, store.SetBlock(1, testBlock(1)))
+
+	require.Equal(t, http.StatusOK, wipe(network.Name).Code)
+	_, err := store.Block(1)
+	require.ErrorIs(t, err, badger.ErrKeyNotFound)
+
+	// The network keeps running, with the same store, and can be wiped again.
+	same, ok := stores.Get(network.Name)
+	require.True(t, ok)
+	require.Same(t, store, same)
+	require.Equal(t, http.StatusOK, wipe(network.Name).Code)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io"
+
+	"github.com/labstack/echo"
+	"golang.org/x/net/websocket"
+)
+
+// wsHandler pushes the network's newly stored slots over a WebSocket, as JSON
+// messages. The connection is closed if the client falls too far behind.
+func wsHandler(c echo.Context) error {
+	filter, err := parseEventFilter(c)
+	if err != nil {
+		return err
+	}
+	store, err := getStore(c.Param("network"))
+	if err != nil {
+		return err
+	}
+
+	// A websocket.Server without a handshake accepts any origin, unlike
+	// websocket.Handler, which rejects non-browser clients.
+	websocket.Server{Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+		sub := store.broker.Subscribe()
+		defer store.broker.Unsubscribe(sub)
+
+		// Clients don't send anything, so reading only detects them leaving.
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			io.Copy(io.Discard, ws)
+		}()
+
+		for {
+			select {
+			case event, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				if !filter.matches(event) {
+					continue
+				}
+				if err := websocket.JSON.Send(ws, event); err != nil {
+					return
+				}
+			case <-closed:
+				return
+			}
+		}
+	}}.ServeHTTP(c.Response(), c.Request())
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/goccy/go-yaml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptsYAML(t *testing.T) {
+	for accept, expected := range map[string]bool{
+		"":                                  false,
+		"application/json":                  false,
+		"application/yaml":                  true,
+		"application/x-yaml":                true,
+		"text/html, application/yaml;q=0.9": true,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", accept)
+		require.Equal(t, expected, acceptsYAML(r), accept)
+	}
+}
+
+func TestEncodeBlockYAML(t *testing.T) {
+	block := testBellatrixBlock(3, phase0.Hash32{1})
+	data, err := encodeBlockYAML(block, blockOptions{attestationsLimit: -1})
+	require.NoError(t, err)
+
+	// Integers are plain and byte arrays are hex.
+	var resp struct {
+		Version string `yaml:"version"`
+		Data    struct {
+			Message struct {
+				Slot uint64 `yaml:"slot"`
+				Body struct {
+					ExecutionPayload struct {
+						BlockHash string `yaml:"block_hash"`
+					} `yaml:"execution_payload"`
+				} `yaml:"body"`
+			} `yaml:"message"`
+		} `yaml:"data"`
+	}
+	require.NoError(t, yaml.Unmarshal(data, &resp))
+	require.Equal(t, "bellatrix", resp.Version)
+	require.Equal(t, uint64(3), resp.Data.Message.Slot)
+	require.Equal(t, "0x0100000000000000000000000000000000000000000000000000000000000000", resp.Data.Message.Body.ExecutionPayload.BlockHash)
+	require.Contains(t, string(data), "\n    slot: 3\n")
+
+	// Fields are selected as with JSON.
+	fields, err := parseFields("data.message.slot")
+	require.NoError(t, err)
+	data, err = encodeBlockYAML(block, blockOptions{attestationsLimit: -1, fields: fields})
+	require.NoError(t, err)
+	require.Equal(t, "data:\n  message:\n    slot: 3\n", string(data))
+
+	fields, err = parseFields("data.nope")
+	require.NoError(t, err)
+	_, err = encodeBlockYAML(block, blockOptions{attestationsLimit: -1, fields: fields})
+	require.Error(t, err)
+}